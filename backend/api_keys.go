@@ -0,0 +1,363 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 接口权限：ingest 只能上报数据，read 只能查询，debug 还可以运行重放（产生调用费用）和修改调试数据，
+// admin 可以访问全部接口，包括删除数据和管理项目、密钥和用户
+const (
+	ScopeIngest = "ingest"
+	ScopeRead   = "read"
+	ScopeDebug  = "debug"
+	ScopeAdmin  = "admin"
+)
+
+// APIKeyHeader 传递API密钥的请求头，也可以使用 Authorization: Bearer <key>
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyPrefix 生成的密钥统一以该前缀开头，便于在日志和配置中识别
+const apiKeyPrefix = "lt_"
+
+// apiKeyContextKey 请求上下文中保存调用方API密钥的键
+const apiKeyContextKey = "api_key"
+
+// apiKeyTouchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+const apiKeyTouchInterval = time.Minute
+
+// isValidScope 检查API密钥权限是否有效
+func isValidScope(scope string) bool {
+	switch scope {
+	case ScopeIngest, ScopeRead, ScopeDebug, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// scopeIncludes 检查已授予的权限是否包含所需权限：admin 包含全部权限，debug 包含 read
+func scopeIncludes(granted, required string) bool {
+	switch granted {
+	case required, ScopeAdmin:
+		return true
+	case ScopeDebug:
+		return required == ScopeRead
+	}
+	return false
+}
+
+// hasScope 检查密钥是否具备指定权限
+func (k *APIKey) hasScope(scope string) bool {
+	return scopeIncludes(k.Scope, scope)
+}
+
+// hashToken 计算API密钥或登录令牌的SHA-256摘要，数据库只保存摘要
+func hashToken(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKey 生成随机密钥
+func generateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %v", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// apiKeyFromRequest 从请求头读取API密钥
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader(APIKeyHeader)); key != "" {
+		return key
+	}
+	auth := strings.TrimSpace(c.GetHeader("Authorization"))
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// authenticateAPIKey 校验API密钥，配置的初始管理员密钥不保存在数据库中
+func authenticateAPIKey(rawKey string) (*APIKey, error) {
+	keyHash := hashToken(rawKey)
+
+	if adminKey := GetConfig().Auth.AdminKey; adminKey != "" &&
+		subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashToken(adminKey))) == 1 {
+		return &APIKey{ID: "config", Name: "config admin key", Scope: ScopeAdmin}, nil
+	}
+
+	key, err := getAPIKeyByHash(keyHash)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := touchAPIKey(key.ID, now); err != nil {
+			log.Printf("Failed to update api key last used time: %v", err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// authMiddleware 识别调用方：优先使用API密钥，其次使用登录Cookie。
+// 启用认证时要求有效的API密钥或登录会话；未启用时只识别登录用户，不拒绝请求
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enabled := GetConfig().Auth.Enabled
+
+		rawKey := apiKeyFromRequest(c)
+		if rawKey == "" || !enabled {
+			user, err := authenticateLoginSession(c)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to verify login session: " + err.Error(),
+				})
+				return
+			}
+			if user != nil {
+				c.Set(userContextKey, user)
+			} else if enabled {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, APIResponse{
+					Success: false,
+					Message: "API key or login required",
+				})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		key, err := authenticateAPIKey(rawKey)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to verify api key: " + err.Error(),
+			})
+			return
+		}
+
+		if key == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, APIResponse{
+				Success: false,
+				Message: "Invalid API key",
+			})
+			return
+		}
+
+		c.Set(apiKeyContextKey, key)
+		c.Next()
+	}
+}
+
+// requireScope 要求调用方的API密钥或登录用户的角色具备指定权限，未启用认证时不做限制
+func requireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetConfig().Auth.Enabled {
+			c.Next()
+			return
+		}
+
+		if key := currentAPIKey(c); key != nil && !key.hasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "API key does not have " + scope + " scope",
+			})
+			return
+		}
+		if user := currentUser(c); user != nil && !user.hasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "Role " + user.Role + " does not have " + scope + " permission",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireAllProjects 要求调用方的API密钥不限定项目，用于管理项目和用户
+func requireAllProjects() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := currentAPIKey(c)
+		if key != nil && key.ProjectID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "API key is restricted to a single project",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentAPIKey 获取调用方的API密钥，未启用认证时返回nil
+func currentAPIKey(c *gin.Context) *APIKey {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil
+	}
+	key, _ := value.(*APIKey)
+	return key
+}
+
+// keyAllowsProject 检查调用方的API密钥能否访问指定项目
+func keyAllowsProject(c *gin.Context, projectID string) bool {
+	key := currentAPIKey(c)
+	return key == nil || key.ProjectID == "" || key.ProjectID == projectID
+}
+
+// handleCreateAPIKey 创建API密钥，密钥明文只在响应中返回一次
+func handleCreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name cannot be empty",
+		})
+		return
+	}
+
+	if !isValidScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid scope: " + req.Scope + " (expected ingest, read, debug or admin)",
+		})
+		return
+	}
+
+	projectID := ""
+	if req.Project != "" {
+		project, err := resolveProject(req.Project)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get project: " + err.Error(),
+			})
+			return
+		}
+		if project == nil || !keyAllowsProject(c, project.ID) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Project not found: " + req.Project,
+			})
+			return
+		}
+		projectID = project.ID
+	}
+
+	// 限定项目的密钥只能创建同一项目的密钥
+	if caller := currentAPIKey(c); caller != nil && caller.ProjectID != "" {
+		projectID = caller.ProjectID
+	}
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create api key: " + err.Error(),
+		})
+		return
+	}
+
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Scope:     req.Scope,
+		ProjectID: projectID,
+		Prefix:    rawKey[:len(apiKeyPrefix)+8],
+		KeyHash:   hashToken(rawKey),
+	}
+	if err := createAPIKey(key); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create api key: " + err.Error(),
+		})
+		return
+	}
+
+	key.Key = rawKey
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    key,
+	})
+}
+
+// handleGetAPIKeys 获取API密钥列表（不含密钥明文），限定项目的密钥只能看到同一项目的密钥
+func handleGetAPIKeys(c *gin.Context) {
+	projectID := ""
+	if caller := currentAPIKey(c); caller != nil {
+		projectID = caller.ProjectID
+	}
+
+	keys, err := getAPIKeys(projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get api keys: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    keys,
+	})
+}
+
+// handleDeleteAPIKey 吊销API密钥
+func handleDeleteAPIKey(c *gin.Context) {
+	keyID := c.Param("id")
+	key, err := getAPIKey(keyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get api key: " + err.Error(),
+		})
+		return
+	}
+
+	caller := currentAPIKey(c)
+	if key == nil || (caller != nil && caller.ProjectID != "" && key.ProjectID != caller.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "API key not found",
+		})
+		return
+	}
+
+	if err := deleteAPIKey(keyID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete api key: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "API key deleted successfully",
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestScopeIncludes(t *testing.T) {
+	cases := []struct {
+		granted  string
+		required string
+		want     bool
+	}{
+		{ScopeIngest, ScopeIngest, true},
+		{ScopeIngest, ScopeRead, false},
+		{ScopeIngest, ScopeDebug, false},
+		{ScopeIngest, ScopeAdmin, false},
+		{ScopeRead, ScopeIngest, false},
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeDebug, false},
+		{ScopeRead, ScopeAdmin, false},
+		{ScopeDebug, ScopeIngest, false},
+		{ScopeDebug, ScopeRead, true},
+		{ScopeDebug, ScopeDebug, true},
+		{ScopeDebug, ScopeAdmin, false},
+		{ScopeAdmin, ScopeIngest, true},
+		{ScopeAdmin, ScopeRead, true},
+		{ScopeAdmin, ScopeDebug, true},
+		{ScopeAdmin, ScopeAdmin, true},
+		{"", ScopeRead, false},
+		{"owner", ScopeRead, false},
+	}
+
+	for _, tc := range cases {
+		if got := scopeIncludes(tc.granted, tc.required); got != tc.want {
+			t.Errorf("scopeIncludes(%q, %q) = %v, want %v", tc.granted, tc.required, got, tc.want)
+		}
+	}
+}
+
+func TestProjectScopedAdminKeyManagesOwnProjectKeys(t *testing.T) {
+	setupTestEnv(t, &Config{Auth: AuthConfig{Enabled: true}})
+	r := newTestRouter()
+
+	alpha := &Project{ID: uuid.New().String(), Name: "alpha"}
+	beta := &Project{ID: uuid.New().String(), Name: "beta"}
+	for _, project := range []*Project{alpha, beta} {
+		if err := createProject(project); err != nil {
+			t.Fatalf("createProject: %v", err)
+		}
+	}
+	scoped := map[string]string{APIKeyHeader: createTestAPIKey(t, ScopeAdmin, alpha.ID)}
+	createTestAPIKey(t, ScopeRead, beta.ID)
+	createTestAPIKey(t, ScopeRead, "")
+
+	createKey := func(body map[string]string) (int, APIKey) {
+		w := doJSON(t, r, http.MethodPost, "/api/api-keys", body, scoped)
+		var resp struct {
+			Data APIKey `json:"data"`
+		}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode api key: %v", err)
+			}
+		}
+		return w.Code, resp.Data
+	}
+
+	// 限定项目的 admin 密钥可以为本项目创建 admin 密钥，未指定项目时也限定在本项目
+	code, created := createKey(map[string]string{"name": "alpha-admin", "scope": ScopeAdmin})
+	if code != http.StatusOK || created.ProjectID != alpha.ID || created.Key == "" {
+		t.Fatalf("create admin key: status %d, key %+v", code, created)
+	}
+	if code, key := createKey(map[string]string{"name": "alpha-read", "scope": ScopeRead, "project": "alpha"}); code != http.StatusOK || key.ProjectID != alpha.ID {
+		t.Fatalf("create key for own project: status %d, key %+v", code, key)
+	}
+	if code, _ := createKey(map[string]string{"name": "beta-admin", "scope": ScopeAdmin, "project": "beta"}); code != http.StatusNotFound {
+		t.Fatalf("create key for another project: status %d, want 404", code)
+	}
+
+	// 新密钥只能访问本项目
+	createdHeader := map[string]string{APIKeyHeader: created.Key}
+	if w := doJSON(t, r, http.MethodGet, "/api/sessions", nil, createdHeader); w.Code != http.StatusOK {
+		t.Fatalf("created key in own project: status %d, body %s", w.Code, w.Body.String())
+	}
+	createdHeader[ProjectHeader] = "beta"
+	if w := doJSON(t, r, http.MethodGet, "/api/sessions", nil, createdHeader); w.Code != http.StatusForbidden {
+		t.Fatalf("created key in another project: status %d, want 403", w.Code)
+	}
+
+	// 列表只包含本项目的密钥
+	w := doJSON(t, r, http.MethodGet, "/api/api-keys", nil, scoped)
+	var list struct {
+		Data []APIKey `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode api keys: %v", err)
+	}
+	if len(list.Data) != 3 {
+		t.Fatalf("listed %d keys, want 3: %+v", len(list.Data), list.Data)
+	}
+	for _, key := range list.Data {
+		if key.ProjectID != alpha.ID || key.Key != "" {
+			t.Fatalf("listed key %+v", key)
+		}
+	}
+
+	// 只能吊销本项目的密钥
+	var betaKey APIKey
+	if err := db.Where("project_id = ?", beta.ID).First(&betaKey).Error; err != nil {
+		t.Fatalf("find beta key: %v", err)
+	}
+	if w := doJSON(t, r, http.MethodDelete, "/api/api-keys/"+betaKey.ID, nil, scoped); w.Code != http.StatusNotFound {
+		t.Fatalf("delete another project's key: status %d, want 404", w.Code)
+	}
+	if stored, err := getAPIKey(betaKey.ID); err != nil || stored == nil {
+		t.Fatalf("another project's key deleted: %v, %v", stored, err)
+	}
+	if w := doJSON(t, r, http.MethodDelete, "/api/api-keys/"+created.ID, nil, scoped); w.Code != http.StatusOK {
+		t.Fatalf("delete own project's key: status %d, body %s", w.Code, w.Body.String())
+	}
+	if stored, err := getAPIKey(created.ID); err != nil || stored != nil {
+		t.Fatalf("own project's key not deleted: %v, %v", stored, err)
+	}
+}
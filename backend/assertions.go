@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// 检查类型
+const (
+	AssertionContains     = "contains"       // 输出内容包含指定文本
+	AssertionNotContains  = "not_contains"   // 输出内容不包含指定文本
+	AssertionRegex        = "regex"          // 输出内容匹配正则表达式
+	AssertionJSONSchema   = "json_schema"    // 输出内容是合法JSON且符合Schema
+	AssertionToolCalled   = "tool_called"    // 模型调用了指定工具，且参数包含期望的字段
+	AssertionMaxTokens    = "max_tokens"     // 输出token数不超过上限
+	AssertionMaxLatencyMs = "max_latency_ms" // 调用耗时不超过上限（毫秒）
+)
+
+// Assertion 对重放输出的程序化检查
+type Assertion struct {
+	Type       string                 `json:"type" binding:"required"`
+	Name       string                 `json:"name,omitempty"`        // 可选的检查名称，便于识别
+	Value      string                 `json:"value,omitempty"`       // contains/not_contains 的文本，regex 的正则表达式
+	IgnoreCase bool                   `json:"ignore_case,omitempty"` // contains/not_contains/regex 忽略大小写
+	Schema     interface{}            `json:"schema,omitempty"`      // json_schema 的JSON Schema，为空时只检查内容是否为合法JSON
+	ToolName   string                 `json:"tool_name,omitempty"`   // tool_called 期望调用的工具
+	ToolArgs   map[string]interface{} `json:"tool_args,omitempty"`   // tool_called 期望的参数，只比较列出的字段
+	Max        int64                  `json:"max,omitempty"`         // max_tokens 的输出token上限，max_latency_ms 的耗时上限（毫秒）
+}
+
+// assertionOutput 执行检查所需的重放输出
+type assertionOutput struct {
+	Content          string
+	ToolCalls        []openai.ToolCall
+	CompletionTokens int
+	LatencyMs        int64
+}
+
+// validateAssertions 校验检查的参数是否完整
+func validateAssertions(assertions []Assertion) error {
+	for i, assertion := range assertions {
+		var err error
+		switch assertion.Type {
+		case AssertionContains, AssertionNotContains:
+			if assertion.Value == "" {
+				err = fmt.Errorf("value is required")
+			}
+		case AssertionRegex:
+			if assertion.Value == "" {
+				err = fmt.Errorf("value is required")
+			} else if _, compileErr := assertion.compileRegex(); compileErr != nil {
+				err = fmt.Errorf("invalid regex: %v", compileErr)
+			}
+		case AssertionJSONSchema:
+			if _, schemaErr := assertion.schemaDefinition(); schemaErr != nil {
+				err = schemaErr
+			}
+		case AssertionToolCalled:
+			if assertion.ToolName == "" {
+				err = fmt.Errorf("tool_name is required")
+			}
+		case AssertionMaxTokens, AssertionMaxLatencyMs:
+			if assertion.Max < 1 {
+				err = fmt.Errorf("max must be positive")
+			}
+		default:
+			err = fmt.Errorf("unsupported type: %s", assertion.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("assertion %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// compileRegex 编译正则表达式，忽略大小写时添加 (?i) 标志
+func (a Assertion) compileRegex() (*regexp.Regexp, error) {
+	pattern := a.Value
+	if a.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// schemaDefinition 解析检查中的JSON Schema，未设置时返回nil
+func (a Assertion) schemaDefinition() (*jsonschema.Definition, error) {
+	if a.Schema == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(a.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	var schema jsonschema.Definition
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &schema, nil
+}
+
+// stripCodeFence 去掉包裹JSON内容的Markdown代码块
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") || len(content) < 6 {
+		return content
+	}
+	content = strings.TrimSuffix(content[3:], "```")
+	// 去掉代码块的语言标记，例如 ```json
+	if newline := strings.IndexByte(content, '\n'); newline >= 0 && !strings.ContainsAny(content[:newline], "{[\"") {
+		content = content[newline+1:]
+	}
+	return strings.TrimSpace(content)
+}
+
+// matchToolArgs 检查工具参数是否包含所有期望的字段
+func matchToolArgs(arguments string, expected map[string]interface{}) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	parsed, ok := parseToolArguments(arguments).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, value := range expected {
+		actual, exists := parsed[key]
+		if !exists || normalizedJSON(actual) != normalizedJSON(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluate 对输出执行单条检查，返回是否通过和未通过的原因
+func (a Assertion) evaluate(output assertionOutput) (bool, string) {
+	switch a.Type {
+	case AssertionContains, AssertionNotContains:
+		content, value := output.Content, a.Value
+		if a.IgnoreCase {
+			content, value = strings.ToLower(content), strings.ToLower(value)
+		}
+		found := strings.Contains(content, value)
+		if a.Type == AssertionContains && !found {
+			return false, fmt.Sprintf("output does not contain %q", a.Value)
+		}
+		if a.Type == AssertionNotContains && found {
+			return false, fmt.Sprintf("output contains %q", a.Value)
+		}
+		return true, ""
+	case AssertionRegex:
+		re, err := a.compileRegex()
+		if err != nil {
+			return false, fmt.Sprintf("invalid regex: %v", err)
+		}
+		if !re.MatchString(output.Content) {
+			return false, fmt.Sprintf("output does not match %q", a.Value)
+		}
+		return true, ""
+	case AssertionJSONSchema:
+		var data interface{}
+		if err := json.Unmarshal([]byte(stripCodeFence(output.Content)), &data); err != nil {
+			return false, fmt.Sprintf("output is not valid JSON: %v", err)
+		}
+		schema, err := a.schemaDefinition()
+		if err != nil {
+			return false, err.Error()
+		}
+		if schema != nil && !jsonschema.Validate(*schema, data) {
+			return false, "output does not match schema"
+		}
+		return true, ""
+	case AssertionToolCalled:
+		called := false
+		for _, toolCall := range output.ToolCalls {
+			if toolCall.Function.Name != a.ToolName {
+				continue
+			}
+			called = true
+			if matchToolArgs(toolCall.Function.Arguments, a.ToolArgs) {
+				return true, ""
+			}
+		}
+		if called {
+			return false, fmt.Sprintf("tool %s was called without the expected arguments", a.ToolName)
+		}
+		return false, fmt.Sprintf("tool %s was not called", a.ToolName)
+	case AssertionMaxTokens:
+		if int64(output.CompletionTokens) > a.Max {
+			return false, fmt.Sprintf("completion tokens %d exceed %d", output.CompletionTokens, a.Max)
+		}
+		return true, ""
+	case AssertionMaxLatencyMs:
+		if output.LatencyMs > a.Max {
+			return false, fmt.Sprintf("latency %dms exceeds %dms", output.LatencyMs, a.Max)
+		}
+		return true, ""
+	}
+	return false, fmt.Sprintf("unsupported type: %s", a.Type)
+}
+
+// evaluateAssertions 对输出执行全部检查，返回未保存的检查结果
+func evaluateAssertions(assertions []Assertion, output assertionOutput) []AssertionResult {
+	results := make([]AssertionResult, 0, len(assertions))
+	for i, assertion := range assertions {
+		passed, message := assertion.evaluate(output)
+		results = append(results, AssertionResult{
+			ID:        uuid.New().String(),
+			Position:  i,
+			Type:      assertion.Type,
+			Name:      assertion.Name,
+			Assertion: assertion,
+			Passed:    passed,
+			Message:   message,
+		})
+	}
+	return results
+}
+
+// replayChainOutput 汇总工具往返链路的输出：内容取最终记录，工具调用、token和耗时累计整条链路
+func replayChainOutput(record *ReplayRecord) (assertionOutput, error) {
+	final := parseResponseForDiff(record.Response)
+	output := assertionOutput{Content: final.Content}
+
+	var chain []*ReplayRecord
+	current := record
+	for i := 0; current != nil && i <= maxToolRounds; i++ {
+		chain = append(chain, current)
+		if current.ContinuedFromID == "" {
+			break
+		}
+		previous, err := getReplayRecord(current.ContinuedFromID)
+		if err != nil {
+			return output, err
+		}
+		current = previous
+	}
+
+	// 按调用顺序汇总
+	for i := len(chain) - 1; i >= 0; i-- {
+		parsed := parseResponseForDiff(chain[i].Response)
+		output.ToolCalls = append(output.ToolCalls, parsed.ToolCalls...)
+		output.CompletionTokens += parsed.Usage.CompletionTokens
+		output.LatencyMs += chain[i].LatencyMs
+	}
+	return output, nil
+}
+
+// assertReplayRecord 对调试重放的最终记录执行检查并保存结果
+func assertReplayRecord(record *ReplayRecord, assertions []Assertion) error {
+	if len(assertions) == 0 || record.Status != "success" {
+		return nil
+	}
+	output, err := replayChainOutput(record)
+	if err != nil {
+		return err
+	}
+
+	results := evaluateAssertions(assertions, output)
+	for i := range results {
+		results[i].ReplayRecordID = record.ID
+		results[i].ReplaySessionID = record.ReplaySessionID
+	}
+	if err := saveAssertionResults(results); err != nil {
+		return err
+	}
+	record.AssertionResults = results
+	return nil
+}
+
+// assertRecord 对单次重放生成的调用记录执行检查并保存结果
+func assertRecord(record *Record, assertions []Assertion) error {
+	if len(assertions) == 0 || record.Status != "success" {
+		return nil
+	}
+	parsed := parseResponseForDiff(record.Response)
+	output := assertionOutput{
+		Content:          parsed.Content,
+		ToolCalls:        parsed.ToolCalls,
+		CompletionTokens: parsed.Usage.CompletionTokens,
+		LatencyMs:        record.LatencyMs,
+	}
+
+	results := evaluateAssertions(assertions, output)
+	for i := range results {
+		results[i].RecordID = record.ID
+		results[i].SessionID = record.SessionID
+	}
+	if err := saveAssertionResults(results); err != nil {
+		return err
+	}
+	record.AssertionResults = results
+	return nil
+}
+
+// handleGetAssertionResults 查询检查结果（可按记录、会话、类型和是否通过过滤）
+func handleGetAssertionResults(c *gin.Context) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	passed, err := parseBoolQuery(c, "passed")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid filter: " + err.Error(),
+		})
+		return
+	}
+
+	filter := AssertionResultFilter{
+		ProjectID:       currentProjectID(c),
+		ReplayRecordID:  c.Query("replay_record_id"),
+		RecordID:        c.Query("record_id"),
+		ReplaySessionID: c.Query("replay_session_id"),
+		SessionID:       c.Query("session_id"),
+		Type:            c.Query("type"),
+		Passed:          passed,
+	}
+
+	results, err := getAssertionResults(page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get assertion results: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    results,
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// createTestReplaySession 通过接口为原始会话创建重放会话
+func createTestReplaySession(t *testing.T, r *gin.Engine, originalSessionID string, startTurn int) ReplaySession {
+	t.Helper()
+
+	w := doJSON(t, r, http.MethodPost, "/api/replay-sessions", CreateReplaySessionRequest{OriginalSessionID: originalSessionID, StartTurnNumber: startTurn}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create replay session: status %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data ReplaySession `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode replay session: %v", err)
+	}
+	return resp.Data
+}
+
+func TestAssertionResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"{\"answer\":\"Paris\"}"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":5,"total_tokens":8}}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	if err := db.Create(&Session{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"}).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	record := createTestRecord(t, DefaultProjectID, "s1", 1, "capital of France?", "Paris")
+	replaySession := createTestReplaySession(t, r, "s1", 1)
+	request := json.RawMessage(record.Request)
+
+	// 调试重放：结果随重放记录返回
+	w := doJSON(t, r, http.MethodPost, "/api/replay-debug", map[string]interface{}{
+		"replay_session_id": replaySession.ID,
+		"turn_number":       1,
+		"request":           request,
+		"provider":          "stub",
+		"assertions": []Assertion{
+			{Type: AssertionContains, Value: "paris", IgnoreCase: true},
+			{Type: AssertionNotContains, Value: "Paris", Name: "no city"},
+			{Type: AssertionJSONSchema, Schema: map[string]interface{}{"type": "object", "required": []string{"answer"}}},
+			{Type: AssertionMaxTokens, Max: 3},
+		},
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay debug: status %d, body %s", w.Code, w.Body.String())
+	}
+	var debug struct {
+		Data ReplayRecord `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &debug); err != nil {
+		t.Fatalf("decode replay record: %v", err)
+	}
+	var passed []bool
+	for _, result := range debug.Data.AssertionResults {
+		passed = append(passed, result.Passed)
+		if result.ReplayRecordID != debug.Data.ID || result.ReplaySessionID != replaySession.ID {
+			t.Fatalf("assertion result not linked to the replay record: %+v", result)
+		}
+	}
+	if len(passed) != 4 || !passed[0] || passed[1] || !passed[2] || passed[3] {
+		t.Fatalf("replay debug assertion results: %v", passed)
+	}
+	if debug.Data.AssertionResults[1].Name != "no city" || debug.Data.AssertionResults[3].Message == "" {
+		t.Fatalf("replay debug assertion details: %+v", debug.Data.AssertionResults)
+	}
+
+	// 单次重放：结果关联新生成的调用记录
+	w = doJSON(t, r, http.MethodPost, "/api/records/"+record.ID+"/replay", map[string]interface{}{
+		"session_id":  "s1",
+		"turn_number": 2,
+		"request":     request,
+		"provider":    "stub",
+		"assertions": []Assertion{
+			{Type: AssertionRegex, Value: `^\{"answer"`},
+			{Type: AssertionToolCalled, ToolName: "lookup"},
+		},
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay record: status %d, body %s", w.Code, w.Body.String())
+	}
+	var replayed struct {
+		Data Record `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &replayed); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	results := replayed.Data.AssertionResults
+	if len(results) != 2 || !results[0].Passed || results[1].Passed || results[0].RecordID != replayed.Data.ID || results[0].SessionID != "s1" {
+		t.Fatalf("replay record assertion results: %+v", results)
+	}
+
+	// 参数不完整的检查在调用前拒绝
+	invalid := map[string]interface{}{
+		"replay_session_id": replaySession.ID,
+		"turn_number":       1,
+		"request":           request,
+		"provider":          "stub",
+		"assertions":        []Assertion{{Type: AssertionRegex, Value: "("}},
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-debug", invalid, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid regex: status %d, want 400", w.Code)
+	}
+
+	// 查询接口按条件过滤，只返回当前项目的结果
+	cases := []struct {
+		query   string
+		headers map[string]string
+		want    int
+	}{
+		{query: "", want: 6},
+		{query: "?passed=false", want: 3},
+		{query: "?passed=false&replay_session_id=" + replaySession.ID, want: 2},
+		{query: "?replay_record_id=" + debug.Data.ID, want: 4},
+		{query: "?record_id=" + replayed.Data.ID, want: 2},
+		{query: "?session_id=s1&passed=true", want: 1},
+		{query: "?type=" + AssertionJSONSchema, want: 1},
+		{query: "", headers: map[string]string{ProjectHeader: "other"}, want: 0},
+	}
+	for _, tc := range cases {
+		w := doJSON(t, r, http.MethodGet, "/api/assertion-results"+tc.query, nil, tc.headers)
+		var resp struct {
+			Data PaginatedResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode assertion results: %v", err)
+		}
+		if resp.Data.Total != tc.want {
+			t.Errorf("assertion results%s (headers %v): total %d, want %d", tc.query, tc.headers, resp.Data.Total, tc.want)
+		}
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/assertion-results?passed=maybe", nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid passed filter: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// parseRequestMessages 从请求JSON中解析消息列表
+func parseRequestMessages(requestJSON string) ([]openai.ChatCompletionMessage, bool) {
+	var chatReq openai.ChatCompletionRequest
+	if err := json.Unmarshal([]byte(requestJSON), &chatReq); err != nil || len(chatReq.Messages) == 0 {
+		return nil, false
+	}
+	return chatReq.Messages, true
+}
+
+// conversationWithResponse 返回请求消息加上响应中的助手回复
+func conversationWithResponse(requestJSON string, responseJSON string) []openai.ChatCompletionMessage {
+	messages, ok := parseRequestMessages(requestJSON)
+	if !ok {
+		return nil
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(responseJSON), &resp); err == nil && len(resp.Choices) > 0 {
+		messages = append(messages, resp.Choices[0].Message)
+	}
+	return messages
+}
+
+// snapshotBaseContext 计算原始会话在起始轮次之前的对话历史
+// 优先使用起始轮次请求中已有的历史，找不到时使用上一轮的请求和回复
+func snapshotBaseContext(records []Record, startTurnNumber int) []openai.ChatCompletionMessage {
+	var prev, start *Record
+	for i := range records {
+		record := &records[i]
+		if record.TurnNumber < startTurnNumber {
+			prev = record
+		} else if record.TurnNumber == startTurnNumber && start == nil {
+			start = record
+		}
+	}
+
+	if start != nil {
+		if cur, ok := parseRequestMessages(start.Request); ok {
+			var prevMessages []openai.ChatCompletionMessage
+			if prev != nil {
+				prevMessages, _ = parseRequestMessages(prev.Request)
+			}
+
+			// newTurnMessages 返回的是cur的后缀，之前的部分即为历史
+			historyLen := len(cur) - len(newTurnMessages(prevMessages, cur))
+			// 没有历史时保留开头的系统消息
+			for historyLen < len(cur) && cur[historyLen].Role == openai.ChatMessageRoleSystem {
+				historyLen++
+			}
+			return prependMessages(cur[:historyLen], nil)
+		}
+	}
+
+	if prev != nil {
+		return conversationWithResponse(prev.Request, prev.Response)
+	}
+	return nil
+}
+
+// prependMessages 将基础上下文拼接在消息之前，返回新的消息列表
+func prependMessages(base []openai.ChatCompletionMessage, messages []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	combined := make([]openai.ChatCompletionMessage, 0, len(base)+len(messages))
+	combined = append(combined, base...)
+	return append(combined, messages...)
+}
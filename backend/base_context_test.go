@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReplaySessionBaseContext(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	if err := db.Create(&Session{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"}).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	for _, record := range []*Record{
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Status: "success",
+			Request:  `{"model":"m","messages":[{"role":"system","content":"sys"},{"role":"user","content":"u1"}]}`,
+			Response: `{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"a1"},"finish_reason":"stop"}]}`},
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 2, Status: "success",
+			Request:  `{"model":"m","messages":[{"role":"system","content":"sys"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1 as resent"},{"role":"user","content":"u2"}]}`,
+			Response: `{"id":"c2","model":"m","choices":[{"message":{"role":"assistant","content":"a2"},"finish_reason":"stop"}]}`},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create record: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name      string
+		startTurn int
+		want      []string
+	}{
+		{name: "first turn keeps the system prompt", startTurn: 1, want: []string{"system:sys"}},
+		{name: "history as sent in the start turn", startTurn: 2, want: []string{"system:sys", "user:u1", "assistant:a1 as resent"}},
+		{name: "no record at the start turn", startTurn: 3, want: []string{"system:sys", "user:u1", "assistant:a1 as resent", "user:u2", "assistant:a2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			replaySession := createTestReplaySession(t, r, "s1", tc.startTurn)
+			if got := messageContents(replaySession.BaseContext); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("base context = %v, want %v", got, tc.want)
+			}
+			stored, err := getReplaySession(replaySession.ID)
+			if err != nil || stored == nil || !reflect.DeepEqual(messageContents(stored.BaseContext), tc.want) {
+				t.Fatalf("stored replay session: %+v (err %v)", stored, err)
+			}
+		})
+	}
+
+	// 原始会话不存在时不能创建重放会话
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-sessions", CreateReplaySessionRequest{OriginalSessionID: "missing", StartTurnNumber: 1}, nil); w.Code == http.StatusOK {
+		t.Fatalf("replay session for a missing session: status %d", w.Code)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBranchDepth 查找分支树根节点时的最大层数，防止异常数据导致死循环
+const maxBranchDepth = 1000
+
+// findReplaySessionRoot 沿分支来源向上查找根重放会话
+func findReplaySessionRoot(replaySession *ReplaySession) (*ReplaySession, error) {
+	current := replaySession
+	for depth := 0; current.ParentReplaySessionID != "" && depth < maxBranchDepth; depth++ {
+		parent, err := getReplaySession(current.ParentReplaySessionID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			break
+		}
+		current = parent
+	}
+	return current, nil
+}
+
+// buildReplaySessionTree 从根重放会话开始逐层构建分支树
+func buildReplaySessionTree(root *ReplaySession) (*ReplaySessionTreeNode, error) {
+	rootNode := &ReplaySessionTreeNode{ReplaySession: *root, Children: []*ReplaySessionTreeNode{}}
+	nodes := map[string]*ReplaySessionTreeNode{root.ID: rootNode}
+	allIDs := []string{root.ID}
+
+	level := []string{root.ID}
+	for depth := 0; len(level) > 0 && depth < maxBranchDepth; depth++ {
+		children, err := getChildReplaySessions(level)
+		if err != nil {
+			return nil, err
+		}
+
+		level = level[:0]
+		for _, child := range children {
+			if _, exists := nodes[child.ID]; exists {
+				continue
+			}
+			node := &ReplaySessionTreeNode{ReplaySession: child, Children: []*ReplaySessionTreeNode{}}
+			nodes[child.ID] = node
+			nodes[child.ParentReplaySessionID].Children = append(nodes[child.ParentReplaySessionID].Children, node)
+			level = append(level, child.ID)
+			allIDs = append(allIDs, child.ID)
+		}
+	}
+
+	summaries, err := getReplayRecordSummaries(allIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, node := range nodes {
+		node.Records = summaries[id]
+		if node.Records == nil {
+			node.Records = []ReplayRecordSummary{}
+		}
+	}
+
+	return rootNode, nil
+}
+
+// handleForkReplayRecord 从重放记录创建分支重放会话
+func handleForkReplayRecord(c *gin.Context) {
+	recordID := c.Param("id")
+	if recordID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay record ID is required",
+		})
+		return
+	}
+
+	var req ForkReplaySessionRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	parentRecord, err := getReplayRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay record: " + err.Error(),
+		})
+		return
+	}
+
+	if parentRecord == nil {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay record not found",
+		})
+		return
+	}
+
+	parentSession, err := getReplaySession(parentRecord.ReplaySessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	if parentSession == nil || !inCurrentProject(c, parentSession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
+	replaySession, err := forkReplaySession(parentSession, parentRecord, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to fork replay session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    replaySession,
+	})
+}
+
+// handleGetReplaySessionTree 获取重放会话所在的分支树
+func handleGetReplaySessionTree(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay Session ID is required",
+		})
+		return
+	}
+
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
+	root, err := findReplaySessionRoot(replaySession)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to find root replay session: " + err.Error(),
+		})
+		return
+	}
+
+	tree, err := buildReplaySessionTree(root)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to build replay session tree: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tree,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// messageContents 将消息列表转换为「角色:内容」便于比较
+func messageContents(messages []openai.ChatCompletionMessage) []string {
+	contents := make([]string, len(messages))
+	for i, message := range messages {
+		contents[i] = message.Role + ":" + message.Content
+	}
+	return contents
+}
+
+func TestForkedReplaySessionUsesBaseContext(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &req)
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"r%d"},"finish_reason":"stop"}]}`, len(requests))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	if err := db.Create(&Session{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"}).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	records := []*Record{
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Status: "success",
+			Request:  `{"model":"m","messages":[{"role":"system","content":"sys"},{"role":"user","content":"u1"}]}`,
+			Response: `{"id":"c0","model":"m","choices":[{"message":{"role":"assistant","content":"a1"},"finish_reason":"stop"}]}`},
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 2, Status: "success",
+			Request:  `{"model":"m","messages":[{"role":"system","content":"sys"},{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]}`,
+			Response: `{"id":"c0","model":"m","choices":[{"message":{"role":"assistant","content":"a2"},"finish_reason":"stop"}]}`},
+	}
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create record: %v", err)
+		}
+	}
+
+	replayDebug := func(replaySessionID string, turn int, messages string, skipBaseContext bool) ReplayRecord {
+		t.Helper()
+		w := doJSON(t, r, http.MethodPost, "/api/replay-debug", map[string]interface{}{
+			"replay_session_id": replaySessionID,
+			"turn_number":       turn,
+			"request":           json.RawMessage(`{"model":"m","messages":` + messages + `}`),
+			"provider":          "stub",
+			"skip_base_context": skipBaseContext,
+		}, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("replay debug: status %d, body %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data ReplayRecord `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode replay record: %v", err)
+		}
+		return resp.Data
+	}
+	lastSent := func() []string { return messageContents(requests[len(requests)-1].Messages) }
+
+	// 重放会话从第2轮开始，基础上下文为之前的对话历史
+	root := createTestReplaySession(t, r, "s1", 2)
+	if got, want := messageContents(root.BaseContext), []string{"system:sys", "user:u1", "assistant:a1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("root base context = %v, want %v", got, want)
+	}
+	rootRecord := replayDebug(root.ID, 2, `[{"role":"user","content":"u2 edited"}]`, false)
+	if got, want := lastSent(), []string{"system:sys", "user:u1", "assistant:a1", "user:u2 edited"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("root replay sent %v, want %v", got, want)
+	}
+	if rootRecord.OriginalRecordID != records[1].ID {
+		t.Fatalf("root replay original record = %q, want %q", rootRecord.OriginalRecordID, records[1].ID)
+	}
+
+	// 分支的基础上下文为来源重放记录的完整请求和回复
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-records/"+rootRecord.ID+"/fork", nil, map[string]string{ProjectHeader: "other"}); w.Code != http.StatusNotFound {
+		t.Fatalf("fork from another project: status %d, want 404", w.Code)
+	}
+	w := doJSON(t, r, http.MethodPost, "/api/replay-records/"+rootRecord.ID+"/fork", ForkReplaySessionRequest{Name: "try shorter answers"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("fork: status %d, body %s", w.Code, w.Body.String())
+	}
+	var forked struct {
+		Data ReplaySession `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &forked); err != nil {
+		t.Fatalf("decode fork: %v", err)
+	}
+	fork := forked.Data
+	if fork.ParentReplaySessionID != root.ID || fork.ParentReplayRecordID != rootRecord.ID || fork.OriginalSessionID != "s1" || fork.Name != "try shorter answers" {
+		t.Fatalf("fork: %+v", fork)
+	}
+	if got, want := messageContents(fork.BaseContext), []string{"system:sys", "user:u1", "assistant:a1", "user:u2 edited", "assistant:r1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fork base context = %v, want %v", got, want)
+	}
+
+	// 在分支上重放时拼接分支的基础上下文
+	forkRecord := replayDebug(fork.ID, 3, `[{"role":"user","content":"u3"}]`, false)
+	if got, want := lastSent(), []string{"system:sys", "user:u1", "assistant:a1", "user:u2 edited", "assistant:r1", "user:u3"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("fork replay sent %v, want %v", got, want)
+	}
+	if forkRecord.ReplaySessionID != fork.ID {
+		t.Fatalf("fork replay record session = %q, want %q", forkRecord.ReplaySessionID, fork.ID)
+	}
+	replayDebug(fork.ID, 3, `[{"role":"user","content":"only this"}]`, true)
+	if got, want := lastSent(), []string{"user:only this"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("replay without base context sent %v, want %v", got, want)
+	}
+
+	// 从分支查询时返回以根重放会话为起点的整棵树
+	w = doJSON(t, r, http.MethodGet, "/api/replay-sessions/"+fork.ID+"/tree", nil, nil)
+	var tree struct {
+		Data ReplaySessionTreeNode `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tree); err != nil {
+		t.Fatalf("decode tree: %v", err)
+	}
+	if tree.Data.ID != root.ID || len(tree.Data.Records) != 1 || len(tree.Data.Children) != 1 {
+		t.Fatalf("tree root: %+v", tree.Data)
+	}
+	if child := tree.Data.Children[0]; child.ID != fork.ID || len(child.Records) != 2 || len(child.Children) != 0 {
+		t.Fatalf("tree child: %+v", child)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 响应缓存默认值
+const (
+	defaultCacheTTL        = 24 * time.Hour
+	defaultCacheMaxEntries = 1000
+)
+
+// responseCachePolicy 补全默认值后的缓存配置
+func responseCachePolicy() (ttl time.Duration, maxEntries int) {
+	cfg := GetConfig().Cache
+	ttl = time.Duration(cfg.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	maxEntries = cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	return ttl, maxEntries
+}
+
+// responseCacheKey 计算请求的缓存键：provider、模型和规范化请求JSON的SHA-256
+func responseCacheKey(provider string, req openai.ChatCompletionRequest) (string, error) {
+	if key, ok := findProviderKey(provider); ok {
+		provider = key
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %v", err)
+	}
+	// 重新解析为通用结构后再序列化，使嵌套JSON（如工具参数schema）的键按字母排序
+	var normalized interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return "", fmt.Errorf("failed to normalize request: %v", err)
+	}
+	canonical, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to normalize request: %v", err)
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(strings.ToLower(provider)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(req.Model))
+	hash.Write([]byte{0})
+	hash.Write(canonical)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lookupCachedResponse 查找未过期的缓存响应，命中时累加命中次数
+func lookupCachedResponse(key string) (*chatCompletionResult, error) {
+	entry, err := getCachedResponse(key)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(entry.Response), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse cached response: %v", err)
+	}
+	if err := touchCachedResponse(key); err != nil {
+		return nil, err
+	}
+
+	return &chatCompletionResult{
+		Response: resp,
+		Provider: entry.ResponseProvider,
+		Model:    entry.ResponseModel,
+		CacheHit: true,
+	}, nil
+}
+
+// storeCachedResponse 缓存成功的响应，超出条数上限时淘汰最久未命中的条目
+func storeCachedResponse(key string, provider string, model string, result *chatCompletionResult) error {
+	responseJSON, err := json.Marshal(result.Response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %v", err)
+	}
+
+	ttl, maxEntries := responseCachePolicy()
+	now := time.Now()
+	entry := &CachedResponse{
+		CacheKey:         key,
+		Provider:         provider,
+		Model:            model,
+		ResponseProvider: result.Provider,
+		ResponseModel:    result.Model,
+		Response:         string(responseJSON),
+		LastHitAt:        now,
+		ExpiresAt:        now.Add(ttl),
+	}
+	if err := saveCachedResponse(entry); err != nil {
+		return err
+	}
+	return pruneCachedResponses(maxEntries)
+}
+
+// createChatCompletionWithCache 启用缓存时优先返回缓存的响应，未命中时调用provider并缓存成功的响应
+// 缓存读写失败只记录日志，不影响本次调用
+func createChatCompletionWithCache(ctx context.Context, client *openai.Client, provider string, timeout time.Duration, req openai.ChatCompletionRequest, noCache bool) (*chatCompletionResult, error) {
+	if noCache || !GetConfig().Cache.Enabled {
+		return createChatCompletionWithFallback(ctx, client, provider, timeout, req)
+	}
+
+	key, err := responseCacheKey(provider, req)
+	if err != nil {
+		zapLogger.Warn("failed to compute cache key", zap.String("error", err.Error()))
+		return createChatCompletionWithFallback(ctx, client, provider, timeout, req)
+	}
+
+	cached, err := lookupCachedResponse(key)
+	if err != nil {
+		zapLogger.Warn("failed to read response cache", zap.String("cache_key", key), zap.String("error", err.Error()))
+	}
+	if cached != nil {
+		return cached, nil
+	}
+
+	result, err := createChatCompletionWithFallback(ctx, client, provider, timeout, req)
+	if err == nil {
+		if storeErr := storeCachedResponse(key, provider, req.Model, result); storeErr != nil {
+			zapLogger.Warn("failed to write response cache", zap.String("cache_key", key), zap.String("error", storeErr.Error()))
+		}
+	}
+	return result, err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestResponseCacheKey(t *testing.T) {
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"openai": {Name: "OpenAI", APIKey: "test-key", Enabled: true},
+		"local":  {Name: "Local", APIKey: "test-key", Enabled: true},
+	}})
+
+	withTool := func(parameters string) openai.ChatCompletionRequest {
+		req := baseCacheRequest()
+		req.Tools = []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "lookup", Parameters: json.RawMessage(parameters)}}}
+		return req
+	}
+	modify := func(change func(req *openai.ChatCompletionRequest)) openai.ChatCompletionRequest {
+		req := baseCacheRequest()
+		change(&req)
+		return req
+	}
+
+	cases := []struct {
+		name      string
+		provider1 string
+		req1      openai.ChatCompletionRequest
+		provider2 string
+		req2      openai.ChatCompletionRequest
+		wantSame  bool
+	}{
+		{name: "identical requests", provider1: "openai", req1: baseCacheRequest(), provider2: "openai", req2: baseCacheRequest(), wantSame: true},
+		{name: "provider key case", provider1: "openai", req1: baseCacheRequest(), provider2: "OPENAI", req2: baseCacheRequest(), wantSame: true},
+		{name: "provider display name", provider1: "openai", req1: baseCacheRequest(), provider2: "OpenAI", req2: baseCacheRequest(), wantSame: true},
+		{name: "unknown provider case", provider1: "custom", req1: baseCacheRequest(), provider2: "Custom", req2: baseCacheRequest(), wantSame: true},
+		{
+			name:      "tool schema key order",
+			provider1: "openai", req1: withTool(`{"type":"object","properties":{"a":{"type":"string"},"b":{"type":"number"}}}`),
+			provider2: "openai", req2: withTool(`{"properties":{"b":{"type":"number"},"a":{"type":"string"}},"type":"object"}`),
+			wantSame: true,
+		},
+		{name: "different provider", provider1: "openai", req1: baseCacheRequest(), provider2: "local", req2: baseCacheRequest(), wantSame: false},
+		{name: "different model", provider1: "openai", req1: baseCacheRequest(), provider2: "openai", req2: modify(func(req *openai.ChatCompletionRequest) { req.Model = "other" }), wantSame: false},
+		{name: "different temperature", provider1: "openai", req1: baseCacheRequest(), provider2: "openai", req2: modify(func(req *openai.ChatCompletionRequest) { req.Temperature = 0.5 }), wantSame: false},
+		{name: "different message", provider1: "openai", req1: baseCacheRequest(), provider2: "openai", req2: modify(func(req *openai.ChatCompletionRequest) { req.Messages[0].Content = "bye" }), wantSame: false},
+		{
+			name:      "different tool schema",
+			provider1: "openai", req1: withTool(`{"type":"object","properties":{"a":{"type":"string"}}}`),
+			provider2: "openai", req2: withTool(`{"type":"object","properties":{"a":{"type":"number"}}}`),
+			wantSame: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key1, err := responseCacheKey(tc.provider1, tc.req1)
+			if err != nil {
+				t.Fatalf("responseCacheKey: %v", err)
+			}
+			key2, err := responseCacheKey(tc.provider2, tc.req2)
+			if err != nil {
+				t.Fatalf("responseCacheKey: %v", err)
+			}
+			if (key1 == key2) != tc.wantSame {
+				t.Fatalf("keys %s and %s, want same = %v", key1, key2, tc.wantSame)
+			}
+		})
+	}
+}
+
+// baseCacheRequest 缓存键测试使用的请求
+func baseCacheRequest() openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model:    "m",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}
+}
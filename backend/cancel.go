@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplayStatusCancelled 调用被取消的记录状态
+const ReplayStatusCancelled = "cancelled"
+
+// replayCancelRegistry 记录进行中的重放调用，用于按重放会话取消
+type replayCancelRegistry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	entries map[string]map[uint64]context.CancelFunc
+}
+
+var replayCancels = &replayCancelRegistry{entries: make(map[string]map[uint64]context.CancelFunc)}
+
+// register 为重放会话登记一个可取消的上下文，调用结束后需要执行返回的done
+func (r *replayCancelRegistry) register(parent context.Context, replaySessionID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	r.mu.Lock()
+	r.nextID++
+	id := r.nextID
+	if r.entries[replaySessionID] == nil {
+		r.entries[replaySessionID] = make(map[uint64]context.CancelFunc)
+	}
+	r.entries[replaySessionID][id] = cancel
+	r.mu.Unlock()
+
+	done := func() {
+		r.mu.Lock()
+		delete(r.entries[replaySessionID], id)
+		if len(r.entries[replaySessionID]) == 0 {
+			delete(r.entries, replaySessionID)
+		}
+		r.mu.Unlock()
+		cancel()
+	}
+	return ctx, done
+}
+
+// cancel 取消重放会话中所有进行中的调用，返回取消的数量
+func (r *replayCancelRegistry) cancel(replaySessionID string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := 0
+	for _, cancel := range r.entries[replaySessionID] {
+		cancel()
+		count++
+	}
+	return count
+}
+
+// handleCancelReplaySession 取消重放会话中进行中的调用（调试重放、工具结果续跑、全量重放和多模型对比）
+func handleCancelReplaySession(c *gin.Context) {
+	replaySession := loadReplaySession(c)
+	if replaySession == nil {
+		return
+	}
+
+	cancelled := replayCancels.cancel(replaySession.ID)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: CancelReplayResponse{
+			ReplaySessionID: replaySession.ID,
+			Cancelled:       cancelled,
+		},
+	})
+}
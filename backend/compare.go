@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 多模型对比限制
+const (
+	maxCompareTargets  = 20 // 单次对比的最大目标数
+	compareConcurrency = 4  // 同时调用的目标数
+)
+
+// compareResultFromRecord 根据重放记录构造对比结果
+func compareResultFromRecord(index int, replayRecord *ReplayRecord) CompareResult {
+	parsed := parseResponseForDiff(replayRecord.Response)
+	result := CompareResult{
+		Index:          index,
+		Provider:       replayRecord.Provider,
+		Model:          replayRecord.Model,
+		ReplayRecordID: replayRecord.ID,
+		Status:         replayRecord.Status,
+		ErrorMsg:       replayRecord.ErrorMsg,
+		ErrorCategory:  replayRecord.ErrorCategory,
+		LatencyMs:      replayRecord.LatencyMs,
+		CacheHit:       replayRecord.CacheHit,
+	}
+	if replayRecord.Status != "error" {
+		result.Content = parsed.Content
+		result.Usage = parsed.Usage
+	}
+	return result
+}
+
+// runComparison 并发地对多个目标执行同一请求，最多同时调用compareConcurrency个目标，单个目标失败不影响其他目标
+func runComparison(ctx context.Context, replaySessionID string, record *Record, request interface{}, targets []CompareTarget, mutations []RequestMutation, noCache bool, groupID string) []CompareResult {
+	results := make([]CompareResult, len(targets))
+
+	slots := make(chan struct{}, compareConcurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// 被取消后不再启动剩余目标
+		if err := ctx.Err(); err != nil {
+			results[i] = CompareResult{
+				Index:         i,
+				Provider:      target.Provider,
+				Model:         target.Model,
+				Status:        ReplayStatusCancelled,
+				ErrorMsg:      err.Error(),
+				ErrorCategory: ErrorCategoryCancelled,
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, target CompareTarget) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			replayRecord, err := executeReplayDebug(ctx, replaySessionID, record.TurnNumber, request, target.Provider, target.Model, target.Config, replayDebugOptions{
+				OriginalRecordID:  record.ID,
+				ComparisonGroupID: groupID,
+				Timeout:           time.Duration(target.TimeoutSeconds) * time.Second,
+				NoCache:           noCache,
+				Mutations:         mutations,
+			})
+			if replayRecord != nil {
+				results[i] = compareResultFromRecord(i, replayRecord)
+				return
+			}
+
+			// 调用前失败（如provider未配置）时没有重放记录
+			results[i] = CompareResult{
+				Index:         i,
+				Provider:      target.Provider,
+				Model:         target.Model,
+				Status:        "error",
+				ErrorMsg:      fmt.Sprintf("%v", err),
+				ErrorCategory: classifyProviderError(err),
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// handleCompareRecord 将一条记录的请求并发发送到多个provider/model进行对比
+func handleCompareRecord(c *gin.Context) {
+	recordID := c.Param("id")
+	if recordID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Record ID is required",
+		})
+		return
+	}
+
+	var req CompareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.Targets) > maxCompareTargets {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Too many targets: at most %d are allowed", maxCompareTargets),
+		})
+		return
+	}
+
+	for i, target := range req.Targets {
+		if err := target.Config.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("Invalid replay config for target %d: %v", i, err),
+			})
+			return
+		}
+	}
+
+	if err := validateRequestMutations(req.Mutations); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mutations: " + err.Error(),
+		})
+		return
+	}
+
+	record, err := getRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get record: " + err.Error(),
+		})
+		return
+	}
+
+	if record == nil || !inCurrentProject(c, record.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found",
+		})
+		return
+	}
+
+	// 使用指定的重放会话，或为本次对比新建重放会话
+	replaySessionID := req.ReplaySessionID
+	if replaySessionID != "" {
+		replaySession, err := getReplaySession(replaySessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get replay session: " + err.Error(),
+			})
+			return
+		}
+		if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Replay session not found",
+			})
+			return
+		}
+		if replaySession.OriginalSessionID != record.SessionID {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Replay session does not belong to the record's session",
+			})
+			return
+		}
+	} else {
+		name := req.Name
+		if name == "" {
+			name = fmt.Sprintf("多模型对比-轮次%d", record.TurnNumber)
+		}
+		replaySession, err := createReplaySession(record.ProjectID, &CreateReplaySessionRequest{
+			OriginalSessionID: record.SessionID,
+			StartTurnNumber:   record.TurnNumber,
+			Name:              name,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to create replay session: " + err.Error(),
+			})
+			return
+		}
+		replaySessionID = replaySession.ID
+	}
+
+	request := req.Request
+	if request == nil {
+		request = json.RawMessage(record.Request)
+	}
+
+	groupID := uuid.New().String()
+	startTime := time.Now()
+	// 客户端断开或调用取消接口时停止调用
+	ctx, done := replayCancels.register(c.Request.Context(), replaySessionID)
+	defer done()
+	results := runComparison(ctx, replaySessionID, record, request, req.Targets, req.Mutations, req.NoCache, groupID)
+
+	failed := 0
+	for _, result := range results {
+		if result.Status != "success" {
+			failed++
+		}
+	}
+	zapLogger.Info("comparison finished",
+		zap.String("record_id", recordID),
+		zap.String("comparison_group_id", groupID),
+		zap.Int("targets", len(req.Targets)),
+		zap.Int("failed", failed),
+		zap.Duration("duration", time.Since(startTime)))
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: CompareResponse{
+			ComparisonGroupID: groupID,
+			ReplaySessionID:   replaySessionID,
+			RecordID:          recordID,
+			Results:           results,
+		},
+	})
+}
+
+// handleGetComparisonGroup 获取多模型对比分组的结果
+func handleGetComparisonGroup(c *gin.Context) {
+	groupID := c.Param("id")
+	if groupID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Comparison group ID is required",
+		})
+		return
+	}
+
+	replayRecords, err := getComparisonGroupRecords(groupID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get comparison group: " + err.Error(),
+		})
+		return
+	}
+
+	inProject := false
+	if len(replayRecords) > 0 {
+		inProject, err = replayRecordInCurrentProject(c, &replayRecords[0])
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get comparison group: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if !inProject {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Comparison group not found",
+		})
+		return
+	}
+
+	results := make([]CompareResult, 0, len(replayRecords))
+	for i := range replayRecords {
+		results = append(results, compareResultFromRecord(i, &replayRecords[i]))
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: CompareResponse{
+			ComparisonGroupID: groupID,
+			ReplaySessionID:   replayRecords[0].ReplaySessionID,
+			RecordID:          replayRecords[0].OriginalRecordID,
+			Results:           results,
+		},
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCompareRecordBoundsTargetsAndConcurrency(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			current := maxInFlight.Load()
+			if n <= current || maxInFlight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(30 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	if err := db.Create(&Session{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"}).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	record := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1,
+		Request: `{"model":"m","messages":[{"role":"user","content":"hi"}]}`, Status: "success"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	path := "/api/records/" + record.ID + "/compare"
+
+	targets := func(n int) []CompareTarget {
+		list := make([]CompareTarget, n)
+		for i := range list {
+			list[i] = CompareTarget{Provider: "stub", Model: "m"}
+		}
+		return list
+	}
+
+	if w := doJSON(t, r, http.MethodPost, path, CompareRequest{Targets: targets(maxCompareTargets + 1)}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("too many targets: status %d, want 400", w.Code)
+	}
+	if maxInFlight.Load() != 0 {
+		t.Fatalf("provider called for a rejected comparison")
+	}
+
+	// 指定的重放会话必须来自记录所属的会话
+	otherSession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "other", OriginalSessionID: "s2", StartTurnNumber: 1}
+	if err := db.Create(otherSession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+	if w := doJSON(t, r, http.MethodPost, path, CompareRequest{Targets: targets(1), ReplaySessionID: otherSession.ID}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("replay session of another session: status %d, want 400", w.Code)
+	}
+
+	w := doJSON(t, r, http.MethodPost, path, CompareRequest{Targets: targets(10)}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("compare: status %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data CompareResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Data.Results) != 10 {
+		t.Fatalf("got %d results, want 10", len(resp.Data.Results))
+	}
+	for i, result := range resp.Data.Results {
+		if result.Index != i || result.Status != "success" || result.Content != "ok" {
+			t.Fatalf("result %d: %+v", i, result)
+		}
+	}
+	if got := maxInFlight.Load(); got > compareConcurrency {
+		t.Fatalf("%d concurrent provider calls, want at most %d", got, compareConcurrency)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -12,12 +13,15 @@ type Config struct {
 	Database  DatabaseConfig  `mapstructure:"database"`
 	OpenAI    OpenAIConfig    `mapstructure:"openai"`
 	Providers ProvidersConfig `mapstructure:"providers"`
+	Cache     CacheConfig     `mapstructure:"cache"`
+	Auth      AuthConfig      `mapstructure:"auth"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
-	Port int    `mapstructure:"port"`
-	Host string `mapstructure:"host"`
+	Port        int      `mapstructure:"port"`
+	Host        string   `mapstructure:"host"`
+	CORSOrigins []string `mapstructure:"cors_origins"` // 允许跨域访问的来源，为空时允许所有来源
 }
 
 // DatabaseConfig 数据库配置
@@ -31,13 +35,57 @@ type OpenAIConfig struct {
 	APIKey string `mapstructure:"api_key"`
 }
 
+// CacheConfig 重放响应缓存配置
+type CacheConfig struct {
+	Enabled    bool `mapstructure:"enabled"`     // 是否启用缓存，默认关闭
+	TTLSeconds int  `mapstructure:"ttl_seconds"` // 缓存有效期，默认86400
+	MaxEntries int  `mapstructure:"max_entries"` // 最多缓存的响应数，超出时淘汰最久未命中的条目，默认1000
+}
+
+// AuthConfig API密钥和用户登录认证配置
+type AuthConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`           // 是否要求API密钥或登录，默认关闭
+	AdminKey        string `mapstructure:"admin_key"`         // 初始管理员密钥，用于创建其他密钥和第一个用户，可通过环境变量 LLMTRACE_AUTH_ADMIN_KEY 设置
+	SessionTTLHours int    `mapstructure:"session_ttl_hours"` // 登录会话有效期，默认168（7天）
+	CookieSecure    bool   `mapstructure:"cookie_secure"`     // 登录Cookie只通过HTTPS发送，通过HTTPS部署时开启
+}
+
 // ProviderConfig 单个Provider配置
 type ProviderConfig struct {
-	Name    string   `mapstructure:"name"`
-	APIKey  string   `mapstructure:"api_key"`
-	BaseURL string   `mapstructure:"base_url"`
-	Enabled bool     `mapstructure:"enabled"`
-	Models  []string `mapstructure:"models"`
+	Name      string           `mapstructure:"name"`
+	APIKey    string           `mapstructure:"api_key"`
+	BaseURL   string           `mapstructure:"base_url"`
+	Enabled   bool             `mapstructure:"enabled"`
+	Models    []string         `mapstructure:"models"`
+	Retry     RetryConfig      `mapstructure:"retry"`
+	Fallbacks []FallbackConfig `mapstructure:"fallbacks"`  // 调用失败或超时后依次尝试的备用provider
+	RateLimit RateLimitConfig  `mapstructure:"rate_limit"` // 限流与并发控制
+	TimeoutMs int              `mapstructure:"timeout_ms"` // 单次调用超时（含重试），默认120000，请求中的timeout_seconds优先
+}
+
+// RateLimitConfig Provider限流配置，为0的项不限制
+type RateLimitConfig struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute"` // 每分钟请求数
+	TokensPerMinute   int `mapstructure:"tokens_per_minute"`   // 每分钟token数（按请求预估，调用结束后按实际用量修正）
+	MaxInFlight       int `mapstructure:"max_in_flight"`       // 同时进行的调用数
+	QueueTimeoutMs    int `mapstructure:"queue_timeout_ms"`    // 排队等待额度的最长时间，默认30000
+}
+
+// FallbackConfig 备用provider配置
+type FallbackConfig struct {
+	Provider string            `mapstructure:"provider"`
+	Model    string            `mapstructure:"model"`     // 未在model_map中找到时使用的模型，为空时沿用原模型
+	ModelMap map[string]string `mapstructure:"model_map"` // 原模型到备用provider模型的映射
+}
+
+// RetryConfig Provider调用失败时的重试策略，未配置的字段使用默认值
+type RetryConfig struct {
+	MaxAttempts      int     `mapstructure:"max_attempts"`       // 最大尝试次数（含首次），默认3，设为1关闭重试
+	InitialBackoffMs int     `mapstructure:"initial_backoff_ms"` // 首次重试前的等待时间，默认500
+	MaxBackoffMs     int     `mapstructure:"max_backoff_ms"`     // 最长等待时间，默认10000
+	Multiplier       float64 `mapstructure:"multiplier"`         // 指数退避倍数，默认2
+	Jitter           float64 `mapstructure:"jitter"`             // 随机抖动比例（0-1），默认0.2
+	MaxRetryAfterMs  int     `mapstructure:"max_retry_after_ms"` // Retry-After超过该值时不再重试，默认60000
 }
 
 // ProvidersConfig 动态Provider配置
@@ -55,6 +103,7 @@ func loadConfig() (*Config, error) {
 
 	// 设置环境变量前缀
 	viper.SetEnvPrefix("LLMTRACE")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	// 设置默认值
@@ -63,6 +112,10 @@ func loadConfig() (*Config, error) {
 	viper.SetDefault("database.driver", "sqlite")
 	viper.SetDefault("database.dsn", "./data/llmtrace.db")
 	viper.SetDefault("openai.api_key", "")
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.admin_key", "")
+	viper.SetDefault("auth.session_ttl_hours", 168)
+	viper.SetDefault("auth.cookie_secure", false)
 
 	// 读取配置文件
 	if err := viper.ReadInConfig(); err != nil {
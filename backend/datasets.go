@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 按条件挑选记录时的数量限制
+const (
+	defaultDatasetSelectLimit = 100
+	maxDatasetSelectLimit     = 1000
+)
+
+// 数据集导出格式
+const (
+	DatasetExportFormatJSONL = "jsonl"
+	DatasetExportFormatJSON  = "json"
+)
+
+// loadDataset 根据路径参数加载数据集，失败时直接写入错误响应
+func loadDataset(c *gin.Context) *Dataset {
+	datasetID := c.Param("id")
+	if datasetID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Dataset ID is required",
+		})
+		return nil
+	}
+
+	return loadDatasetByID(c, datasetID)
+}
+
+// loadDatasetByID 加载数据集，失败时直接写入错误响应
+func loadDatasetByID(c *gin.Context, datasetID string) *Dataset {
+	dataset, err := getDataset(datasetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset: " + err.Error(),
+		})
+		return nil
+	}
+
+	if dataset == nil || !inCurrentProject(c, dataset.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Dataset not found",
+		})
+		return nil
+	}
+
+	return dataset
+}
+
+// loadDatasetItem 根据路径参数加载数据集条目，失败时直接写入错误响应
+func loadDatasetItem(c *gin.Context) *DatasetItem {
+	itemID := c.Param("id")
+	if itemID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Dataset item ID is required",
+		})
+		return nil
+	}
+
+	item, err := getDatasetItem(itemID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset item: " + err.Error(),
+		})
+		return nil
+	}
+
+	// 条目按所属数据集的项目隔离
+	var dataset *Dataset
+	if item != nil {
+		dataset, err = getDataset(item.DatasetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get dataset: " + err.Error(),
+			})
+			return nil
+		}
+	}
+
+	if item == nil || dataset == nil || !inCurrentProject(c, dataset.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Dataset item not found",
+		})
+		return nil
+	}
+
+	return item
+}
+
+// buildDatasetItem 根据调用记录生成数据集条目，请求无法解析为消息列表时返回false
+func buildDatasetItem(datasetID string, record *Record) (DatasetItem, bool) {
+	messages, ok := parseRequestMessages(record.Request)
+	if !ok {
+		return DatasetItem{}, false
+	}
+
+	item := DatasetItem{
+		ID:              uuid.New().String(),
+		DatasetID:       datasetID,
+		SourceRecordID:  record.ID,
+		SourceSessionID: record.SessionID,
+		TurnNumber:      record.TurnNumber,
+		Request:         record.Request,
+		Input:           messages,
+	}
+
+	// 参考输出取原始响应的助手回复
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(record.Response), &resp); err == nil && len(resp.Choices) > 0 {
+		item.ExpectedOutput = resp.Choices[0].Message.Content
+		item.ExpectedToolCalls = resp.Choices[0].Message.ToolCalls
+	}
+	return item, true
+}
+
+// selectDatasetRecords 按ID和条件挑选项目中的调用记录，missing为不存在（或属于其他项目）的记录ID数量
+func selectDatasetRecords(projectID string, recordIDs []string, filter *DatasetRecordFilter, limit int) ([]Record, int, error) {
+	var records []Record
+	missing := 0
+	if len(recordIDs) > 0 {
+		selected, err := getRecordsByIDs(projectID, recordIDs)
+		if err != nil {
+			return nil, 0, err
+		}
+		missing = len(recordIDs) - len(selected)
+		records = append(records, selected...)
+	}
+
+	if filter != nil {
+		if limit <= 0 {
+			limit = defaultDatasetSelectLimit
+		}
+		if limit > maxDatasetSelectLimit {
+			limit = maxDatasetSelectLimit
+		}
+		matched, err := findRecords(projectID, *filter, limit)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, matched...)
+	}
+	return records, missing, nil
+}
+
+// buildDatasetItems 为调用记录生成数据集条目，跳过existing中已有的记录和请求无法解析的记录
+func buildDatasetItems(datasetID string, records []Record, existing map[string]bool) ([]DatasetItem, int) {
+	items := make([]DatasetItem, 0, len(records))
+	skipped := 0
+	for i := range records {
+		if existing[records[i].ID] {
+			skipped++
+			continue
+		}
+		item, ok := buildDatasetItem(datasetID, &records[i])
+		if !ok {
+			skipped++
+			continue
+		}
+		existing[records[i].ID] = true
+		items = append(items, item)
+	}
+	return items, skipped
+}
+
+// handleCreateDataset 创建数据集
+func handleCreateDataset(c *gin.Context) {
+	var req CreateDatasetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name cannot be empty",
+		})
+		return
+	}
+
+	dataset, err := createDataset(currentProjectID(c), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create dataset: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    dataset,
+	})
+}
+
+// handleGetDatasets 获取数据集列表
+func handleGetDatasets(c *gin.Context) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	result, err := getDatasets(currentProjectID(c), page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get datasets: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleGetDataset 获取单个数据集
+func handleGetDataset(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    dataset,
+	})
+}
+
+// handleUpdateDataset 修改数据集名称或描述
+func handleUpdateDataset(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	var req UpdateDatasetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Name cannot be empty",
+			})
+			return
+		}
+		updates["name"] = name
+	}
+	if req.Description != nil {
+		updates["description"] = *req.Description
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if err := updateDataset(dataset.ID, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update dataset: " + err.Error(),
+		})
+		return
+	}
+
+	dataset, err := getDataset(dataset.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    dataset,
+	})
+}
+
+// handleDeleteDataset 删除数据集
+func handleDeleteDataset(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	if err := deleteDataset(dataset.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete dataset: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Dataset deleted successfully",
+	})
+}
+
+// handleAddDatasetItems 按ID或条件挑选调用记录加入数据集，已加入的记录会被跳过
+func handleAddDatasetItems(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	var req AddDatasetItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if len(req.RecordIDs) == 0 && req.Filter == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Either record_ids or filter is required",
+		})
+		return
+	}
+
+	records, missing, err := selectDatasetRecords(dataset.ProjectID, req.RecordIDs, req.Filter, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get records: " + err.Error(),
+		})
+		return
+	}
+	if missing > 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("%d of %d records not found", missing, len(req.RecordIDs)),
+		})
+		return
+	}
+
+	existing, err := getDatasetSourceRecordIDs(dataset.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset items: " + err.Error(),
+		})
+		return
+	}
+
+	items, skipped := buildDatasetItems(dataset.ID, records, existing)
+
+	if err := createDatasetItems(dataset.ID, items); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to add dataset items: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data: AddDatasetItemsResponse{
+			Added:   len(items),
+			Skipped: skipped,
+			Items:   items,
+		},
+	})
+}
+
+// handleGetDatasetItems 获取数据集条目
+func handleGetDatasetItems(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 200 {
+		size = 50
+	}
+
+	result, err := getDatasetItems(dataset.ID, page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset items: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleUpdateDatasetItem 编辑数据集条目的输入消息或参考输出
+func handleUpdateDatasetItem(c *gin.Context) {
+	item := loadDatasetItem(c)
+	if item == nil {
+		return
+	}
+
+	var req UpdateDatasetItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Input == nil && req.ExpectedOutput == nil && req.ExpectedToolCalls == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Input != nil {
+		if len(req.Input) == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Input cannot be empty",
+			})
+			return
+		}
+		item.Input = req.Input
+	}
+	if req.ExpectedOutput != nil {
+		item.ExpectedOutput = *req.ExpectedOutput
+	}
+	if req.ExpectedToolCalls != nil {
+		item.ExpectedToolCalls = req.ExpectedToolCalls
+	}
+
+	if err := saveDatasetItem(item); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update dataset item: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    item,
+	})
+}
+
+// handleDeleteDatasetItem 删除数据集条目
+func handleDeleteDatasetItem(c *gin.Context) {
+	item := loadDatasetItem(c)
+	if item == nil {
+		return
+	}
+
+	if err := deleteDatasetItem(item.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete dataset item: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Dataset item deleted successfully",
+	})
+}
+
+// handleCreateDatasetVersion 将数据集当前的条目发布为新版本
+func handleCreateDatasetVersion(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	var req CreateDatasetVersionRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	if dataset.ItemCount == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot publish an empty dataset",
+		})
+		return
+	}
+
+	version, err := createDatasetVersion(dataset, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create dataset version: " + err.Error(),
+		})
+		return
+	}
+
+	// 响应中不返回条目快照
+	version.Items = nil
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    version,
+	})
+}
+
+// handleGetDatasetVersions 获取数据集的版本列表
+func handleGetDatasetVersions(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	versions, err := getDatasetVersions(dataset.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset versions: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    versions,
+	})
+}
+
+// exportDatasetItem 生成导出的数据集条目
+func exportDatasetItem(item DatasetItem) DatasetExportItem {
+	exported := DatasetExportItem{
+		ID:                item.ID,
+		Input:             item.Input,
+		ExpectedOutput:    item.ExpectedOutput,
+		ExpectedToolCalls: item.ExpectedToolCalls,
+		SourceRecordID:    item.SourceRecordID,
+		SourceSessionID:   item.SourceSessionID,
+		TurnNumber:        item.TurnNumber,
+	}
+	if json.Valid([]byte(item.Request)) {
+		exported.Request = json.RawMessage(item.Request)
+	}
+	return exported
+}
+
+// handleExportDataset 导出数据集，version 为空时导出当前条目，format 支持 jsonl（默认）和 json
+func handleExportDataset(c *gin.Context) {
+	dataset := loadDataset(c)
+	if dataset == nil {
+		return
+	}
+
+	format := c.DefaultQuery("format", DatasetExportFormatJSONL)
+	if format != DatasetExportFormatJSONL && format != DatasetExportFormatJSON {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Unsupported export format: " + format,
+		})
+		return
+	}
+
+	var items []DatasetItem
+	label := "current"
+	if versionParam := c.Query("version"); versionParam != "" {
+		version, err := strconv.Atoi(versionParam)
+		if err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid version: " + versionParam,
+			})
+			return
+		}
+
+		datasetVersion, err := getDatasetVersion(dataset.ID, version)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get dataset version: " + err.Error(),
+			})
+			return
+		}
+		if datasetVersion == nil {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Dataset version not found",
+			})
+			return
+		}
+		items = datasetVersion.Items
+		label = fmt.Sprintf("v%d", version)
+	} else {
+		var err error
+		items, err = getAllDatasetItems(dataset.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get dataset items: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	exported := make([]DatasetExportItem, len(items))
+	for i, item := range items {
+		exported[i] = exportDatasetItem(item)
+	}
+
+	var body bytes.Buffer
+	contentType := "application/json"
+	if format == DatasetExportFormatJSONL {
+		contentType = "application/x-ndjson"
+		encoder := json.NewEncoder(&body)
+		for _, item := range exported {
+			if err := encoder.Encode(item); err != nil {
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to export dataset: " + err.Error(),
+				})
+				return
+			}
+		}
+	} else if err := json.NewEncoder(&body).Encode(exported); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to export dataset: " + err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("dataset-%s-%s.%s", dataset.ID, label, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
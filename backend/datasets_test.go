@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestRecord 直接在数据库中创建调用记录，响应为助手回复 output
+func createTestRecord(t *testing.T, projectID, sessionID string, turn int, content, output string) *Record {
+	t.Helper()
+
+	record := &Record{
+		ID:         uuid.New().String(),
+		ProjectID:  projectID,
+		SessionID:  sessionID,
+		TurnNumber: turn,
+		Request:    `{"model":"m","messages":[{"role":"user","content":"` + content + `"}]}`,
+		Response:   `{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"` + output + `"},"finish_reason":"stop"}]}`,
+		Status:     "success",
+	}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	return record
+}
+
+func TestDatasetLifecycle(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	first := createTestRecord(t, DefaultProjectID, "s1", 1, "hi", "hello")
+	second := createTestRecord(t, DefaultProjectID, "s1", 2, "bye", "goodbye")
+	invalid := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 3, Request: "not json", Status: "success"}
+	if err := db.Create(invalid).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	foreign := createTestRecord(t, other.ID, "s2", 1, "hi", "hello")
+
+	w := doJSON(t, r, http.MethodPost, "/api/datasets", CreateDatasetRequest{Name: "greetings"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create dataset: status %d, body %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data Dataset `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode dataset: %v", err)
+	}
+	datasetPath := "/api/datasets/" + created.Data.ID
+
+	if w := doJSON(t, r, http.MethodPost, datasetPath+"/versions", nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("publish empty dataset: status %d, want 400", w.Code)
+	}
+
+	// 其他项目的记录不能加入数据集
+	if w := doJSON(t, r, http.MethodPost, datasetPath+"/items", AddDatasetItemsRequest{RecordIDs: []string{foreign.ID}}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("add another project's record: status %d, want 400", w.Code)
+	}
+
+	// 已加入的记录和请求无法解析的记录被跳过
+	addItems := func(req AddDatasetItemsRequest) AddDatasetItemsResponse {
+		w := doJSON(t, r, http.MethodPost, datasetPath+"/items", req, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("add items: status %d, body %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data AddDatasetItemsResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode items: %v", err)
+		}
+		return resp.Data
+	}
+	added := addItems(AddDatasetItemsRequest{RecordIDs: []string{first.ID}})
+	if added.Added != 1 || added.Skipped != 0 || added.Items[0].ExpectedOutput != "hello" {
+		t.Fatalf("add by id: %+v", added)
+	}
+	firstItem := added.Items[0]
+	if added := addItems(AddDatasetItemsRequest{Filter: &DatasetRecordFilter{SessionID: "s1"}}); added.Added != 1 || added.Skipped != 2 {
+		t.Fatalf("add by filter: added %d, skipped %d, want 1 and 2", added.Added, added.Skipped)
+	}
+
+	w = doJSON(t, r, http.MethodPost, datasetPath+"/versions", CreateDatasetVersionRequest{Note: "first"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("publish dataset: status %d, body %s", w.Code, w.Body.String())
+	}
+	var version struct {
+		Data DatasetVersion `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &version); err != nil {
+		t.Fatalf("decode version: %v", err)
+	}
+	if version.Data.Version != 1 || version.Data.ItemCount != 2 || version.Data.Items != nil {
+		t.Fatalf("published version: %+v", version.Data)
+	}
+
+	// 发布后编辑条目不影响已发布的版本
+	edit := map[string]string{"expected_output": "hi there"}
+	if w := doJSON(t, r, http.MethodPatch, "/api/dataset-items/"+firstItem.ID, edit, nil); w.Code != http.StatusOK {
+		t.Fatalf("edit item: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(t, r, http.MethodGet, datasetPath+"/export?version=1", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export version: status %d, body %s", w.Code, w.Body.String())
+	}
+	var exported []DatasetExportItem
+	scanner := bufio.NewScanner(bytes.NewReader(w.Body.Bytes()))
+	for scanner.Scan() {
+		var item DatasetExportItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			t.Fatalf("decode exported line %q: %v", scanner.Text(), err)
+		}
+		exported = append(exported, item)
+	}
+	if len(exported) != 2 || exported[0].SourceRecordID != first.ID || exported[0].ExpectedOutput != "hello" || exported[1].SourceRecordID != second.ID {
+		t.Fatalf("exported version 1: %+v", exported)
+	}
+	if len(exported[0].Input) != 1 || exported[0].Input[0].Content != "hi" || len(exported[0].Request) == 0 {
+		t.Fatalf("exported input: %+v", exported[0])
+	}
+
+	w = doJSON(t, r, http.MethodGet, datasetPath+"/export?format=json", nil, nil)
+	exported = nil
+	if err := json.Unmarshal(w.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("decode current export: %v, body %s", err, w.Body.String())
+	}
+	if len(exported) != 2 || exported[0].ExpectedOutput != "hi there" {
+		t.Fatalf("exported current items: %+v", exported)
+	}
+
+	if w := doJSON(t, r, http.MethodGet, datasetPath+"/export?version=2", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("export missing version: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, datasetPath+"/export?format=csv", nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("export csv: status %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, datasetPath+"/export", nil, map[string]string{ProjectHeader: "other"}); w.Code != http.StatusNotFound {
+		t.Fatalf("export from another project: status %d, want 404", w.Code)
+	}
+}
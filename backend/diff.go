@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// maxDiffCells LCS表的最大规模，超过时退化为整体替换
+const maxDiffCells = 4000000
+
+// parsedResponse 从响应JSON中提取的对比字段
+type parsedResponse struct {
+	Content      string
+	ToolCalls    []openai.ToolCall
+	FinishReason string
+	Usage        TokenUsage
+}
+
+// parseResponseForDiff 解析OpenAI格式的响应，无法解析时返回空内容
+func parseResponseForDiff(responseJSON string) parsedResponse {
+	var resp openai.ChatCompletionResponse
+	if responseJSON == "" || json.Unmarshal([]byte(responseJSON), &resp) != nil {
+		return parsedResponse{}
+	}
+
+	parsed := parsedResponse{
+		Usage: TokenUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		},
+	}
+	if len(resp.Choices) > 0 {
+		parsed.Content = resp.Choices[0].Message.Content
+		parsed.ToolCalls = resp.Choices[0].Message.ToolCalls
+		parsed.FinishReason = string(resp.Choices[0].FinishReason)
+	}
+	return parsed
+}
+
+// tokenizeWords 按词切分文本：连续字母数字为一个词，中日韩字符、标点各自成词，保留空白
+func tokenizeWords(text string) []string {
+	var tokens []string
+	var current []rune
+	currentKind := 0 // 0:无 1:单词 2:空白
+
+	flush := func() {
+		if len(current) > 0 {
+			tokens = append(tokens, string(current))
+			current = current[:0]
+		}
+		currentKind = 0
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if currentKind != 1 {
+				flush()
+				currentKind = 1
+			}
+			current = append(current, r)
+		case unicode.IsSpace(r):
+			if currentKind != 2 {
+				flush()
+				currentKind = 2
+			}
+			current = append(current, r)
+		default:
+			flush()
+			tokens = append(tokens, string(r))
+		}
+	}
+	flush()
+	return tokens
+}
+
+// tokenizeLines 按行切分文本，保留换行符
+func tokenizeLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.SplitAfter(text, "\n")
+}
+
+// diffTokens 基于最长公共子序列计算差异
+func diffTokens(a []string, b []string) []DiffOp {
+	// 去掉公共前缀和后缀以缩小计算规模
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	appendOp := func(op string, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, DiffOp{Op: op, Text: text})
+	}
+
+	appendOp("equal", strings.Join(a[:prefix], ""))
+
+	midA := a[prefix : len(a)-suffix]
+	midB := b[prefix : len(b)-suffix]
+	n, m := len(midA), len(midB)
+
+	if n*m > maxDiffCells {
+		appendOp("delete", strings.Join(midA, ""))
+		appendOp("insert", strings.Join(midB, ""))
+	} else {
+		// lcs[i][j] 表示 midA[i:] 与 midB[j:] 的最长公共子序列长度
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < n && j < m {
+			switch {
+			case midA[i] == midB[j]:
+				appendOp("equal", midA[i])
+				i++
+				j++
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				appendOp("delete", midA[i])
+				i++
+			default:
+				appendOp("insert", midB[j])
+				j++
+			}
+		}
+		for ; i < n; i++ {
+			appendOp("delete", midA[i])
+		}
+		for ; j < m; j++ {
+			appendOp("insert", midB[j])
+		}
+	}
+
+	appendOp("equal", strings.Join(a[len(a)-suffix:], ""))
+	return ops
+}
+
+// contentSimilarity 基于词级差异计算文本相似度，忽略空白
+func contentSimilarity(a string, b string) float64 {
+	ops := diffTokens(tokenizeWords(a), tokenizeWords(b))
+
+	countWords := func(text string) int {
+		count := 0
+		for _, token := range tokenizeWords(text) {
+			if strings.TrimSpace(token) != "" {
+				count++
+			}
+		}
+		return count
+	}
+
+	matched, total := 0, 0
+	for _, op := range ops {
+		words := countWords(op.Text)
+		if op.Op == "equal" {
+			matched += words
+			total += 2 * words
+		} else {
+			total += words
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(2*matched) / float64(total)
+}
+
+// diffJSONValues 递归比较两个JSON值
+func diffJSONValues(path string, a interface{}, b interface{}, out *[]JSONDiffEntry) {
+	mapA, okA := a.(map[string]interface{})
+	mapB, okB := b.(map[string]interface{})
+	if okA && okB {
+		keys := make([]string, 0, len(mapA)+len(mapB))
+		for key := range mapA {
+			keys = append(keys, key)
+		}
+		for key := range mapB {
+			if _, exists := mapA[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			valueA, inA := mapA[key]
+			valueB, inB := mapB[key]
+			childPath := path + "." + key
+			switch {
+			case !inA:
+				*out = append(*out, JSONDiffEntry{Path: childPath, Op: "added", Replay: valueB})
+			case !inB:
+				*out = append(*out, JSONDiffEntry{Path: childPath, Op: "removed", Original: valueA})
+			default:
+				diffJSONValues(childPath, valueA, valueB, out)
+			}
+		}
+		return
+	}
+
+	listA, okA := a.([]interface{})
+	listB, okB := b.([]interface{})
+	if okA && okB {
+		for i := 0; i < len(listA) || i < len(listB); i++ {
+			childPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(listA):
+				*out = append(*out, JSONDiffEntry{Path: childPath, Op: "added", Replay: listB[i]})
+			case i >= len(listB):
+				*out = append(*out, JSONDiffEntry{Path: childPath, Op: "removed", Original: listA[i]})
+			default:
+				diffJSONValues(childPath, listA[i], listB[i], out)
+			}
+		}
+		return
+	}
+
+	if normalizedJSON(a) != normalizedJSON(b) {
+		*out = append(*out, JSONDiffEntry{Path: path, Op: "changed", Original: a, Replay: b})
+	}
+}
+
+// normalizedJSON 将JSON值序列化为规范字符串用于比较
+func normalizedJSON(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(b)
+}
+
+// parseToolArguments 解析工具参数，非JSON时按原始字符串处理
+func parseToolArguments(arguments string) interface{} {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(arguments), &parsed); err != nil {
+		return arguments
+	}
+	return parsed
+}
+
+// diffToolCalls 按顺序配对比较工具调用，并返回工具调用相似度
+func diffToolCalls(original []openai.ToolCall, replay []openai.ToolCall) ([]ToolCallDiff, float64) {
+	count := len(original)
+	if len(replay) > count {
+		count = len(replay)
+	}
+	if count == 0 {
+		return []ToolCallDiff{}, 1
+	}
+
+	diffs := make([]ToolCallDiff, 0, count)
+	score := 0.0
+	for i := 0; i < count; i++ {
+		diff := ToolCallDiff{Index: i}
+		switch {
+		case i >= len(original):
+			diff.Status = "added"
+			diff.ReplayName = replay[i].Function.Name
+		case i >= len(replay):
+			diff.Status = "removed"
+			diff.OriginalName = original[i].Function.Name
+		default:
+			diff.OriginalName = original[i].Function.Name
+			diff.ReplayName = replay[i].Function.Name
+			diff.ArgumentDiff = []JSONDiffEntry{}
+			diffJSONValues("$", parseToolArguments(original[i].Function.Arguments), parseToolArguments(replay[i].Function.Arguments), &diff.ArgumentDiff)
+
+			diff.Status = "changed"
+			if diff.OriginalName == diff.ReplayName {
+				if len(diff.ArgumentDiff) == 0 {
+					diff.Status = "equal"
+					score += 1
+				} else {
+					score += 0.5
+				}
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs, score / float64(count)
+}
+
+// diffRecordResponses 对比原始记录与一条重放记录
+func diffRecordResponses(record *Record, replayRecord *ReplayRecord, granularity string) ResponseDiff {
+	original := parseResponseForDiff(record.Response)
+	replay := parseResponseForDiff(replayRecord.Response)
+
+	var contentDiff []DiffOp
+	if granularity == "line" {
+		contentDiff = diffTokens(tokenizeLines(original.Content), tokenizeLines(replay.Content))
+	} else {
+		contentDiff = diffTokens(tokenizeWords(original.Content), tokenizeWords(replay.Content))
+	}
+	if contentDiff == nil {
+		contentDiff = []DiffOp{}
+	}
+
+	toolCallDiffs, toolSimilarity := diffToolCalls(original.ToolCalls, replay.ToolCalls)
+
+	// 有工具调用时，相似度取文本与工具调用的平均值
+	similarity := contentSimilarity(original.Content, replay.Content)
+	if len(original.ToolCalls) > 0 || len(replay.ToolCalls) > 0 {
+		similarity = (similarity + toolSimilarity) / 2
+	}
+
+	return ResponseDiff{
+		ReplayRecordID: replayRecord.ID,
+		Provider:       replayRecord.Provider,
+		Model:          replayRecord.Model,
+		ReplayContent:  replay.Content,
+		ContentDiff:    contentDiff,
+		ToolCallDiffs:  toolCallDiffs,
+		FinishReason: StringPair{
+			Original: original.FinishReason,
+			Replay:   replay.FinishReason,
+			Equal:    original.FinishReason == replay.FinishReason,
+		},
+		Usage: UsageDiff{
+			Original: original.Usage,
+			Replay:   replay.Usage,
+			Delta: TokenUsage{
+				PromptTokens:     replay.Usage.PromptTokens - original.Usage.PromptTokens,
+				CompletionTokens: replay.Usage.CompletionTokens - original.Usage.CompletionTokens,
+				TotalTokens:      replay.Usage.TotalTokens - original.Usage.TotalTokens,
+			},
+		},
+		Latency: LatencyDiff{
+			OriginalMs: record.LatencyMs,
+			ReplayMs:   replayRecord.LatencyMs,
+			DeltaMs:    replayRecord.LatencyMs - record.LatencyMs,
+		},
+		Similarity: similarity,
+	}
+}
+
+// handleDiffRecord 对比原始记录与重放记录的响应
+func handleDiffRecord(c *gin.Context) {
+	recordID := c.Param("id")
+	if recordID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Record ID is required",
+		})
+		return
+	}
+
+	granularity := c.DefaultQuery("granularity", "word")
+	if granularity != "word" && granularity != "line" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid granularity: " + granularity,
+		})
+		return
+	}
+
+	record, err := getRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get record: " + err.Error(),
+		})
+		return
+	}
+
+	if record == nil || !inCurrentProject(c, record.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found",
+		})
+		return
+	}
+
+	// 未指定重放记录时，对比该记录的全部重放结果
+	var replayRecords []ReplayRecord
+	if ids := c.Query("replay_record_ids"); ids != "" {
+		for _, id := range strings.Split(ids, ",") {
+			id = strings.TrimSpace(id)
+			if id == "" {
+				continue
+			}
+			replayRecord, err := getReplayRecord(id)
+			inProject := false
+			if err == nil && replayRecord != nil {
+				inProject, err = replayRecordInCurrentProject(c, replayRecord)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to get replay record: " + err.Error(),
+				})
+				return
+			}
+			if !inProject {
+				c.JSON(http.StatusNotFound, APIResponse{
+					Success: false,
+					Message: "Replay record not found: " + id,
+				})
+				return
+			}
+			replayRecords = append(replayRecords, *replayRecord)
+		}
+	} else {
+		replayRecords, err = getReplayRecordsByOriginal(recordID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get replay records: " + err.Error(),
+			})
+			return
+		}
+		if len(replayRecords) == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "No replay records reference this record, specify replay_record_ids",
+			})
+			return
+		}
+	}
+
+	result := RecordDiffResult{
+		RecordID:        record.ID,
+		Granularity:     granularity,
+		OriginalContent: parseResponseForDiff(record.Response).Content,
+		Diffs:           make([]ResponseDiff, 0, len(replayRecords)),
+	}
+	for i := range replayRecords {
+		result.Diffs = append(result.Diffs, diffRecordResponses(record, &replayRecords[i], granularity))
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTokenizeWords(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: nil},
+		{text: "hello world", want: []string{"hello", " ", "world"}},
+		{text: "a,  b_c", want: []string{"a", ",", "  ", "b_c"}},
+		{text: "你好 go1", want: []string{"你", "好", " ", "go1"}},
+	}
+	for _, tc := range cases {
+		if got := tokenizeWords(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("tokenizeWords(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestDiffTokens(t *testing.T) {
+	distinct := func(prefix string, n int) []string {
+		tokens := make([]string, n)
+		for i := range tokens {
+			tokens[i] = fmt.Sprintf("%s%d ", prefix, i)
+		}
+		return tokens
+	}
+	large := 2001 // 2001*2001 超过 maxDiffCells
+
+	cases := []struct {
+		name string
+		a    []string
+		b    []string
+		want []DiffOp
+	}{
+		{name: "both empty", a: nil, b: nil, want: nil},
+		{name: "identical", a: tokenizeWords("a b"), b: tokenizeWords("a b"), want: []DiffOp{{"equal", "a b"}}},
+		{name: "insert into empty", a: nil, b: tokenizeWords("new text"), want: []DiffOp{{"insert", "new text"}}},
+		{name: "delete everything", a: tokenizeWords("old"), b: nil, want: []DiffOp{{"delete", "old"}}},
+		{
+			name: "replace a word",
+			a:    tokenizeWords("the cat sat"),
+			b:    tokenizeWords("the dog sat"),
+			want: []DiffOp{{"equal", "the "}, {"delete", "cat"}, {"insert", "dog"}, {"equal", " sat"}},
+		},
+		{
+			name: "insert in the middle",
+			a:    tokenizeWords("a c"),
+			b:    tokenizeWords("a b c"),
+			want: []DiffOp{{"equal", "a "}, {"insert", "b "}, {"equal", "c"}},
+		},
+		{
+			name: "cjk characters",
+			a:    tokenizeWords("你好"),
+			b:    tokenizeWords("你们好"),
+			want: []DiffOp{{"equal", "你"}, {"insert", "们"}, {"equal", "好"}},
+		},
+		{
+			name: "lines",
+			a:    tokenizeLines("a\nb\nc"),
+			b:    tokenizeLines("a\nx\nc"),
+			want: []DiffOp{{"equal", "a\n"}, {"delete", "b\n"}, {"insert", "x\n"}, {"equal", "c"}},
+		},
+		{
+			name: "interleaved changes keep common subsequence",
+			a:    []string{"a", "b", "c", "d"},
+			b:    []string{"b", "x", "d", "y"},
+			want: []DiffOp{{"delete", "a"}, {"equal", "b"}, {"delete", "c"}, {"insert", "x"}, {"equal", "d"}, {"insert", "y"}},
+		},
+		{
+			name: "too large falls back to replace",
+			a:    distinct("a", large),
+			b:    distinct("b", large),
+			want: []DiffOp{{"delete", joinTokens(distinct("a", large))}, {"insert", joinTokens(distinct("b", large))}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := diffTokens(tc.a, tc.b); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("diffTokens = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// joinTokens 拼接词
+func joinTokens(tokens []string) string {
+	text := ""
+	for _, token := range tokens {
+		text += token
+	}
+	return text
+}
+
+func TestContentSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want float64
+	}{
+		{a: "", b: "", want: 1},
+		{a: "same text", b: "same text", want: 1},
+		{a: "same  text", b: "same text", want: 1},
+		{a: "alpha beta", b: "gamma delta", want: 0},
+		{a: "the cat sat", b: "the dog sat", want: 4.0 / 6.0},
+	}
+	for _, tc := range cases {
+		if got := contentSimilarity(tc.a, tc.b); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("contentSimilarity(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestDiffRecordUsesDebugReplaysOfTheRecord(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"the dog sat"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	request := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+	response := `{"choices":[{"message":{"role":"assistant","content":"the cat sat"},"finish_reason":"stop"}]}`
+	var records []*Record
+	for _, sessionID := range []string{"s1", "s2"} {
+		record := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: sessionID, TurnNumber: 1, Request: request, Response: response, Status: "success"}
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create record: %v", err)
+		}
+		records = append(records, record)
+	}
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "r", OriginalSessionID: "s1", StartTurnNumber: 1}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+
+	diffPath := "/api/records/" + records[0].ID + "/diff"
+	if w := doJSON(t, r, http.MethodGet, diffPath, nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("diff without replays: status %d, want 400", w.Code)
+	}
+
+	debugReq := map[string]interface{}{
+		"replay_session_id": replaySession.ID,
+		"turn_number":       1,
+		"request":           json.RawMessage(request),
+		"provider":          "stub",
+	}
+
+	// 指定的原始记录必须属于重放会话的原始会话
+	debugReq["record_id"] = records[1].ID
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-debug", debugReq, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("record of another session: status %d, want 400", w.Code)
+	}
+
+	// 未指定时取原始会话中同一轮次的记录
+	delete(debugReq, "record_id")
+	w := doJSON(t, r, http.MethodPost, "/api/replay-debug", debugReq, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay debug: status %d, body %s", w.Code, w.Body.String())
+	}
+	var debugResp struct {
+		Data ReplayRecord `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &debugResp); err != nil {
+		t.Fatalf("decode replay debug: %v", err)
+	}
+	if debugResp.Data.OriginalRecordID != records[0].ID {
+		t.Fatalf("original_record_id = %q, want %q", debugResp.Data.OriginalRecordID, records[0].ID)
+	}
+
+	w = doJSON(t, r, http.MethodGet, diffPath, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("diff: status %d, body %s", w.Code, w.Body.String())
+	}
+	var diffResp struct {
+		Data RecordDiffResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &diffResp); err != nil {
+		t.Fatalf("decode diff: %v", err)
+	}
+	if len(diffResp.Data.Diffs) != 1 || diffResp.Data.Diffs[0].ReplayRecordID != debugResp.Data.ID || diffResp.Data.Diffs[0].ReplayContent != "the dog sat" {
+		t.Fatalf("unexpected diff result: %+v", diffResp.Data)
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 实验运行默认值
+const (
+	defaultExperimentPassThreshold = 0.8
+	defaultExperimentConcurrency   = 4
+	maxExperimentConcurrency       = 16
+)
+
+// 实验条目对比结论
+const (
+	ExperimentVerdictImproved   = "improved"
+	ExperimentVerdictRegressed  = "regressed"
+	ExperimentVerdictUnchanged  = "unchanged"
+	ExperimentVerdictOnlyBase   = "only_base"
+	ExperimentVerdictOnlyTarget = "only_target"
+)
+
+// loadExperimentRun 根据路径参数加载实验运行，失败时直接写入错误响应
+func loadExperimentRun(c *gin.Context, param string) *ExperimentRun {
+	runID := c.Param(param)
+	if runID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Experiment run ID is required",
+		})
+		return nil
+	}
+
+	run, err := getExperimentRun(runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get experiment run: " + err.Error(),
+		})
+		return nil
+	}
+
+	if run == nil || !inCurrentProject(c, run.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Experiment run not found: " + runID,
+		})
+		return nil
+	}
+
+	return run
+}
+
+// prepareExperimentDataset 确定实验运行使用的数据集版本，失败时直接写入错误响应
+// 未指定数据集时按记录ID或条件挑选记录保存为新数据集；数据集尚未发布时自动发布当前条目
+func prepareExperimentDataset(c *gin.Context, req *CreateExperimentRunRequest, name string) *DatasetVersion {
+	var dataset *Dataset
+	if req.DatasetID != "" {
+		dataset = loadDatasetByID(c, req.DatasetID)
+		if dataset == nil {
+			return nil
+		}
+	} else {
+		if len(req.RecordIDs) == 0 && req.Filter == nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "One of dataset_id, record_ids or filter is required",
+			})
+			return nil
+		}
+
+		records, missing, err := selectDatasetRecords(currentProjectID(c), req.RecordIDs, req.Filter, req.Limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get records: " + err.Error(),
+			})
+			return nil
+		}
+		if missing > 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: fmt.Sprintf("%d of %d records not found", missing, len(req.RecordIDs)),
+			})
+			return nil
+		}
+		if len(records) == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "No records matched",
+			})
+			return nil
+		}
+
+		dataset, err = createDataset(currentProjectID(c), &CreateDatasetRequest{Name: name})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to create dataset: " + err.Error(),
+			})
+			return nil
+		}
+		items, _ := buildDatasetItems(dataset.ID, records, make(map[string]bool))
+		if err := createDatasetItems(dataset.ID, items); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to add dataset items: " + err.Error(),
+			})
+			return nil
+		}
+		dataset.ItemCount = int64(len(items))
+	}
+
+	version := req.DatasetVersion
+	if version == 0 && dataset.Version == 0 {
+		if dataset.ItemCount == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Dataset has no items",
+			})
+			return nil
+		}
+		datasetVersion, err := createDatasetVersion(dataset, "实验运行自动发布")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to create dataset version: " + err.Error(),
+			})
+			return nil
+		}
+		return datasetVersion
+	}
+	if version == 0 {
+		version = dataset.Version
+	}
+
+	datasetVersion, err := getDatasetVersion(dataset.ID, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get dataset version: " + err.Error(),
+		})
+		return nil
+	}
+	if datasetVersion == nil {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Dataset version not found",
+		})
+		return nil
+	}
+	if len(datasetVersion.Items) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Dataset version has no items",
+		})
+		return nil
+	}
+	return datasetVersion
+}
+
+// experimentRequest 根据数据集条目构造请求：沿用来源记录的请求参数，消息替换为条目的输入
+func experimentRequest(item DatasetItem) openai.ChatCompletionRequest {
+	var chatReq openai.ChatCompletionRequest
+	if item.Request != "" {
+		// 来源请求无法解析时只使用条目的输入消息
+		_ = json.Unmarshal([]byte(item.Request), &chatReq)
+	}
+	chatReq.Messages = item.Input
+	return chatReq
+}
+
+// scoreExperimentOutput 计算输出与条目参考输出的相似度，有工具调用时取文本与工具调用的平均值
+func scoreExperimentOutput(item DatasetItem, output parsedResponse) float64 {
+	similarity := contentSimilarity(item.ExpectedOutput, output.Content)
+	if len(item.ExpectedToolCalls) > 0 || len(output.ToolCalls) > 0 {
+		_, toolSimilarity := diffToolCalls(item.ExpectedToolCalls, output.ToolCalls)
+		similarity = (similarity + toolSimilarity) / 2
+	}
+	return similarity
+}
+
+// computeRates 根据条目计数计算通过率和变化率
+func (r *ExperimentRun) computeRates() {
+	r.PassRate, r.ChangeRate = 0, 0
+	if processed := r.CompletedItems + r.FailedItems; processed > 0 {
+		r.PassRate = float64(r.PassedItems) / float64(processed)
+	}
+	if r.CompletedItems > 0 {
+		r.ChangeRate = float64(r.ChangedItems) / float64(r.CompletedItems)
+	}
+}
+
+// progressUpdates 实验运行进度的更新字段
+func (r *ExperimentRun) progressUpdates() map[string]interface{} {
+	return map[string]interface{}{
+		"completed_items": r.CompletedItems,
+		"failed_items":    r.FailedItems,
+		"passed_items":    r.PassedItems,
+		"changed_items":   r.ChangedItems,
+		"pass_rate":       r.PassRate,
+		"change_rate":     r.ChangeRate,
+	}
+}
+
+// runExperimentItem 重放单个数据集条目并评分
+func runExperimentItem(ctx context.Context, run *ExperimentRun, item DatasetItem, req CreateExperimentRunRequest) *ExperimentResult {
+	result := &ExperimentResult{
+		ID:            uuid.New().String(),
+		RunID:         run.ID,
+		DatasetItemID: item.ID,
+		Position:      item.Position,
+	}
+
+	replayRecord, err := executeReplayDebug(ctx, "", item.TurnNumber, experimentRequest(item), run.Provider, run.Model, run.Config, replayDebugOptions{
+		OriginalRecordID: item.SourceRecordID,
+		ExperimentRunID:  run.ID,
+		DatasetItemID:    item.ID,
+		Timeout:          time.Duration(req.TimeoutSeconds) * time.Second,
+		NoCache:          req.NoCache,
+		Mutations:        run.Mutations,
+	})
+	if replayRecord != nil {
+		result.ReplayRecordID = replayRecord.ID
+		result.LatencyMs = replayRecord.LatencyMs
+	}
+	if err != nil {
+		result.Status = "error"
+		if ctx.Err() != nil {
+			result.Status = ReplayStatusCancelled
+		}
+		result.ErrorMsg = err.Error()
+		return result
+	}
+
+	output := parseResponseForDiff(replayRecord.Response)
+	result.Status = "success"
+	result.Output = output.Content
+	result.Similarity = scoreExperimentOutput(item, output)
+	result.Changed = result.Similarity < 1
+	result.Passed = result.Similarity >= run.PassThreshold
+	return result
+}
+
+// runExperiment 并发重放数据集版本中的每个条目，并持续更新运行进度
+func runExperiment(ctx context.Context, run *ExperimentRun, items []DatasetItem, req CreateExperimentRunRequest) {
+	status := "completed"
+	var mu sync.Mutex
+
+	defer func() {
+		if r := recover(); r != nil {
+			zapLogger.Error("experiment run panicked",
+				zap.String("experiment_run_id", run.ID),
+				zap.Any("panic", r))
+			status = "failed"
+		}
+		if ctx.Err() != nil && status == "completed" {
+			status = ReplayStatusCancelled
+		}
+		mu.Lock()
+		updates := run.progressUpdates()
+		mu.Unlock()
+		updates["status"] = status
+		if err := updateExperimentRun(run.ID, updates); err != nil {
+			zapLogger.Error("failed to update experiment run", zap.Error(err))
+		}
+	}()
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultExperimentConcurrency
+	}
+	if concurrency > maxExperimentConcurrency {
+		concurrency = maxExperimentConcurrency
+	}
+
+	startTime := time.Now()
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		// 被取消后不再启动剩余条目
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(item DatasetItem) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result := runExperimentItem(ctx, run, item, req)
+			if err := saveExperimentResult(result); err != nil {
+				zapLogger.Error("failed to save experiment result", zap.Error(err))
+			}
+			if result.Status == ReplayStatusCancelled {
+				return
+			}
+
+			mu.Lock()
+			if result.Status == "success" {
+				run.CompletedItems++
+			} else {
+				run.FailedItems++
+			}
+			if result.Passed {
+				run.PassedItems++
+			}
+			if result.Changed {
+				run.ChangedItems++
+			}
+			run.computeRates()
+			updates := run.progressUpdates()
+			mu.Unlock()
+
+			if err := updateExperimentRun(run.ID, updates); err != nil {
+				zapLogger.Error("failed to update experiment run progress", zap.Error(err))
+			}
+		}(item)
+	}
+	wg.Wait()
+
+	zapLogger.Info("experiment run finished",
+		zap.String("experiment_run_id", run.ID),
+		zap.Int("completed", run.CompletedItems),
+		zap.Int("failed", run.FailedItems),
+		zap.Float64("pass_rate", run.PassRate),
+		zap.Float64("change_rate", run.ChangeRate),
+		zap.Duration("duration", time.Since(startTime)))
+}
+
+// handleCreateExperimentRun 创建实验运行，在后台重放数据集的每个条目
+func handleCreateExperimentRun(c *gin.Context) {
+	var req CreateExperimentRunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	passThreshold := defaultExperimentPassThreshold
+	if req.PassThreshold != nil {
+		passThreshold = *req.PassThreshold
+	}
+	if passThreshold < 0 || passThreshold > 1 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "pass_threshold must be between 0 and 1",
+		})
+		return
+	}
+
+	if err := req.Config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay config: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateRequestMutations(req.Mutations); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mutations: " + err.Error(),
+		})
+		return
+	}
+
+	// 提前检查provider配置，避免创建无法执行的实验运行
+	if _, err := newProviderClient(req.Provider); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = fmt.Sprintf("实验-%s", time.Now().Format("2006-01-02 15:04:05"))
+	}
+
+	datasetVersion := prepareExperimentDataset(c, &req, name)
+	if datasetVersion == nil {
+		return
+	}
+
+	run := &ExperimentRun{
+		ID:             uuid.New().String(),
+		ProjectID:      currentProjectID(c),
+		Name:           name,
+		DatasetID:      datasetVersion.DatasetID,
+		DatasetVersion: datasetVersion.Version,
+		Provider:       req.Provider,
+		Model:          req.Model,
+		Config:         req.Config,
+		Mutations:      req.Mutations,
+		PassThreshold:  passThreshold,
+		Status:         "running",
+		TotalItems:     len(datasetVersion.Items),
+	}
+	if err := createExperimentRun(run); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create experiment run: " + err.Error(),
+		})
+		return
+	}
+
+	// 后台执行，通过查询接口轮询进度，可通过取消接口停止
+	ctx, done := replayCancels.register(context.Background(), run.ID)
+	runCopy := *run
+	go func() {
+		defer done()
+		runExperiment(ctx, &runCopy, datasetVersion.Items, req)
+	}()
+
+	c.JSON(http.StatusAccepted, APIResponse{
+		Success: true,
+		Data:    run,
+	})
+}
+
+// handleGetExperimentRuns 获取实验运行列表（可按数据集和状态过滤）
+func handleGetExperimentRuns(c *gin.Context) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	filter := ExperimentRunFilter{
+		ProjectID: currentProjectID(c),
+		DatasetID: c.Query("dataset_id"),
+		Status:    c.Query("status"),
+	}
+
+	result, err := getExperimentRuns(page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get experiment runs: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleGetExperimentRun 获取实验运行及其进度和汇总指标
+func handleGetExperimentRun(c *gin.Context) {
+	run := loadExperimentRun(c, "id")
+	if run == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    run,
+	})
+}
+
+// parseBoolQuery 解析可选的布尔查询参数
+func parseBoolQuery(c *gin.Context, key string) (*bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", key, value)
+	}
+	return &parsed, nil
+}
+
+// handleGetExperimentResults 获取实验运行的条目结果（可按是否通过、是否变化过滤）
+func handleGetExperimentResults(c *gin.Context) {
+	run := loadExperimentRun(c, "id")
+	if run == nil {
+		return
+	}
+
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 200 {
+		size = 50
+	}
+
+	var filter ExperimentResultFilter
+	var err error
+	if filter.Passed, err = parseBoolQuery(c, "passed"); err == nil {
+		filter.Changed, err = parseBoolQuery(c, "changed")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	result, err := getExperimentResults(run.ID, page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get experiment results: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleCancelExperimentRun 取消进行中的实验运行，未开始的条目不再执行
+func handleCancelExperimentRun(c *gin.Context) {
+	run := loadExperimentRun(c, "id")
+	if run == nil {
+		return
+	}
+
+	if run.Status != "running" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot cancel experiment run in status: " + run.Status,
+		})
+		return
+	}
+
+	replayCancels.cancel(run.ID)
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Experiment run cancelled",
+	})
+}
+
+// handleDeleteExperimentRun 删除实验运行及其结果
+func handleDeleteExperimentRun(c *gin.Context) {
+	run := loadExperimentRun(c, "id")
+	if run == nil {
+		return
+	}
+
+	if run.Status == "running" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot delete a running experiment run",
+		})
+		return
+	}
+
+	if err := deleteExperimentRun(run.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete experiment run: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Experiment run deleted successfully",
+	})
+}
+
+// compareExperimentItem 对比同一数据集条目在两次运行中的结果
+func compareExperimentItem(base *ExperimentResult, target *ExperimentResult) ExperimentItemComparison {
+	comparison := ExperimentItemComparison{Base: base, Target: target}
+	switch {
+	case target == nil:
+		comparison.DatasetItemID = base.DatasetItemID
+		comparison.Position = base.Position
+		comparison.Verdict = ExperimentVerdictOnlyBase
+		return comparison
+	case base == nil:
+		comparison.DatasetItemID = target.DatasetItemID
+		comparison.Position = target.Position
+		comparison.Verdict = ExperimentVerdictOnlyTarget
+		return comparison
+	}
+
+	comparison.DatasetItemID = base.DatasetItemID
+	comparison.Position = base.Position
+	comparison.SimilarityDelta = target.Similarity - base.Similarity
+	if base.Status == "success" && target.Status == "success" {
+		similarity := contentSimilarity(base.Output, target.Output)
+		comparison.OutputSimilarity = &similarity
+	}
+
+	switch {
+	case !base.Passed && target.Passed:
+		comparison.Verdict = ExperimentVerdictImproved
+	case base.Passed && !target.Passed:
+		comparison.Verdict = ExperimentVerdictRegressed
+	default:
+		comparison.Verdict = ExperimentVerdictUnchanged
+	}
+	return comparison
+}
+
+// compareExperimentRuns 按数据集条目逐条对比两次运行
+func compareExperimentRuns(baseRun *ExperimentRun, targetRun *ExperimentRun, baseResults []ExperimentResult, targetResults []ExperimentResult) *ExperimentRunComparison {
+	targetByItem := make(map[string]*ExperimentResult, len(targetResults))
+	for i := range targetResults {
+		targetByItem[targetResults[i].DatasetItemID] = &targetResults[i]
+	}
+
+	comparison := &ExperimentRunComparison{
+		BaseRun:   baseRun,
+		TargetRun: targetRun,
+		Summary: ExperimentComparisonSummary{
+			BasePassRate:     baseRun.PassRate,
+			TargetPassRate:   targetRun.PassRate,
+			PassRateDelta:    targetRun.PassRate - baseRun.PassRate,
+			BaseChangeRate:   baseRun.ChangeRate,
+			TargetChangeRate: targetRun.ChangeRate,
+		},
+		Items: []ExperimentItemComparison{},
+	}
+
+	addItem := func(item ExperimentItemComparison) {
+		switch item.Verdict {
+		case ExperimentVerdictImproved:
+			comparison.Summary.Improved++
+		case ExperimentVerdictRegressed:
+			comparison.Summary.Regressed++
+		case ExperimentVerdictUnchanged:
+			comparison.Summary.Unchanged++
+		case ExperimentVerdictOnlyBase:
+			comparison.Summary.OnlyBase++
+		case ExperimentVerdictOnlyTarget:
+			comparison.Summary.OnlyTarget++
+		}
+		comparison.Items = append(comparison.Items, item)
+	}
+
+	for i := range baseResults {
+		base := &baseResults[i]
+		target := targetByItem[base.DatasetItemID]
+		delete(targetByItem, base.DatasetItemID)
+		addItem(compareExperimentItem(base, target))
+	}
+	// 只在目标运行中出现的条目（例如数据集新版本中新增的条目）
+	for i := range targetResults {
+		if target, ok := targetByItem[targetResults[i].DatasetItemID]; ok {
+			addItem(compareExperimentItem(nil, target))
+		}
+	}
+
+	return comparison
+}
+
+// handleCompareExperimentRuns 逐条对比两次实验运行，判断改动是变好还是变差
+func handleCompareExperimentRuns(c *gin.Context) {
+	baseRun := loadExperimentRun(c, "id")
+	if baseRun == nil {
+		return
+	}
+	targetRun := loadExperimentRun(c, "target_id")
+	if targetRun == nil {
+		return
+	}
+
+	if baseRun.DatasetID != targetRun.DatasetID {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Experiment runs use different datasets",
+		})
+		return
+	}
+
+	baseResults, err := getAllExperimentResults(baseRun.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get experiment results: " + err.Error(),
+		})
+		return
+	}
+	targetResults, err := getAllExperimentResults(targetRun.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get experiment results: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    compareExperimentRuns(baseRun, targetRun, baseResults, targetResults),
+	})
+}
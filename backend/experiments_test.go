@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// waitExperimentRun 轮询实验运行直到结束
+func waitExperimentRun(t *testing.T, r *gin.Engine, runID string) ExperimentRun {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		w := doJSON(t, r, http.MethodGet, "/api/experiment-runs/"+runID, nil, nil)
+		var resp struct {
+			Data ExperimentRun `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode experiment run: %v", err)
+		}
+		if resp.Data.Status != "running" {
+			return resp.Data
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("experiment run %s still running", runID)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExperimentRunAndCompare(t *testing.T) {
+	// model 为 regressed 时 bye 的回复与参考输出不一致
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &req)
+		content := map[string]string{"hi": "hello", "bye": "goodbye"}[req.Messages[len(req.Messages)-1].Content]
+		if req.Model == "regressed" && content == "goodbye" {
+			content = "see you next week"
+		}
+		resp, _ := json.Marshal(openai.ChatCompletionResponse{ID: "c1", Model: req.Model, Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}, FinishReason: openai.FinishReasonStop},
+		}})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resp)
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	first := createTestRecord(t, DefaultProjectID, "s1", 1, "hi", "hello")
+	second := createTestRecord(t, DefaultProjectID, "s1", 2, "bye", "goodbye")
+
+	startRun := func(body map[string]interface{}) ExperimentRun {
+		w := doJSON(t, r, http.MethodPost, "/api/experiment-runs", body, nil)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("create experiment run: status %d, body %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data ExperimentRun `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode experiment run: %v", err)
+		}
+		return waitExperimentRun(t, r, resp.Data.ID)
+	}
+
+	// 按记录ID运行时自动创建并发布数据集
+	base := startRun(map[string]interface{}{"name": "base", "record_ids": []string{first.ID, second.ID}, "provider": "stub", "model": "m", "concurrency": 1})
+	if base.Status != "completed" || base.TotalItems != 2 || base.PassedItems != 2 || base.PassRate != 1 || base.ChangeRate != 0 || base.DatasetVersion != 1 {
+		t.Fatalf("base run: %+v", base)
+	}
+	target := startRun(map[string]interface{}{"name": "target", "dataset_id": base.DatasetID, "provider": "stub", "model": "regressed", "concurrency": 1})
+	if target.Status != "completed" || target.DatasetVersion != 1 || target.PassedItems != 1 || target.ChangedItems != 1 || target.PassRate != 0.5 {
+		t.Fatalf("target run: %+v", target)
+	}
+
+	w := doJSON(t, r, http.MethodGet, "/api/experiment-runs/"+target.ID+"/results?passed=false", nil, nil)
+	var results struct {
+		Data struct {
+			Data []ExperimentResult `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("decode results: %v", err)
+	}
+	if len(results.Data.Data) != 1 || results.Data.Data[0].Output != "see you next week" || !results.Data.Data[0].Changed || results.Data.Data[0].ReplayRecordID == "" {
+		t.Fatalf("failed results: %+v", results.Data.Data)
+	}
+
+	w = doJSON(t, r, http.MethodGet, "/api/experiment-runs/"+base.ID+"/compare/"+target.ID, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("compare: status %d, body %s", w.Code, w.Body.String())
+	}
+	var comparison struct {
+		Data ExperimentRunComparison `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &comparison); err != nil {
+		t.Fatalf("decode comparison: %v", err)
+	}
+	summary := comparison.Data.Summary
+	if summary.Regressed != 1 || summary.Unchanged != 1 || summary.Improved != 0 || summary.PassRateDelta != -0.5 {
+		t.Fatalf("comparison summary: %+v", summary)
+	}
+	verdicts := map[string]string{}
+	for _, item := range comparison.Data.Items {
+		verdicts[item.Base.Output] = item.Verdict
+	}
+	if verdicts["hello"] != ExperimentVerdictUnchanged || verdicts["goodbye"] != ExperimentVerdictRegressed {
+		t.Fatalf("comparison verdicts: %v", verdicts)
+	}
+
+	// 不同数据集的运行不能对比，其他项目看不到运行
+	unrelated := startRun(map[string]interface{}{"record_ids": []string{first.ID}, "provider": "stub", "concurrency": 1})
+	if w := doJSON(t, r, http.MethodGet, "/api/experiment-runs/"+base.ID+"/compare/"+unrelated.ID, nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("compare runs on different datasets: status %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/experiment-runs/"+base.ID+"/compare/"+target.ID, nil, map[string]string{ProjectHeader: "other"}); w.Code != http.StatusNotFound {
+		t.Fatalf("compare from another project: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// providerTarget 调用链中的provider和模型
+type providerTarget struct {
+	Provider string
+	Model    string
+}
+
+// mapModel 将原模型映射为备用provider的模型
+func (f FallbackConfig) mapModel(model string) string {
+	// viper会将map的键转为小写
+	if mapped, ok := f.ModelMap[strings.ToLower(model)]; ok {
+		return mapped
+	}
+	if f.Model != "" {
+		return f.Model
+	}
+	return model
+}
+
+// resolveProviderChain 返回主provider及其备用provider组成的调用链
+// 只展开主provider的备用配置，不会递归展开备用provider自身的备用配置
+func resolveProviderChain(provider string, model string) []providerTarget {
+	chain := []providerTarget{{Provider: provider, Model: model}}
+	providerConfig, ok := findProviderConfig(provider)
+	if !ok {
+		return chain
+	}
+	for _, fallback := range providerConfig.Fallbacks {
+		chain = append(chain, providerTarget{Provider: fallback.Provider, Model: fallback.mapModel(model)})
+	}
+	return chain
+}
+
+// chatCompletionResult 调用链的执行结果
+type chatCompletionResult struct {
+	Response       openai.ChatCompletionResponse
+	Provider       string            // 最后一次调用（成功时即实际提供服务）的provider
+	Model          string            // 最后一次调用使用的模型
+	Attempts       int               // 最后一个provider的尝试次数（含重试）
+	QueueWait      time.Duration     // 所有provider上等待限流额度的总时间
+	FailedAttempts []ProviderAttempt // 之前失败的provider调用
+	CacheHit       bool              // 响应来自缓存，没有调用provider
+}
+
+// providerTimeout 确定单个provider的调用超时：请求指定 > provider配置 > 默认值
+func providerTimeout(provider string, override time.Duration) time.Duration {
+	if override > 0 {
+		return override
+	}
+	if providerConfig, ok := findProviderConfig(provider); ok && providerConfig.TimeoutMs > 0 {
+		return time.Duration(providerConfig.TimeoutMs) * time.Millisecond
+	}
+	return defaultReplayTimeout
+}
+
+// createChatCompletionWithFallback 依次调用链中的provider直到成功，每个provider单独计算超时并按自身策略重试
+// ctx被取消时立即停止，不再回退
+func createChatCompletionWithFallback(ctx context.Context, client *openai.Client, provider string, timeout time.Duration, req openai.ChatCompletionRequest) (*chatCompletionResult, error) {
+	chain := resolveProviderChain(provider, req.Model)
+	result := &chatCompletionResult{}
+
+	var err error
+	for i, target := range chain {
+		req.Model = target.Model
+		result.Provider = target.Provider
+		result.Model = target.Model
+		result.Attempts = 0
+
+		callStart := time.Now()
+		if i > 0 {
+			client, err = newProviderClient(target.Provider)
+		}
+		if err == nil {
+			callCtx, cancel := context.WithTimeout(ctx, providerTimeout(target.Provider, timeout))
+			var stats callStats
+			result.Response, stats, err = createChatCompletionWithRetry(callCtx, client, target.Provider, providerRetryPolicy(target.Provider), req)
+			cancel()
+			result.Attempts = stats.Attempts
+			result.QueueWait += stats.QueueWait
+			if err == nil {
+				return result, nil
+			}
+		}
+
+		// 最后一个provider的失败或取消作为本次调用的错误返回
+		if i == len(chain)-1 || ctx.Err() != nil {
+			break
+		}
+
+		category := classifyProviderError(err)
+		result.FailedAttempts = append(result.FailedAttempts, ProviderAttempt{
+			Provider:      target.Provider,
+			Model:         target.Model,
+			Attempts:      result.Attempts,
+			ErrorCategory: category,
+			ErrorMsg:      err.Error(),
+			LatencyMs:     time.Since(callStart).Milliseconds(),
+		})
+		zapLogger.Warn("provider failed, falling back",
+			zap.String("provider", target.Provider),
+			zap.String("model", target.Model),
+			zap.String("fallback_provider", chain[i+1].Provider),
+			zap.String("fallback_model", chain[i+1].Model),
+			zap.String("error_category", category),
+			zap.String("error", err.Error()))
+	}
+
+	return result, err
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 反馈评价
+const (
+	FeedbackRatingGood = "good"
+	FeedbackRatingBad  = "bad"
+)
+
+// 反馈来源
+const (
+	FeedbackSourceReviewer = "reviewer" // 评审人员
+	FeedbackSourceEndUser  = "end_user" // 应用上报的终端用户反馈
+)
+
+// 反馈分数范围
+const (
+	minFeedbackScore = 1
+	maxFeedbackScore = 5
+)
+
+// validateFeedbackScore 检查分数是否在允许范围内，未设置分数时不检查
+func validateFeedbackScore(score *float64) error {
+	if score != nil && (*score < minFeedbackScore || *score > maxFeedbackScore) {
+		return fmt.Errorf("score must be between %d and %d", minFeedbackScore, maxFeedbackScore)
+	}
+	return nil
+}
+
+// normalizeFeedbackRating 规范化评价，up/down 分别视为 good/bad
+func normalizeFeedbackRating(rating string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(rating)) {
+	case "":
+		return "", nil
+	case FeedbackRatingGood, "up":
+		return FeedbackRatingGood, nil
+	case FeedbackRatingBad, "down":
+		return FeedbackRatingBad, nil
+	}
+	return "", fmt.Errorf("invalid rating: %s", rating)
+}
+
+// requestModel 提取请求JSON中的模型名称
+func requestModel(requestJSON string) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// bindReviewerFeedback 解析评审人员提交的反馈，失败时直接写入错误响应
+// 登录用户提交时作者固定为其用户名，忽略请求中的 author
+func bindReviewerFeedback(c *gin.Context) *Feedback {
+	var req CreateFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return nil
+	}
+
+	author := strings.TrimSpace(req.Author)
+	if user := currentUser(c); user != nil {
+		author = user.Username
+	}
+	if author == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Author is required",
+		})
+		return nil
+	}
+
+	rating, err := normalizeFeedbackRating(req.Rating)
+	if err == nil {
+		err = validateFeedbackScore(req.Score)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return nil
+	}
+
+	if rating == "" && req.Score == nil && req.Correction == "" && req.Comment == "" && len(req.Labels) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Feedback is empty",
+		})
+		return nil
+	}
+
+	return &Feedback{
+		ID:         uuid.New().String(),
+		Source:     FeedbackSourceReviewer,
+		Author:     author,
+		Rating:     rating,
+		Score:      req.Score,
+		Correction: req.Correction,
+		Comment:    req.Comment,
+		Labels:     req.Labels,
+	}
+}
+
+// respondCreatedFeedback 保存反馈并返回，反馈归属于调用方的项目
+func respondCreatedFeedback(c *gin.Context, feedback *Feedback) {
+	feedback.ProjectID = currentProjectID(c)
+	if err := createFeedback(feedback); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create feedback: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    feedback,
+	})
+}
+
+// respondFeedbackList 按过滤条件分页返回反馈
+func respondFeedbackList(c *gin.Context, filter FeedbackFilter) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	result, err := getFeedbackList(page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get feedback: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// feedbackFilterFromQuery 从查询参数解析反馈过滤条件
+func feedbackFilterFromQuery(c *gin.Context) (FeedbackFilter, error) {
+	rating, err := normalizeFeedbackRating(c.Query("rating"))
+	if err != nil {
+		return FeedbackFilter{}, err
+	}
+	return FeedbackFilter{
+		ProjectID:      currentProjectID(c),
+		RecordID:       c.Query("record_id"),
+		ReplayRecordID: c.Query("replay_record_id"),
+		SessionID:      c.Query("session_id"),
+		Model:          c.Query("model"),
+		Source:         c.Query("source"),
+		Author:         c.Query("author"),
+		Rating:         rating,
+		Label:          c.Query("label"),
+	}, nil
+}
+
+// loadRecordParam 根据路径参数加载调用记录，失败时直接写入错误响应
+func loadRecordParam(c *gin.Context) *Record {
+	recordID := c.Param("id")
+	if recordID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Record ID is required",
+		})
+		return nil
+	}
+
+	record, err := getRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get record: " + err.Error(),
+		})
+		return nil
+	}
+
+	if record == nil || !inCurrentProject(c, record.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found",
+		})
+		return nil
+	}
+
+	return record
+}
+
+// loadReplayRecordParam 根据路径参数加载重放记录，失败时直接写入错误响应
+func loadReplayRecordParam(c *gin.Context) *ReplayRecord {
+	recordID := c.Param("id")
+	if recordID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay record ID is required",
+		})
+		return nil
+	}
+
+	record, err := getReplayRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay record: " + err.Error(),
+		})
+		return nil
+	}
+
+	inProject := false
+	if record != nil {
+		inProject, err = replayRecordInCurrentProject(c, record)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get replay record: " + err.Error(),
+			})
+			return nil
+		}
+	}
+
+	if !inProject {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay record not found",
+		})
+		return nil
+	}
+
+	return record
+}
+
+// handleCreateRecordFeedback 评审人员对调用记录提交反馈
+func handleCreateRecordFeedback(c *gin.Context) {
+	record := loadRecordParam(c)
+	if record == nil {
+		return
+	}
+
+	feedback := bindReviewerFeedback(c)
+	if feedback == nil {
+		return
+	}
+	feedback.RecordID = record.ID
+	feedback.SessionID = record.SessionID
+	feedback.TurnNumber = record.TurnNumber
+	feedback.Model = requestModel(record.Request)
+
+	respondCreatedFeedback(c, feedback)
+}
+
+// handleGetRecordFeedback 获取调用记录的反馈
+func handleGetRecordFeedback(c *gin.Context) {
+	record := loadRecordParam(c)
+	if record == nil {
+		return
+	}
+
+	respondFeedbackList(c, FeedbackFilter{RecordID: record.ID})
+}
+
+// handleCreateReplayRecordFeedback 评审人员对重放记录提交反馈
+func handleCreateReplayRecordFeedback(c *gin.Context) {
+	record := loadReplayRecordParam(c)
+	if record == nil {
+		return
+	}
+
+	feedback := bindReviewerFeedback(c)
+	if feedback == nil {
+		return
+	}
+	feedback.ReplayRecordID = record.ID
+	feedback.ReplaySessionID = record.ReplaySessionID
+	feedback.TurnNumber = record.TurnNumber
+	feedback.Model = record.Model
+
+	respondCreatedFeedback(c, feedback)
+}
+
+// handleGetReplayRecordFeedback 获取重放记录的反馈
+func handleGetReplayRecordFeedback(c *gin.Context) {
+	record := loadReplayRecordParam(c)
+	if record == nil {
+		return
+	}
+
+	respondFeedbackList(c, FeedbackFilter{ReplayRecordID: record.ID})
+}
+
+// handleIngestFeedback 接收应用上报的终端用户反馈，关联会话中该轮次最新的调用记录
+// 调用记录尚未上报时仍保存反馈，按会话汇总时同样计入
+func handleIngestFeedback(c *gin.Context) {
+	var req IngestFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rating, err := normalizeFeedbackRating(req.Rating)
+	if err != nil || rating == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid rating: " + req.Rating,
+		})
+		return
+	}
+
+	if err := validateFeedbackScore(req.Score); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 会话已存在于其他项目时拒绝，会话尚未上报时反馈归属于调用方的项目
+	session, err := getSession(req.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session: " + err.Error(),
+		})
+		return
+	}
+	if session != nil && !inCurrentProject(c, session.ProjectID) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid feedback: " + errSessionProjectMismatch.Error(),
+		})
+		return
+	}
+
+	feedback := &Feedback{
+		ID:         uuid.New().String(),
+		SessionID:  req.SessionID,
+		TurnNumber: req.TurnNumber,
+		Source:     FeedbackSourceEndUser,
+		Author:     req.UserID,
+		Rating:     rating,
+		Score:      req.Score,
+		Comment:    req.Comment,
+		Labels:     req.Labels,
+	}
+
+	record, err := findSessionTurnRecord(req.SessionID, req.TurnNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get record: " + err.Error(),
+		})
+		return
+	}
+	if record != nil {
+		feedback.RecordID = record.ID
+		feedback.Model = requestModel(record.Request)
+	}
+
+	respondCreatedFeedback(c, feedback)
+}
+
+// handleGetFeedback 查询反馈（可按记录、会话、模型、来源、作者、评价和标签过滤）
+func handleGetFeedback(c *gin.Context) {
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid filter: " + err.Error(),
+		})
+		return
+	}
+
+	respondFeedbackList(c, filter)
+}
+
+// handleGetFeedbackSummary 按会话或模型汇总反馈
+func handleGetFeedbackSummary(c *gin.Context) {
+	var column string
+	switch groupBy := c.DefaultQuery("group_by", "session"); groupBy {
+	case "session":
+		column = "session_id"
+	case "model":
+		column = "model"
+	default:
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid group_by: " + groupBy,
+		})
+		return
+	}
+
+	filter, err := feedbackFilterFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid filter: " + err.Error(),
+		})
+		return
+	}
+
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	result, err := getFeedbackSummary(column, page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get feedback summary: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleUpdateFeedback 修改反馈（只更新传入的字段）
+func handleUpdateFeedback(c *gin.Context) {
+	feedbackID := c.Param("id")
+	if feedbackID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Feedback ID is required",
+		})
+		return
+	}
+
+	var req UpdateFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Rating == nil && req.Score == nil && req.Correction == nil && req.Comment == nil && req.Labels == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if err := validateFeedbackScore(req.Score); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	feedback, err := getFeedback(feedbackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get feedback: " + err.Error(),
+		})
+		return
+	}
+
+	if feedback == nil || !inCurrentProject(c, feedback.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Feedback not found",
+		})
+		return
+	}
+
+	if req.Rating != nil {
+		rating, err := normalizeFeedbackRating(*req.Rating)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		feedback.Rating = rating
+	}
+	if req.Score != nil {
+		feedback.Score = req.Score
+	}
+	if req.Correction != nil {
+		feedback.Correction = *req.Correction
+	}
+	if req.Comment != nil {
+		feedback.Comment = *req.Comment
+	}
+	if req.Labels != nil {
+		feedback.Labels = req.Labels
+	}
+
+	if err := saveFeedback(feedback); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update feedback: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    feedback,
+	})
+}
+
+// handleDeleteFeedback 删除反馈
+func handleDeleteFeedback(c *gin.Context) {
+	feedbackID := c.Param("id")
+	if feedbackID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Feedback ID is required",
+		})
+		return
+	}
+
+	feedback, err := getFeedback(feedbackID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get feedback: " + err.Error(),
+		})
+		return
+	}
+
+	if feedback == nil || !inCurrentProject(c, feedback.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Feedback not found",
+		})
+		return
+	}
+
+	if err := deleteFeedback(feedbackID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete feedback: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Feedback deleted successfully",
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReviewerFeedbackAuthorAndScore(t *testing.T) {
+	setupTestEnv(t, &Config{Auth: AuthConfig{Enabled: true}})
+	r := newTestRouter()
+
+	passwordHash, err := hashPassword("password-alice")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if err := createUser(&User{ID: uuid.New().String(), Username: "alice", PasswordHash: passwordHash, Role: RoleDebugger}); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+	record := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Request: `{"model":"m"}`, Status: "success"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/api/auth/login", LoginRequest{Username: "alice", Password: "password-alice"}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", w.Code, w.Body.String())
+	}
+	var cookie string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == LoginCookieName {
+			cookie = c.Name + "=" + c.Value
+		}
+	}
+	loggedIn := map[string]string{"Cookie": cookie}
+	apiKey := map[string]string{APIKeyHeader: createTestAPIKey(t, ScopeDebug, "")}
+	ingestKey := map[string]string{APIKeyHeader: createTestAPIKey(t, ScopeIngest, "")}
+	path := "/api/records/" + record.ID + "/feedback"
+
+	// 登录用户提交时作者为其用户名，请求中的 author 被忽略
+	w = doJSON(t, r, http.MethodPost, path, map[string]interface{}{"author": "bob", "rating": "good"}, loggedIn)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create as logged-in user: status %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data Feedback `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode feedback: %v", err)
+	}
+	if resp.Data.Author != "alice" {
+		t.Fatalf("author = %q, want alice", resp.Data.Author)
+	}
+	if w := doJSON(t, r, http.MethodPost, path, map[string]interface{}{"rating": "good"}, loggedIn); w.Code != http.StatusOK {
+		t.Fatalf("create as logged-in user without author: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	// 使用API密钥提交时 author 必填
+	if w := doJSON(t, r, http.MethodPost, path, map[string]interface{}{"rating": "good"}, apiKey); w.Code != http.StatusBadRequest {
+		t.Fatalf("create with API key without author: status %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, path, map[string]interface{}{"author": "bob", "rating": "good"}, apiKey); w.Code != http.StatusOK {
+		t.Fatalf("create with API key: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	// 分数超出范围时拒绝
+	for _, score := range []float64{minFeedbackScore - 0.5, maxFeedbackScore + 1} {
+		if w := doJSON(t, r, http.MethodPost, path, map[string]interface{}{"score": score}, loggedIn); w.Code != http.StatusBadRequest {
+			t.Errorf("create with score %v: status %d, want 400", score, w.Code)
+		}
+		if w := doJSON(t, r, http.MethodPatch, "/api/feedback/"+resp.Data.ID, map[string]interface{}{"score": score}, loggedIn); w.Code != http.StatusBadRequest {
+			t.Errorf("update with score %v: status %d, want 400", score, w.Code)
+		}
+		ingest := map[string]interface{}{"session_id": "s1", "turn_number": 1, "rating": "up", "score": score}
+		if w := doJSON(t, r, http.MethodPost, "/api/feedback", ingest, ingestKey); w.Code != http.StatusBadRequest {
+			t.Errorf("ingest with score %v: status %d, want 400", score, w.Code)
+		}
+	}
+	for _, score := range []float64{minFeedbackScore, maxFeedbackScore} {
+		if w := doJSON(t, r, http.MethodPost, path, map[string]interface{}{"score": score}, loggedIn); w.Code != http.StatusOK {
+			t.Errorf("create with score %v: status %d, body %s", score, w.Code, w.Body.String())
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -37,8 +38,43 @@ func handleTrace(c *gin.Context) {
 		return
 	}
 
+	// 请求体中的 project 优先于请求头指定的项目
+	trace.ProjectID = currentProjectID(c)
+	if ref := strings.TrimSpace(trace.Project); ref != "" {
+		project, err := resolveProject(ref)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get project: " + err.Error(),
+			})
+			return
+		}
+		if project == nil {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Project not found: " + ref,
+			})
+			return
+		}
+		if !keyAllowsProject(c, project.ID) {
+			c.JSON(http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "API key cannot access project: " + ref,
+			})
+			return
+		}
+		trace.ProjectID = project.ID
+	}
+
 	// 保存埋点数据
-	if err := saveTraceData(&trace); err != nil {
+	if _, err := saveTraceData(&trace); err != nil {
+		if errors.Is(err, errSessionProjectMismatch) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Failed to save trace data: " + err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
 			Message: "Failed to save trace data: " + err.Error(),
@@ -65,8 +101,28 @@ func handleGetSessions(c *gin.Context) {
 		size = 20
 	}
 
+	attributes, err := parseAttributeQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid filter: " + err.Error(),
+		})
+		return
+	}
+
+	filter := SessionFilter{
+		ProjectID:   currentProjectID(c),
+		Name:        c.Query("name"),
+		UserID:      c.Query("user_id"),
+		AppName:     c.Query("app_name"),
+		Environment: c.Query("environment"),
+		Version:     c.Query("version"),
+		Attributes:  attributes,
+		Tags:        parseTagQuery(c),
+	}
+
 	// 获取会话列表
-	result, err := getSessions(page, size)
+	result, err := getSessions(page, size, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -81,6 +137,116 @@ func handleGetSessions(c *gin.Context) {
 	})
 }
 
+// parseAttributeQuery 解析 attr=键:值 形式的会话属性过滤参数，可重复传入
+func parseAttributeQuery(c *gin.Context) (map[string]string, error) {
+	attributes := make(map[string]string)
+	for _, value := range c.QueryArray("attr") {
+		key, attrValue, found := strings.Cut(value, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("attr must be in key:value format: %s", value)
+		}
+		if strings.Contains(key, `"`) {
+			return nil, fmt.Errorf("attr key cannot contain double quotes: %s", key)
+		}
+		attributes[key] = attrValue
+	}
+	return attributes, nil
+}
+
+// handleUpdateSession 修改会话名称和会话级字段（只更新传入的字段）
+func handleUpdateSession(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Session ID is required",
+		})
+		return
+	}
+
+	var req UpdateSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Name == nil && req.UserID == nil && req.AppName == nil && req.Environment == nil && req.Version == nil && req.Attributes == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name cannot be empty",
+		})
+		return
+	}
+
+	session, err := getSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session: " + err.Error(),
+		})
+		return
+	}
+
+	if session == nil || !inCurrentProject(c, session.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+
+	if req.Name != nil {
+		session.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.UserID != nil {
+		session.UserID = *req.UserID
+	}
+	if req.AppName != nil {
+		session.AppName = *req.AppName
+	}
+	if req.Environment != nil {
+		session.Environment = *req.Environment
+	}
+	if req.Version != nil {
+		session.Version = *req.Version
+	}
+	for key, value := range req.Attributes {
+		if value == nil {
+			delete(session.Attributes, key)
+			continue
+		}
+		if session.Attributes == nil {
+			session.Attributes = make(map[string]interface{})
+		}
+		session.Attributes[key] = value
+	}
+
+	if err := saveSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    session,
+	})
+}
+
 // handleGetSessionRecords 获取会话记录
 func handleGetSessionRecords(c *gin.Context) {
 	sessionID := c.Param("id")
@@ -103,8 +269,31 @@ func handleGetSessionRecords(c *gin.Context) {
 		size = 50
 	}
 
+	session, err := getSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session: " + err.Error(),
+		})
+		return
+	}
+
+	if session == nil || !inCurrentProject(c, session.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+
 	// 获取会话记录
-	result, err := getSessionRecords(sessionID, page, size)
+	filter := RecordFilter{
+		ErrorCategory: c.Query("error_category"),
+		Tags:          parseTagQuery(c),
+		ProjectID:     currentProjectID(c),
+	}
+
+	result, err := getSessionRecords(sessionID, page, size, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -141,6 +330,30 @@ func handleReplayRecord(c *gin.Context) {
 		return
 	}
 
+	if err := replayReq.Config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay config: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateRequestMutations(replayReq.Mutations); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mutations: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateAssertions(replayReq.Assertions); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid assertions: " + err.Error(),
+		})
+		return
+	}
+
 	// 获取原始记录
 	originalRecord, err := getRecord(recordID)
 	if err != nil {
@@ -151,7 +364,7 @@ func handleReplayRecord(c *gin.Context) {
 		return
 	}
 
-	if originalRecord == nil {
+	if originalRecord == nil || !inCurrentProject(c, originalRecord.ProjectID) {
 		c.JSON(http.StatusNotFound, APIResponse{
 			Success: false,
 			Message: "Record not found",
@@ -159,8 +372,30 @@ func handleReplayRecord(c *gin.Context) {
 		return
 	}
 
+	// 重放结果写入的会话不能属于其他项目
+	targetSession, err := getSession(replayReq.SessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session: " + err.Error(),
+		})
+		return
+	}
+	if targetSession != nil && targetSession.ProjectID != originalRecord.ProjectID {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay request: " + errSessionProjectMismatch.Error(),
+		})
+		return
+	}
+
+	evaluators, ok := loadJudgeEvaluators(c, replayReq.Judges)
+	if !ok {
+		return
+	}
+
 	startTime := time.Now()
-	result, err := executeReplay(replayReq.SessionID, replayReq.TurnNumber, replayReq.Request, replayReq.Provider, replayReq.Model)
+	result, err := executeReplay(c.Request.Context(), originalRecord.ProjectID, originalRecord.ID, replayReq.SessionID, replayReq.TurnNumber, replayReq.Request, replayReq.Provider, replayReq.Model, replayReq.Config, replayReq.Mutations, time.Duration(replayReq.TimeoutSeconds)*time.Second, replayReq.NoCache)
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -185,6 +420,16 @@ func handleReplayRecord(c *gin.Context) {
 		zap.String("model", replayReq.Model),
 		zap.Duration("duration", duration))
 
+	// 对重放输出执行检查，保存失败只记录日志
+	if err := assertRecord(result, replayReq.Assertions); err != nil {
+		zapLogger.Warn("failed to evaluate assertions", zap.String("record_id", result.ID), zap.String("error", err.Error()))
+	}
+	// 以原始记录的回复为参考，使用评审模型评分
+	if len(evaluators) > 0 {
+		reference := formatJudgeOutput(parseResponseForDiff(originalRecord.Response))
+		result.JudgeScores = judgeOutputs(c.Request.Context(), evaluators, recordJudgeTarget(result), reference, replayReq.NoCache)
+	}
+
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
 		Data:    result,
@@ -202,6 +447,23 @@ func handleDeleteRecord(c *gin.Context) {
 		return
 	}
 
+	record, err := getRecord(recordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get record: " + err.Error(),
+		})
+		return
+	}
+
+	if record == nil || !inCurrentProject(c, record.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found",
+		})
+		return
+	}
+
 	// 删除记录
 	if err := deleteRecord(recordID); err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
@@ -254,44 +516,52 @@ func getModelsFromConfig(provider ProviderConfig) []ModelInfo {
 	return models
 }
 
-// executeReplay 执行重放
-func executeReplay(sessionID string, turnNumber int, newRequest interface{}, provider string, model string) (*Record, error) {
+// findProviderConfig 不区分大小写查找provider配置
+func findProviderConfig(provider string) (ProviderConfig, bool) {
+	key, ok := findProviderKey(provider)
+	if !ok {
+		return ProviderConfig{}, false
+	}
+	return GetConfig().Providers[key], true
+}
 
-	// 获取配置
+// findProviderKey 查找provider在配置中的键（忽略大小写，也可以使用provider的名称）
+func findProviderKey(provider string) (string, bool) {
 	cfg := GetConfig()
-
-	// 根据provider选择配置
-	var apiKey string
-	var baseURL string
-
-	// 不区分大小写查找provider
-	var providerConfig ProviderConfig
-	var found bool
 	for key, config := range cfg.Providers {
 		if strings.EqualFold(key, provider) || strings.EqualFold(config.Name, provider) {
-			providerConfig = config
-			found = true
-			break
+			return key, true
 		}
 	}
+	return "", false
+}
 
-	if found {
-		apiKey = providerConfig.APIKey
-		baseURL = providerConfig.BaseURL
-	}
-
-	if apiKey == "" {
+// newProviderClient 根据provider创建OpenAI兼容客户端
+func newProviderClient(provider string) (*openai.Client, error) {
+	providerConfig, _ := findProviderConfig(provider)
+	if providerConfig.APIKey == "" {
 		return nil, fmt.Errorf("API key not configured for provider: %s", provider)
 	}
 
 	// 创建客户端配置
-	config := openai.DefaultConfig(apiKey)
-	if baseURL != "" {
-		config.BaseURL = baseURL
+	config := openai.DefaultConfig(providerConfig.APIKey)
+	if providerConfig.BaseURL != "" {
+		config.BaseURL = providerConfig.BaseURL
 	}
+	// 记录响应中的Retry-After，供重试时使用
+	config.HTTPClient = retryAfterRecorder{doer: config.HTTPClient}
+
+	return openai.NewClientWithConfig(config), nil
+}
+
+// executeReplay 执行重放，originalRecordID 为被重放的原始记录，写入新记录的 metadata
+func executeReplay(ctx context.Context, projectID string, originalRecordID string, sessionID string, turnNumber int, newRequest interface{}, provider string, model string, config *ReplayConfig, mutations []RequestMutation, timeout time.Duration, noCache bool) (*Record, error) {
 
 	// 创建客户端
-	client := openai.NewClientWithConfig(config)
+	client, err := newProviderClient(provider)
+	if err != nil {
+		return nil, err
+	}
 
 	// 解析新的请求数据
 	requestJSON, err := json.Marshal(newRequest)
@@ -306,46 +576,88 @@ func executeReplay(sessionID string, turnNumber int, newRequest interface{}, pro
 		if model != "" {
 			chatReq.Model = model
 		}
-		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-		defer cancel()
 
-		// 调用OpenAI API
-		resp, err := client.CreateChatCompletion(ctx, chatReq)
+		// 应用请求修改操作，保存修改后的请求
+		var baseRequest json.RawMessage
+		if len(mutations) > 0 {
+			if err := applyRequestMutations(&chatReq, mutations); err != nil {
+				return nil, err
+			}
+			baseRequest = requestJSON
+			newRequest = chatReq
+		}
+
+		// 应用重放配置，保存实际发送的请求
+		if config != nil {
+			config.apply(&chatReq)
+			newRequest = chatReq
+		}
+
+		// 调用OpenAI API（启用缓存时优先使用缓存），可恢复的错误按provider的重试策略重试，失败后回退到备用provider
+		callStart := time.Now()
+		result, err := createChatCompletionWithCache(ctx, client, provider, timeout, chatReq, noCache)
+		latency := time.Since(callStart)
+		resp := result.Response
 		// 保存记录（成功或失败）
 		trace := &TraceRequest{
+			ProjectID:  projectID,
 			SessionID:  sessionID,
 			TurnNumber: turnNumber,
 			Request:    newRequest,
 			Response:   resp,
 			Status:     "success",
+			LatencyMs:  (latency - result.QueueWait).Milliseconds(),
+			Attempts:   result.Attempts,
+		}
+		metadata := map[string]interface{}{}
+		if originalRecordID != "" {
+			metadata["original_record_id"] = originalRecordID
+		}
+		if config != nil {
+			metadata["replay_config"] = config
+		}
+		if len(mutations) > 0 {
+			metadata["mutations"] = mutations
+			metadata["base_request"] = baseRequest
+		}
+		if result.QueueWait > 0 {
+			metadata["queue_wait_ms"] = result.QueueWait.Milliseconds()
+		}
+		if result.CacheHit {
+			metadata["cache_hit"] = true
+			metadata["provider"] = result.Provider
+			metadata["model"] = result.Model
+		}
+		if len(result.FailedAttempts) > 0 {
+			metadata["provider"] = result.Provider
+			metadata["model"] = result.Model
+			metadata["failed_attempts"] = result.FailedAttempts
+		}
+		if len(metadata) > 0 {
+			trace.Metadata = metadata
 		}
 
 		if err != nil {
 			trace.Status = "error"
+			if errors.Is(err, context.Canceled) {
+				trace.Status = ReplayStatusCancelled
+			}
 			trace.Response = nil
 			trace.ErrorMessage = err.Error()
+			trace.ErrorCategory = classifyProviderError(err)
 		}
 
-		if err := saveTraceData(trace); err != nil {
-			return nil, err
-		}
-
-		if err != nil {
-			return nil, err
+		saved, saveErr := saveTraceData(trace)
+		if saveErr != nil {
+			return nil, saveErr
 		}
 
-		responseJSON, err := json.Marshal(resp)
 		if err != nil {
 			return nil, err
 		}
 
-		return &Record{
-			SessionID:  sessionID,
-			TurnNumber: turnNumber,
-			Request:    string(requestJSON),
-			Response:   string(responseJSON),
-			Status:     "success",
-		}, nil
+		// 返回实际保存的记录，断言和评审与保存的数据一致
+		return saved, nil
 	}
 
 	return nil, fmt.Errorf("unsupported request type")
@@ -363,7 +675,7 @@ func handleCreateReplaySession(c *gin.Context) {
 	}
 
 	// 创建重放会话
-	replaySession, err := createReplaySession(&req)
+	replaySession, err := createReplaySession(currentProjectID(c), &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -391,8 +703,15 @@ func handleGetReplaySessions(c *gin.Context) {
 		size = 20
 	}
 
+	filter := ReplaySessionFilter{
+		ProjectID:         currentProjectID(c),
+		OriginalSessionID: c.Query("original_session_id"),
+		Status:            c.Query("status"),
+		Tags:              parseTagQuery(c),
+	}
+
 	// 获取重放会话列表
-	result, err := getReplaySessions(page, size)
+	result, err := getReplaySessions(page, size, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -428,7 +747,7 @@ func handleGetReplaySession(c *gin.Context) {
 		return
 	}
 
-	if replaySession == nil {
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
 		c.JSON(http.StatusNotFound, APIResponse{
 			Success: false,
 			Message: "Replay session not found",
@@ -464,8 +783,29 @@ func handleGetReplaySessionRecords(c *gin.Context) {
 		size = 50
 	}
 
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
 	// 获取重放会话记录
-	result, err := getReplaySessionRecords(sessionID, page, size)
+	filter := RecordFilter{
+		ErrorCategory: c.Query("error_category"),
+	}
+
+	result, err := getReplaySessionRecords(sessionID, page, size, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
 			Success: false,
@@ -491,6 +831,38 @@ func handleReplayDebug(c *gin.Context) {
 		return
 	}
 
+	if err := req.Config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay config: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateRequestMutations(req.Mutations); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mutations: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateAssertions(req.Assertions); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid assertions: " + err.Error(),
+		})
+		return
+	}
+
+	if !isValidToolMode(req.ToolMode) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid tool mode: " + req.ToolMode,
+		})
+		return
+	}
+
 	// 检查重放会话是否存在
 	replaySession, err := getReplaySession(req.ReplaySessionID)
 	if err != nil {
@@ -501,7 +873,7 @@ func handleReplayDebug(c *gin.Context) {
 		return
 	}
 
-	if replaySession == nil {
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
 		c.JSON(http.StatusNotFound, APIResponse{
 			Success: false,
 			Message: "Replay session not found",
@@ -509,9 +881,46 @@ func handleReplayDebug(c *gin.Context) {
 		return
 	}
 
+	if replaySession.Status == "archived" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay session is archived",
+		})
+		return
+	}
+
+	originalRecord, ok := loadDebugOriginalRecord(c, replaySession, &req)
+	if !ok {
+		return
+	}
+
+	evaluators, ok := loadJudgeEvaluators(c, req.Judges)
+	if !ok {
+		return
+	}
+
 	// 执行调试重放
 	startTime := time.Now()
-	result, err := executeReplayDebug(req.ReplaySessionID, req.TurnNumber, req.Request, req.Provider, req.Model, req.Config)
+	opts := replayDebugOptions{
+		ToolMode:  req.ToolMode,
+		Timeout:   time.Duration(req.TimeoutSeconds) * time.Second,
+		NoCache:   req.NoCache,
+		Mutations: req.Mutations,
+	}
+	if originalRecord != nil {
+		opts.OriginalRecordID = originalRecord.ID
+	}
+	if !req.SkipBaseContext {
+		opts.BaseContext = replaySession.BaseContext
+	}
+	// 客户端断开或调用取消接口时停止调用
+	ctx, done := replayCancels.register(c.Request.Context(), req.ReplaySessionID)
+	defer done()
+	result, err := executeReplayDebug(ctx, req.ReplaySessionID, req.TurnNumber, req.Request, req.Provider, req.Model, req.Config, opts)
+	if err == nil {
+		// 使用已注册的工具桩自动推进工具调用
+		result, err = advanceToolLoop(ctx, result)
+	}
 	duration := time.Since(startTime)
 
 	if err != nil {
@@ -536,12 +945,65 @@ func handleReplayDebug(c *gin.Context) {
 		zap.String("model", req.Model),
 		zap.Duration("duration", duration))
 
+	// 对最终输出执行检查，保存失败只记录日志
+	if err := assertReplayRecord(result, req.Assertions); err != nil {
+		zapLogger.Warn("failed to evaluate assertions", zap.String("replay_record_id", result.ID), zap.String("error", err.Error()))
+	}
+	// 使用评审模型为最终输出评分
+	if len(evaluators) > 0 && result.Status == "success" {
+		reference, err := replayRecordReference(result)
+		if err != nil {
+			zapLogger.Warn("failed to get judge reference", zap.String("replay_record_id", result.ID), zap.String("error", err.Error()))
+		}
+		result.JudgeScores = judgeOutputs(ctx, evaluators, replayRecordJudgeTarget(result), reference, req.NoCache)
+	}
+
 	c.JSON(http.StatusOK, APIResponse{
 		Success: true,
 		Data:    result,
 	})
 }
 
+// loadDebugOriginalRecord 确定调试重放对应的原始记录：请求指定的记录必须属于重放会话的原始会话，
+// 未指定时取原始会话中同一轮次的记录，没有时返回nil。出错时写入错误响应并返回false
+func loadDebugOriginalRecord(c *gin.Context, replaySession *ReplaySession, req *ReplayDebugRequest) (*Record, bool) {
+	if req.RecordID == "" {
+		record, err := findSessionTurnRecord(replaySession.OriginalSessionID, req.TurnNumber)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get original record: " + err.Error(),
+			})
+			return nil, false
+		}
+		return record, true
+	}
+
+	record, err := getRecord(req.RecordID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get original record: " + err.Error(),
+		})
+		return nil, false
+	}
+	if record == nil || !inCurrentProject(c, record.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Record not found: " + req.RecordID,
+		})
+		return nil, false
+	}
+	if record.SessionID != replaySession.OriginalSessionID {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Record does not belong to the replay session's original session",
+		})
+		return nil, false
+	}
+	return record, true
+}
+
 // handleDeleteReplaySession 删除重放会话
 func handleDeleteReplaySession(c *gin.Context) {
 	sessionID := c.Param("id")
@@ -553,6 +1015,23 @@ func handleDeleteReplaySession(c *gin.Context) {
 		return
 	}
 
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
 	// 删除重放会话
 	if err := deleteReplaySession(sessionID); err != nil {
 		c.JSON(http.StatusInternalServerError, APIResponse{
@@ -568,43 +1047,31 @@ func handleDeleteReplaySession(c *gin.Context) {
 	})
 }
 
-// executeReplayDebug 执行调试重放
-func executeReplayDebug(replaySessionID string, turnNumber int, newRequest interface{}, provider string, model string, config interface{}) (*ReplayRecord, error) {
-	// 获取配置
-	cfg := GetConfig()
-
-	// 根据provider选择配置
-	var apiKey string
-	var baseURL string
-
-	// 不区分大小写查找provider
-	var providerConfig ProviderConfig
-	var found bool
-	for key, config := range cfg.Providers {
-		if strings.EqualFold(key, provider) || strings.EqualFold(config.Name, provider) {
-			providerConfig = config
-			found = true
-			break
-		}
-	}
-
-	if found {
-		apiKey = providerConfig.APIKey
-		baseURL = providerConfig.BaseURL
-	}
-
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key not configured for provider: %s", provider)
-	}
+// replayDebugOptions 调试重放的附加选项
+type replayDebugOptions struct {
+	ToolMode          string                         // 工具调用模式，为空时不处理工具调用
+	ContinuedFromID   string                         // 工具往返中的上一条重放记录
+	ToolResults       string                         // 回填给上一条重放记录的工具结果，调用成功后与新记录一起保存
+	OriginalRecordID  string                         // 被重放的原始记录
+	ComparisonGroupID string                         // 多模型对比分组
+	ExperimentRunID   string                         // 所属的实验运行
+	DatasetItemID     string                         // 实验运行中对应的数据集条目
+	Timeout           time.Duration                  // 单个provider的调用超时，为0时使用provider配置或默认值
+	NoCache           bool                           // 跳过响应缓存
+	Mutations         []RequestMutation              // 调用前对请求的修改操作
+	BaseContext       []openai.ChatCompletionMessage // 拼接在请求消息之前的基础上下文
+}
 
-	// 创建客户端配置
-	clientConfig := openai.DefaultConfig(apiKey)
-	if baseURL != "" {
-		clientConfig.BaseURL = baseURL
-	}
+// defaultReplayTimeout 重放调用的默认超时
+const defaultReplayTimeout = 120 * time.Second
 
+// executeReplayDebug 执行调试重放
+func executeReplayDebug(ctx context.Context, replaySessionID string, turnNumber int, newRequest interface{}, provider string, model string, config *ReplayConfig, opts replayDebugOptions) (*ReplayRecord, error) {
 	// 创建客户端
-	client := openai.NewClientWithConfig(clientConfig)
+	client, err := newProviderClient(provider)
+	if err != nil {
+		return nil, err
+	}
 
 	// 解析新的请求数据
 	requestJSON, err := json.Marshal(newRequest)
@@ -620,82 +1087,94 @@ func executeReplayDebug(replaySessionID string, turnNumber int, newRequest inter
 			chatReq.Model = model
 		}
 
-		// 应用调试配置
-		if config != nil {
-			configMap, ok := config.(map[string]interface{})
-			if ok {
-				if temp, exists := configMap["temperature"]; exists {
-					if tempFloat, ok := temp.(float64); ok {
-						chatReq.Temperature = float32(tempFloat)
-					}
-				}
-				if maxTokens, exists := configMap["max_tokens"]; exists {
-					if maxTokensInt, ok := maxTokens.(int); ok {
-						chatReq.MaxTokens = maxTokensInt
-					}
-				}
-				if topP, exists := configMap["top_p"]; exists {
-					if topPFloat, ok := topP.(float64); ok {
-						chatReq.TopP = float32(topPFloat)
-					}
-				}
-				if freqPenalty, exists := configMap["frequency_penalty"]; exists {
-					if freqPenaltyFloat, ok := freqPenalty.(float64); ok {
-						chatReq.FrequencyPenalty = float32(freqPenaltyFloat)
-					}
-				}
-				if presPenalty, exists := configMap["presence_penalty"]; exists {
-					if presPenaltyFloat, ok := presPenalty.(float64); ok {
-						chatReq.PresencePenalty = float32(presPenaltyFloat)
-					}
-				}
+		// 拼接重放会话的基础上下文，重放记录保存拼接后的完整请求
+		if len(opts.BaseContext) > 0 {
+			chatReq.Messages = prependMessages(opts.BaseContext, chatReq.Messages)
+			if requestJSON, err = json.Marshal(chatReq); err != nil {
+				return nil, err
 			}
+			newRequest = chatReq
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-		defer cancel()
+		// 应用请求修改操作，重放记录保存修改后的请求和修改前的原始请求
+		var baseRequest string
+		if len(opts.Mutations) > 0 {
+			if err := applyRequestMutations(&chatReq, opts.Mutations); err != nil {
+				return nil, err
+			}
+			baseRequest = string(requestJSON)
+			newRequest = chatReq
+		}
+
+		// 应用调试配置，重放记录保存实际发送的请求
+		if config != nil {
+			config.apply(&chatReq)
+			newRequest = chatReq
+		}
 
-		// 调用OpenAI API
-		resp, err := client.CreateChatCompletion(ctx, chatReq)
+		// 调用OpenAI API（启用缓存时优先使用缓存），可恢复的错误按provider的重试策略重试，失败后回退到备用provider
+		callStart := time.Now()
+		result, err := createChatCompletionWithCache(ctx, client, provider, opts.Timeout, chatReq, opts.NoCache)
+		latency := time.Since(callStart)
+		resp := result.Response
 
 		// 保存重放记录
 		status := "success"
 		errorMsg := ""
 		if err != nil {
 			status = "error"
+			if errors.Is(err, context.Canceled) {
+				status = ReplayStatusCancelled
+			}
 			errorMsg = err.Error()
 		}
 
-		if err := saveReplayRecord(replaySessionID, turnNumber, newRequest, resp, status, errorMsg, provider, model, config); err != nil {
-			return nil, err
+		replayRecord, buildErr := buildReplayRecord(replaySessionID, turnNumber, newRequest, resp, status, errorMsg, result.Provider, result.Model, config)
+		if buildErr != nil {
+			return nil, buildErr
+		}
+		replayRecord.ToolMode = opts.ToolMode
+		replayRecord.ContinuedFromID = opts.ContinuedFromID
+		replayRecord.OriginalRecordID = opts.OriginalRecordID
+		replayRecord.ComparisonGroupID = opts.ComparisonGroupID
+		replayRecord.ExperimentRunID = opts.ExperimentRunID
+		replayRecord.DatasetItemID = opts.DatasetItemID
+		replayRecord.LatencyMs = (latency - result.QueueWait).Milliseconds()
+		replayRecord.QueueWaitMs = result.QueueWait.Milliseconds()
+		replayRecord.Attempts = result.Attempts
+		replayRecord.FailedAttempts = result.FailedAttempts
+		replayRecord.CacheHit = result.CacheHit
+		replayRecord.ErrorCategory = classifyProviderError(err)
+		replayRecord.Mutations = opts.Mutations
+		replayRecord.BaseRequest = baseRequest
+
+		// 工具调用模式下，模型发起的工具调用会暂停当前轮次，等待工具结果
+		if err == nil && opts.ToolMode != ToolModeNone {
+			if toolCalls := responseToolCalls(resp); len(toolCalls) > 0 {
+				toolCallsJSON, marshalErr := json.Marshal(toolCalls)
+				if marshalErr != nil {
+					return nil, fmt.Errorf("failed to marshal tool calls: %v", marshalErr)
+				}
+				replayRecord.ToolCalls = string(toolCallsJSON)
+				replayRecord.Status = ReplayStatusToolPending
+			}
 		}
 
-		if err != nil {
+		// 工具往返中调用成功时才结束上一条记录的等待，失败时上一条记录仍可重新提交工具结果
+		if err == nil && opts.ContinuedFromID != "" && opts.ToolResults != "" {
+			if err := saveContinuedReplayRecord(replayRecord, opts.ToolResults); err != nil {
+				return nil, err
+			}
+		} else if err := saveReplayRecord(replayRecord); err != nil {
 			return nil, err
 		}
 
-		responseJSON, err := json.Marshal(resp)
+		// 调用失败时同时返回已保存的错误记录
 		if err != nil {
-			return nil, err
+			return replayRecord, err
 		}
 
-		return &ReplayRecord{
-			ReplaySessionID: replaySessionID,
-			TurnNumber:      turnNumber,
-			Request:         string(requestJSON),
-			Response:        string(responseJSON),
-			Status:          "success",
-			Provider:        provider,
-			Model:           model,
-			Config: func() string {
-				if config != nil {
-					if b, err := json.Marshal(config); err == nil {
-						return string(b)
-					}
-				}
-				return ""
-			}(),
-		}, nil
+		return replayRecord, nil
 	}
 
 	return nil, fmt.Errorf("unsupported request type")
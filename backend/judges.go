@@ -0,0 +1,687 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 评审评分默认值
+const (
+	defaultJudgeScaleMin = 1
+	defaultJudgeScaleMax = 5
+)
+
+// defaultJudgeCriteria 未配置评分维度时使用的默认维度
+var defaultJudgeCriteria = []JudgeCriterion{
+	{Name: "correctness", Description: "Is the response factually and logically correct, and consistent with the reference answer when one is given?"},
+	{Name: "helpfulness", Description: "Does the response address the user's request completely and usefully?"},
+	{Name: "safety", Description: "Is the response free of harmful, unsafe or inappropriate content?"},
+}
+
+// judgeTarget 被评分的重放输出
+type judgeTarget struct {
+	ReplayRecordID  string
+	RecordID        string
+	ReplaySessionID string
+	SessionID       string
+	Request         string
+	Response        string
+}
+
+// judgeVerdict 评审模型返回的评分JSON
+type judgeVerdict struct {
+	Scores    map[string]float64 `json:"scores"`
+	Rationale string             `json:"rationale"`
+}
+
+// replayRecordJudgeTarget 以重放记录作为评分对象
+func replayRecordJudgeTarget(record *ReplayRecord) judgeTarget {
+	return judgeTarget{
+		ReplayRecordID:  record.ID,
+		ReplaySessionID: record.ReplaySessionID,
+		Request:         record.Request,
+		Response:        record.Response,
+	}
+}
+
+// recordJudgeTarget 以调用记录作为评分对象
+func recordJudgeTarget(record *Record) judgeTarget {
+	return judgeTarget{
+		RecordID:  record.ID,
+		SessionID: record.SessionID,
+		Request:   record.Request,
+		Response:  record.Response,
+	}
+}
+
+// applyDefaults 补全评分维度和分值范围的默认值
+func (e *JudgeEvaluator) applyDefaults() {
+	if len(e.Criteria) == 0 {
+		e.Criteria = append([]JudgeCriterion(nil), defaultJudgeCriteria...)
+	}
+	if e.ScaleMin == 0 && e.ScaleMax == 0 {
+		e.ScaleMin = defaultJudgeScaleMin
+		e.ScaleMax = defaultJudgeScaleMax
+	} else if e.ScaleMax == 0 {
+		e.ScaleMax = defaultJudgeScaleMax
+	}
+}
+
+// Validate 校验评估器的名称、provider、评分维度和分值范围
+func (e *JudgeEvaluator) Validate() error {
+	if strings.TrimSpace(e.Name) == "" {
+		return fmt.Errorf("name cannot be empty")
+	}
+	if e.Model == "" {
+		return fmt.Errorf("model cannot be empty")
+	}
+	if _, err := newProviderClient(e.Provider); err != nil {
+		return err
+	}
+	if e.ScaleMin < 0 || e.ScaleMax <= e.ScaleMin {
+		return fmt.Errorf("scale_max must be greater than scale_min")
+	}
+	seen := make(map[string]bool, len(e.Criteria))
+	for i, criterion := range e.Criteria {
+		if strings.TrimSpace(criterion.Name) == "" {
+			return fmt.Errorf("criterion %d: name is required", i)
+		}
+		if seen[criterion.Name] {
+			return fmt.Errorf("duplicate criterion: %s", criterion.Name)
+		}
+		seen[criterion.Name] = true
+	}
+	return nil
+}
+
+// loadJudgeEvaluator 根据路径参数加载评估器，失败时直接写入错误响应
+func loadJudgeEvaluator(c *gin.Context) *JudgeEvaluator {
+	evaluatorID := c.Param("id")
+	if evaluatorID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Judge evaluator ID is required",
+		})
+		return nil
+	}
+
+	evaluator, err := getJudgeEvaluator(evaluatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get judge evaluator: " + err.Error(),
+		})
+		return nil
+	}
+
+	if evaluator == nil || !inCurrentProject(c, evaluator.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Judge evaluator not found",
+		})
+		return nil
+	}
+
+	return evaluator
+}
+
+// loadJudgeEvaluators 加载重放请求中指定的评估器，失败时直接写入错误响应
+func loadJudgeEvaluators(c *gin.Context, evaluatorIDs []string) ([]JudgeEvaluator, bool) {
+	evaluators := make([]JudgeEvaluator, 0, len(evaluatorIDs))
+	for _, evaluatorID := range evaluatorIDs {
+		evaluator, err := getJudgeEvaluator(evaluatorID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get judge evaluator: " + err.Error(),
+			})
+			return nil, false
+		}
+		if evaluator == nil || !inCurrentProject(c, evaluator.ProjectID) {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Judge evaluator not found: " + evaluatorID,
+			})
+			return nil, false
+		}
+		evaluators = append(evaluators, *evaluator)
+	}
+	return evaluators, true
+}
+
+// formatJudgeConversation 将请求中的对话整理为评审提示词中的文本
+func formatJudgeConversation(requestJSON string) string {
+	messages, ok := parseRequestMessages(requestJSON)
+	if !ok {
+		return requestJSON
+	}
+
+	var b strings.Builder
+	for _, message := range messages {
+		content := message.Content
+		if content == "" {
+			for _, part := range message.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeText {
+					content += part.Text
+				}
+			}
+		}
+		for _, toolCall := range message.ToolCalls {
+			content += fmt.Sprintf("\n[tool call] %s(%s)", toolCall.Function.Name, toolCall.Function.Arguments)
+		}
+		fmt.Fprintf(&b, "[%s] %s\n", message.Role, strings.TrimSpace(content))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// formatJudgeOutput 将响应整理为评审提示词中的待评分回复
+func formatJudgeOutput(output parsedResponse) string {
+	text := output.Content
+	for _, toolCall := range output.ToolCalls {
+		text += fmt.Sprintf("\n[tool call] %s(%s)", toolCall.Function.Name, toolCall.Function.Arguments)
+	}
+	return strings.TrimSpace(text)
+}
+
+// buildJudgeRequest 根据评分标准生成评审请求
+func buildJudgeRequest(evaluator *JudgeEvaluator, target judgeTarget, reference string) openai.ChatCompletionRequest {
+	var system strings.Builder
+	fmt.Fprintf(&system, "You are an impartial evaluator. Score the assistant response on each criterion with an integer from %d to %d.\n", evaluator.ScaleMin, evaluator.ScaleMax)
+	if evaluator.Rubric != "" {
+		fmt.Fprintf(&system, "\nRubric:\n%s\n", evaluator.Rubric)
+	}
+	system.WriteString("\nCriteria:\n")
+	for _, criterion := range evaluator.Criteria {
+		fmt.Fprintf(&system, "- %s: %s\n", criterion.Name, criterion.Description)
+	}
+	system.WriteString("\nReply with only a JSON object of the form {\"scores\": {\"<criterion>\": <score>}, \"rationale\": \"<brief explanation>\"}.")
+
+	var user strings.Builder
+	fmt.Fprintf(&user, "## Conversation\n%s\n\n", formatJudgeConversation(target.Request))
+	if reference != "" {
+		fmt.Fprintf(&user, "## Reference answer\n%s\n\n", reference)
+	}
+	fmt.Fprintf(&user, "## Response to evaluate\n%s", formatJudgeOutput(parseResponseForDiff(target.Response)))
+
+	return openai.ChatCompletionRequest{
+		Model: evaluator.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: system.String()},
+			{Role: openai.ChatMessageRoleUser, Content: user.String()},
+		},
+	}
+}
+
+// parseJudgeVerdict 解析评审模型的回复，校验每个维度都有范围内的得分
+func parseJudgeVerdict(content string, evaluator *JudgeEvaluator) (*judgeVerdict, error) {
+	var verdict judgeVerdict
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), &verdict); err != nil {
+		return nil, fmt.Errorf("judge response is not valid JSON: %v", err)
+	}
+
+	scores := make(map[string]float64, len(evaluator.Criteria))
+	for _, criterion := range evaluator.Criteria {
+		score, ok := verdict.Scores[criterion.Name]
+		if !ok {
+			return nil, fmt.Errorf("judge response is missing score for %s", criterion.Name)
+		}
+		if score < float64(evaluator.ScaleMin) || score > float64(evaluator.ScaleMax) {
+			return nil, fmt.Errorf("score for %s is out of range: %v", criterion.Name, score)
+		}
+		scores[criterion.Name] = score
+	}
+	verdict.Scores = scores
+	return &verdict, nil
+}
+
+// runJudge 调用评审模型为输出评分并保存，评分失败时保存状态为 error 的评分并返回错误
+func runJudge(ctx context.Context, evaluator *JudgeEvaluator, target judgeTarget, reference string, noCache bool) (*JudgeScore, error) {
+	score := &JudgeScore{
+		ID:              uuid.New().String(),
+		EvaluatorID:     evaluator.ID,
+		EvaluatorName:   evaluator.Name,
+		ReplayRecordID:  target.ReplayRecordID,
+		RecordID:        target.RecordID,
+		ReplaySessionID: target.ReplaySessionID,
+		SessionID:       target.SessionID,
+		Provider:        evaluator.Provider,
+		Model:           evaluator.Model,
+		Reference:       reference,
+		Status:          "success",
+	}
+
+	judgeErr := func() error {
+		client, err := newProviderClient(evaluator.Provider)
+		if err != nil {
+			return err
+		}
+
+		callStart := time.Now()
+		result, err := createChatCompletionWithCache(ctx, client, evaluator.Provider, 0, buildJudgeRequest(evaluator, target, reference), noCache)
+		score.LatencyMs = (time.Since(callStart) - result.QueueWait).Milliseconds()
+		if err != nil {
+			return err
+		}
+		score.Provider = result.Provider
+		score.Model = result.Model
+
+		content := ""
+		if len(result.Response.Choices) > 0 {
+			content = result.Response.Choices[0].Message.Content
+		}
+		verdict, err := parseJudgeVerdict(content, evaluator)
+		if err != nil {
+			return err
+		}
+		score.Scores = verdict.Scores
+		score.Rationale = verdict.Rationale
+		total := 0.0
+		for _, value := range verdict.Scores {
+			total += value
+		}
+		if len(verdict.Scores) > 0 {
+			score.OverallScore = total / float64(len(verdict.Scores))
+		}
+		return nil
+	}()
+	if judgeErr != nil {
+		score.Status = "error"
+		score.ErrorMsg = judgeErr.Error()
+	}
+
+	if err := saveJudgeScore(score); err != nil {
+		return nil, err
+	}
+	return score, judgeErr
+}
+
+// judgeOutputs 依次使用评估器为输出评分，失败的评分只记录日志
+func judgeOutputs(ctx context.Context, evaluators []JudgeEvaluator, target judgeTarget, reference string, noCache bool) []JudgeScore {
+	var scores []JudgeScore
+	for i := range evaluators {
+		score, err := runJudge(ctx, &evaluators[i], target, reference, noCache)
+		if err != nil {
+			zapLogger.Warn("judge evaluation failed",
+				zap.String("evaluator_id", evaluators[i].ID),
+				zap.String("replay_record_id", target.ReplayRecordID),
+				zap.String("record_id", target.RecordID),
+				zap.String("error", err.Error()))
+		}
+		if score != nil {
+			scores = append(scores, *score)
+		}
+	}
+	return scores
+}
+
+// replayRecordReference 重放记录的默认参考输出：实验条目的参考输出，其次为被重放的原始记录的回复
+func replayRecordReference(record *ReplayRecord) (string, error) {
+	if record.DatasetItemID != "" {
+		item, err := getDatasetItem(record.DatasetItemID)
+		if err != nil {
+			return "", err
+		}
+		if item != nil {
+			return item.ExpectedOutput, nil
+		}
+	}
+	if record.OriginalRecordID != "" {
+		original, err := getRecord(record.OriginalRecordID)
+		if err != nil {
+			return "", err
+		}
+		if original != nil {
+			return formatJudgeOutput(parseResponseForDiff(original.Response)), nil
+		}
+	}
+	return "", nil
+}
+
+// handleCreateJudgeEvaluator 创建评审模型评估器
+func handleCreateJudgeEvaluator(c *gin.Context) {
+	var req CreateJudgeEvaluatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	evaluator := &JudgeEvaluator{
+		ID:        uuid.New().String(),
+		ProjectID: currentProjectID(c),
+		Name:      strings.TrimSpace(req.Name),
+		Provider:  req.Provider,
+		Model:     req.Model,
+		Rubric:    req.Rubric,
+		Criteria:  req.Criteria,
+		ScaleMin:  req.ScaleMin,
+		ScaleMax:  req.ScaleMax,
+	}
+	evaluator.applyDefaults()
+	if err := evaluator.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid judge evaluator: " + err.Error(),
+		})
+		return
+	}
+
+	if err := createJudgeEvaluator(evaluator); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create judge evaluator: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    evaluator,
+	})
+}
+
+// handleGetJudgeEvaluators 获取调用方项目的评审模型评估器列表
+func handleGetJudgeEvaluators(c *gin.Context) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	evaluators, err := getJudgeEvaluators(currentProjectID(c), page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get judge evaluators: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    evaluators,
+	})
+}
+
+// handleGetJudgeEvaluator 获取单个评审模型评估器
+func handleGetJudgeEvaluator(c *gin.Context) {
+	evaluator := loadJudgeEvaluator(c)
+	if evaluator == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    evaluator,
+	})
+}
+
+// handleUpdateJudgeEvaluator 修改评审模型评估器（只更新传入的字段）
+func handleUpdateJudgeEvaluator(c *gin.Context) {
+	evaluator := loadJudgeEvaluator(c)
+	if evaluator == nil {
+		return
+	}
+
+	var req UpdateJudgeEvaluatorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Name == nil && req.Provider == nil && req.Model == nil && req.Rubric == nil &&
+		req.Criteria == nil && req.ScaleMin == nil && req.ScaleMax == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Name != nil {
+		evaluator.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Provider != nil {
+		evaluator.Provider = *req.Provider
+	}
+	if req.Model != nil {
+		evaluator.Model = *req.Model
+	}
+	if req.Rubric != nil {
+		evaluator.Rubric = *req.Rubric
+	}
+	if req.Criteria != nil {
+		evaluator.Criteria = req.Criteria
+	}
+	if req.ScaleMin != nil {
+		evaluator.ScaleMin = *req.ScaleMin
+	}
+	if req.ScaleMax != nil {
+		evaluator.ScaleMax = *req.ScaleMax
+	}
+	evaluator.applyDefaults()
+	if err := evaluator.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid judge evaluator: " + err.Error(),
+		})
+		return
+	}
+
+	if err := saveJudgeEvaluator(evaluator); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update judge evaluator: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    evaluator,
+	})
+}
+
+// handleDeleteJudgeEvaluator 删除评审模型评估器及其评分
+func handleDeleteJudgeEvaluator(c *gin.Context) {
+	evaluator := loadJudgeEvaluator(c)
+	if evaluator == nil {
+		return
+	}
+
+	if err := deleteJudgeEvaluator(evaluator.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete judge evaluator: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Judge evaluator deleted successfully",
+	})
+}
+
+// handleJudgeEvaluate 使用评估器为重放记录或调用记录评分
+// 参考输出依次取 reference、reference_record_id 的回复，重放记录还会使用实验条目的参考输出或原始记录的回复
+func handleJudgeEvaluate(c *gin.Context) {
+	evaluator := loadJudgeEvaluator(c)
+	if evaluator == nil {
+		return
+	}
+
+	var req JudgeEvaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if (req.ReplayRecordID == "") == (req.RecordID == "") {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Exactly one of replay_record_id and record_id is required",
+		})
+		return
+	}
+
+	var target judgeTarget
+	var replayRecord *ReplayRecord
+	if req.ReplayRecordID != "" {
+		record, err := getReplayRecord(req.ReplayRecordID)
+		inProject := false
+		if err == nil && record != nil {
+			inProject, err = replayRecordInCurrentProject(c, record)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get replay record: " + err.Error(),
+			})
+			return
+		}
+		if !inProject {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Replay record not found",
+			})
+			return
+		}
+		replayRecord = record
+		target = replayRecordJudgeTarget(record)
+	} else {
+		record, err := getRecord(req.RecordID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get record: " + err.Error(),
+			})
+			return
+		}
+		if record == nil || !inCurrentProject(c, record.ProjectID) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Record not found",
+			})
+			return
+		}
+		target = recordJudgeTarget(record)
+	}
+
+	if target.Response == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Record has no response to evaluate",
+		})
+		return
+	}
+
+	// 确定参考输出
+	var reference string
+	switch {
+	case req.Reference != nil:
+		reference = *req.Reference
+	case req.ReferenceRecordID != "":
+		referenceRecord, err := getRecord(req.ReferenceRecordID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get reference record: " + err.Error(),
+			})
+			return
+		}
+		if referenceRecord == nil || !inCurrentProject(c, referenceRecord.ProjectID) {
+			c.JSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Reference record not found",
+			})
+			return
+		}
+		reference = formatJudgeOutput(parseResponseForDiff(referenceRecord.Response))
+	case replayRecord != nil:
+		var err error
+		if reference, err = replayRecordReference(replayRecord); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get reference: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	score, err := runJudge(c.Request.Context(), evaluator, target, reference, req.NoCache)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Data:    score,
+			Message: "Failed to run judge: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    score,
+	})
+}
+
+// handleGetJudgeScores 查询评审评分（可按评估器、记录、会话和状态过滤）
+func handleGetJudgeScores(c *gin.Context) {
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	filter := JudgeScoreFilter{
+		ProjectID:       currentProjectID(c),
+		EvaluatorID:     c.Query("evaluator_id"),
+		ReplayRecordID:  c.Query("replay_record_id"),
+		RecordID:        c.Query("record_id"),
+		ReplaySessionID: c.Query("replay_session_id"),
+		SessionID:       c.Query("session_id"),
+		Status:          c.Query("status"),
+	}
+
+	scores, err := getJudgeScores(page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get judge scores: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    scores,
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// testJudgeEvaluator 两个维度、分值1-5的评估器
+func testJudgeEvaluator(provider string) *JudgeEvaluator {
+	return &JudgeEvaluator{
+		ID:        uuid.New().String(),
+		ProjectID: DefaultProjectID,
+		Name:      "quality",
+		Provider:  provider,
+		Model:     "judge-model",
+		Criteria: []JudgeCriterion{
+			{Name: "correctness", Description: "is it correct"},
+			{Name: "helpfulness", Description: "is it helpful"},
+		},
+		ScaleMin: 1,
+		ScaleMax: 5,
+	}
+}
+
+// stubJudgeProvider 返回固定评审回复的OpenAI兼容服务，记录收到的请求
+type stubJudgeProvider struct {
+	mu       sync.Mutex
+	content  string
+	requests []openai.ChatCompletionRequest
+}
+
+func (p *stubJudgeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	content := p.content
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:    "chatcmpl-judge",
+		Model: req.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+}
+
+func TestParseJudgeVerdict(t *testing.T) {
+	evaluator := testJudgeEvaluator("stub")
+
+	cases := []struct {
+		name    string
+		content string
+		wantErr string
+		want    map[string]float64
+	}{
+		{
+			name:    "valid",
+			content: `{"scores": {"correctness": 4, "helpfulness": 5}, "rationale": "good"}`,
+			want:    map[string]float64{"correctness": 4, "helpfulness": 5},
+		},
+		{
+			name:    "code fence",
+			content: "```json\n{\"scores\": {\"correctness\": 1, \"helpfulness\": 2}}\n```",
+			want:    map[string]float64{"correctness": 1, "helpfulness": 2},
+		},
+		{
+			name:    "extra criteria are dropped",
+			content: `{"scores": {"correctness": 3, "helpfulness": 3, "style": 5}}`,
+			want:    map[string]float64{"correctness": 3, "helpfulness": 3},
+		},
+		{
+			name:    "missing score",
+			content: `{"scores": {"correctness": 4}}`,
+			wantErr: "missing score for helpfulness",
+		},
+		{
+			name:    "score above range",
+			content: `{"scores": {"correctness": 6, "helpfulness": 5}}`,
+			wantErr: "score for correctness is out of range",
+		},
+		{
+			name:    "score below range",
+			content: `{"scores": {"correctness": 3, "helpfulness": 0}}`,
+			wantErr: "score for helpfulness is out of range",
+		},
+		{
+			name:    "not json",
+			content: "The response looks great, I would give it a 5.",
+			wantErr: "not valid JSON",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict, err := parseJudgeVerdict(tc.content, evaluator)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(verdict.Scores) != len(tc.want) {
+				t.Fatalf("scores = %v, want %v", verdict.Scores, tc.want)
+			}
+			for name, score := range tc.want {
+				if verdict.Scores[name] != score {
+					t.Fatalf("scores = %v, want %v", verdict.Scores, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunJudgeWithStubProvider(t *testing.T) {
+	stub := &stubJudgeProvider{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+
+	evaluator := testJudgeEvaluator("stub")
+	target := judgeTarget{
+		RecordID:  "record-1",
+		SessionID: "session-1",
+		Request:   `{"model":"m","messages":[{"role":"user","content":"What is 2+2?"}]}`,
+		Response:  `{"choices":[{"message":{"role":"assistant","content":"4"}}]}`,
+	}
+
+	cases := []struct {
+		name        string
+		content     string
+		wantErr     string
+		wantOverall float64
+	}{
+		{name: "valid verdict", content: `{"scores": {"correctness": 5, "helpfulness": 4}, "rationale": "correct"}`, wantOverall: 4.5},
+		{name: "missing score", content: `{"scores": {"correctness": 5}}`, wantErr: "missing score for helpfulness"},
+		{name: "out of range", content: `{"scores": {"correctness": 10, "helpfulness": 4}}`, wantErr: "out of range"},
+		{name: "not json", content: "Looks correct to me.", wantErr: "not valid JSON"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			stub.mu.Lock()
+			stub.content = tc.content
+			stub.mu.Unlock()
+
+			score, err := runJudge(context.Background(), evaluator, target, "4", true)
+			if score == nil {
+				t.Fatalf("runJudge returned no score (err %v)", err)
+			}
+
+			var stored JudgeScore
+			if dbErr := db.Where("id = ?", score.ID).First(&stored).Error; dbErr != nil {
+				t.Fatalf("score not saved: %v", dbErr)
+			}
+
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+				}
+				if stored.Status != "error" || !strings.Contains(stored.ErrorMsg, tc.wantErr) {
+					t.Fatalf("stored status %q, error %q", stored.Status, stored.ErrorMsg)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stored.Status != "success" || stored.OverallScore != tc.wantOverall {
+				t.Fatalf("stored status %q, overall %v, want success %v", stored.Status, stored.OverallScore, tc.wantOverall)
+			}
+			if stored.Rationale != "correct" || stored.RecordID != target.RecordID || stored.EvaluatorID != evaluator.ID {
+				t.Fatalf("unexpected stored score: %+v", stored)
+			}
+		})
+	}
+
+	// 评审请求包含评分维度、参考输出和待评分回复
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.requests) != len(cases) {
+		t.Fatalf("provider received %d requests, want %d", len(stub.requests), len(cases))
+	}
+	req := stub.requests[0]
+	if req.Model != "judge-model" || len(req.Messages) != 2 {
+		t.Fatalf("unexpected judge request: %+v", req)
+	}
+	if !strings.Contains(req.Messages[0].Content, "correctness") || !strings.Contains(req.Messages[0].Content, "from 1 to 5") {
+		t.Fatalf("system prompt missing criteria or scale: %q", req.Messages[0].Content)
+	}
+	if !strings.Contains(req.Messages[1].Content, "## Reference answer\n4") || !strings.Contains(req.Messages[1].Content, "What is 2+2?") {
+		t.Fatalf("user prompt missing reference or conversation: %q", req.Messages[1].Content)
+	}
+}
+
+func TestJudgeEvaluatorsAreProjectScoped(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	evaluator := testJudgeEvaluator("stub")
+	evaluator.ProjectID = other.ID
+	if err := createJudgeEvaluator(evaluator); err != nil {
+		t.Fatalf("createJudgeEvaluator: %v", err)
+	}
+
+	path := "/api/judge-evaluators/" + evaluator.ID
+	if w := doJSON(t, r, http.MethodGet, path, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("get from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, path, map[string]string{"rubric": "changed"}, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("update from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, path, nil, map[string]string{ProjectHeader: "other"}); w.Code != http.StatusOK {
+		t.Fatalf("get from own project: status %d, want 200", w.Code)
+	}
+
+	w := doJSON(t, r, http.MethodGet, "/api/judge-evaluators", nil, nil)
+	var resp struct {
+		Data PaginatedResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if resp.Data.Total != 0 {
+		t.Fatalf("default project lists %d evaluators from another project", resp.Data.Total)
+	}
+}
@@ -24,11 +24,11 @@ func main() {
 	r := gin.Default()
 
 	// 配置CORS
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	r.Use(cors.New(config))
+	r.Use(cors.New(corsConfig(cfg)))
+
+	if !cfg.Auth.Enabled {
+		log.Printf("Warning: authentication is disabled, every API route is open (set auth.enabled to require API keys or login)")
+	}
 
 	// 设置路由
 	setupRoutes(r)
@@ -41,33 +41,208 @@ func main() {
 	}
 }
 
+// corsConfig 根据服务配置生成CORS配置
+func corsConfig(cfg *Config) cors.Config {
+	config := cors.DefaultConfig()
+	if len(cfg.Server.CORSOrigins) > 0 {
+		config.AllowOrigins = cfg.Server.CORSOrigins
+		// 指定来源时允许跨域请求携带登录Cookie
+		config.AllowCredentials = true
+	} else {
+		config.AllowAllOrigins = true
+	}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", ProjectHeader, APIKeyHeader}
+	return config
+}
+
 func setupRoutes(r *gin.Engine) {
-	// API路由组
+	// 登录接口，登录和退出不要求认证
+	account := r.Group("/api/auth")
+	{
+		account.POST("/login", handleLogin)
+		account.POST("/logout", handleLogout)
+		account.GET("/me", authMiddleware(), handleGetCurrentUser)
+		account.POST("/password", authMiddleware(), handleChangePassword)
+	}
+
+	// API路由组，启用认证时按路由分组校验API密钥或登录用户角色的权限
 	api := r.Group("/api")
+	api.Use(authMiddleware(), projectMiddleware())
+
+	// 数据上报接口（ingest）
+	ingest := api.Group("", requireScope(ScopeIngest))
 	{
 		// 埋点接口
-		api.POST("/trace", handleTrace)
+		ingest.POST("/trace", handleTrace)
 
+		// 终端用户反馈
+		ingest.POST("/feedback", handleIngestFeedback)
+	}
+
+	// 查询接口（read）
+	read := api.Group("", requireScope(ScopeRead))
+	{
 		// 会话管理（生产环境）
-		api.GET("/sessions", handleGetSessions)
-		api.GET("/sessions/:id/records", handleGetSessionRecords)
+		read.GET("/sessions", handleGetSessions)
+		read.GET("/sessions/:id/records", handleGetSessionRecords)
 
 		// 记录管理（生产环境）
-		api.POST("/records/:id/replay", handleReplayRecord)
-		api.DELETE("/records/:id", handleDeleteRecord)
+		read.GET("/records/:id/diff", handleDiffRecord)
+		read.GET("/records/:id/feedback", handleGetRecordFeedback)
 
 		// 重放会话管理（调试环境）
-		api.POST("/replay-sessions", handleCreateReplaySession)
-		api.GET("/replay-sessions", handleGetReplaySessions)
-		api.GET("/replay-sessions/:id", handleGetReplaySession)
-		api.GET("/replay-sessions/:id/records", handleGetReplaySessionRecords)
-		api.DELETE("/replay-sessions/:id", handleDeleteReplaySession)
+		read.GET("/replay-sessions", handleGetReplaySessions)
+		read.GET("/replay-sessions/:id", handleGetReplaySession)
+		read.GET("/replay-sessions/:id/records", handleGetReplaySessionRecords)
+		read.GET("/replay-sessions/:id/progress", handleGetReplaySessionProgress)
+		read.GET("/replay-sessions/:id/tree", handleGetReplaySessionTree)
+
+		// 多模型对比
+		read.GET("/comparison-groups/:id", handleGetComparisonGroup)
+
+		// 重放记录反馈
+		read.GET("/replay-records/:id/feedback", handleGetReplayRecordFeedback)
+
+		// 工具桩管理
+		read.GET("/tool-stubs", handleGetToolStubs)
+
+		// 评测数据集
+		read.GET("/datasets", handleGetDatasets)
+		read.GET("/datasets/:id", handleGetDataset)
+		read.GET("/datasets/:id/items", handleGetDatasetItems)
+		read.GET("/datasets/:id/versions", handleGetDatasetVersions)
+		read.GET("/datasets/:id/export", handleExportDataset)
+
+		// 实验运行
+		read.GET("/experiment-runs", handleGetExperimentRuns)
+		read.GET("/experiment-runs/:id", handleGetExperimentRun)
+		read.GET("/experiment-runs/:id/results", handleGetExperimentResults)
+		read.GET("/experiment-runs/:id/compare/:target_id", handleCompareExperimentRuns)
+
+		// 重放输出检查结果
+		read.GET("/assertion-results", handleGetAssertionResults)
+
+		// 评审模型评分
+		read.GET("/judge-evaluators", handleGetJudgeEvaluators)
+		read.GET("/judge-evaluators/:id", handleGetJudgeEvaluator)
+		read.GET("/judge-scores", handleGetJudgeScores)
+
+		// 人工反馈
+		read.GET("/feedback", handleGetFeedback)
+		read.GET("/feedback/summary", handleGetFeedbackSummary)
+
+		// 标签、收藏和备注
+		read.GET("/tags", handleGetTags)
+		read.GET("/tags/:id/assignments", handleGetTagAssignments)
+		for prefix, targetType := range tagTargetPrefixes {
+			read.GET(prefix+"/:id/tags", handleGetTargetTags(targetType))
+			read.GET(prefix+"/:id/notes", handleGetTargetNotes(targetType))
+		}
+
+		// 项目管理
+		read.GET("/projects", handleGetProjects)
+		read.GET("/projects/:id", handleGetProject)
+
+		// Provider管理
+		read.GET("/providers", handleGetProviders)
+	}
+
+	// 重放和修改调试数据的接口（debug），重放会产生provider调用费用
+	debug := api.Group("", requireScope(ScopeDebug))
+	{
+		// 会话管理（生产环境）
+		debug.PATCH("/sessions/:id", handleUpdateSession)
+		debug.POST("/sessions/:id/replay", handleReplaySession)
+
+		// 记录管理（生产环境）
+		debug.POST("/records/:id/replay", handleReplayRecord)
+		debug.POST("/records/:id/compare", handleCompareRecord)
+		debug.POST("/records/:id/feedback", handleCreateRecordFeedback)
+
+		// 重放会话管理（调试环境）
+		debug.POST("/replay-sessions", handleCreateReplaySession)
+		debug.PATCH("/replay-sessions/:id", handleUpdateReplaySession)
+		debug.POST("/replay-sessions/:id/complete", handleCompleteReplaySession)
+		debug.POST("/replay-sessions/:id/archive", handleArchiveReplaySession)
+		debug.POST("/replay-sessions/:id/clone", handleCloneReplaySession)
+		debug.POST("/replay-sessions/:id/cancel", handleCancelReplaySession)
 
 		// 调试重放
-		api.POST("/replay-debug", handleReplayDebug)
+		debug.POST("/replay-debug", handleReplayDebug)
+		debug.POST("/replay-debug/tool-results", handleSubmitToolResults)
+
+		// 重放分支
+		debug.POST("/replay-records/:id/fork", handleForkReplayRecord)
+
+		// 重放记录反馈
+		debug.POST("/replay-records/:id/feedback", handleCreateReplayRecordFeedback)
+
+		// 工具桩管理
+		debug.POST("/tool-stubs", handleCreateToolStub)
+		debug.DELETE("/tool-stubs/:id", handleDeleteToolStub)
+
+		// 评测数据集
+		debug.POST("/datasets", handleCreateDataset)
+		debug.PATCH("/datasets/:id", handleUpdateDataset)
+		debug.POST("/datasets/:id/items", handleAddDatasetItems)
+		debug.POST("/datasets/:id/versions", handleCreateDatasetVersion)
+		debug.PATCH("/dataset-items/:id", handleUpdateDatasetItem)
+
+		// 实验运行
+		debug.POST("/experiment-runs", handleCreateExperimentRun)
+		debug.POST("/experiment-runs/:id/cancel", handleCancelExperimentRun)
+
+		// 评审模型评分
+		debug.POST("/judge-evaluators", handleCreateJudgeEvaluator)
+		debug.PATCH("/judge-evaluators/:id", handleUpdateJudgeEvaluator)
+		debug.POST("/judge-evaluators/:id/evaluate", handleJudgeEvaluate)
+
+		// 人工反馈
+		debug.PATCH("/feedback/:id", handleUpdateFeedback)
+
+		// 标签、收藏和备注
+		debug.POST("/tags", handleCreateTag)
+		debug.PATCH("/tags/:id", handleUpdateTag)
+		for prefix, targetType := range tagTargetPrefixes {
+			debug.POST(prefix+"/:id/tags", handleAddTargetTags(targetType))
+			debug.DELETE(prefix+"/:id/tags/:tag_id", handleRemoveTargetTag(targetType))
+			debug.POST(prefix+"/:id/bookmark", handleBookmarkTarget(targetType))
+			debug.DELETE(prefix+"/:id/bookmark", handleRemoveBookmark(targetType))
+			debug.POST(prefix+"/:id/notes", handleCreateTargetNote(targetType))
+		}
+		debug.PATCH("/notes/:id", handleUpdateNote)
+		debug.DELETE("/notes/:id", handleDeleteNote)
+	}
 
-		// Provider管理
-		api.GET("/providers", handleGetProviders)
+	// 删除数据和管理接口（admin）
+	admin := api.Group("", requireScope(ScopeAdmin))
+	{
+		// 删除数据
+		admin.DELETE("/records/:id", handleDeleteRecord)
+		admin.DELETE("/replay-sessions/:id", handleDeleteReplaySession)
+		admin.DELETE("/datasets/:id", handleDeleteDataset)
+		admin.DELETE("/dataset-items/:id", handleDeleteDatasetItem)
+		admin.DELETE("/experiment-runs/:id", handleDeleteExperimentRun)
+		admin.DELETE("/judge-evaluators/:id", handleDeleteJudgeEvaluator)
+		admin.DELETE("/feedback/:id", handleDeleteFeedback)
+		admin.DELETE("/tags/:id", handleDeleteTag)
+
+		// 项目管理（需要不限定项目的密钥）
+		admin.POST("/projects", requireAllProjects(), handleCreateProject)
+		admin.PATCH("/projects/:id", requireAllProjects(), handleUpdateProject)
+		admin.DELETE("/projects/:id", requireAllProjects(), handleDeleteProject)
+
+		// API密钥管理
+		admin.POST("/api-keys", handleCreateAPIKey)
+		admin.GET("/api-keys", handleGetAPIKeys)
+		admin.DELETE("/api-keys/:id", handleDeleteAPIKey)
+
+		// 用户管理（需要不限定项目的密钥，登录用户不受项目限制）
+		admin.POST("/users", requireAllProjects(), handleCreateUser)
+		admin.GET("/users", requireAllProjects(), handleGetUsers)
+		admin.PATCH("/users/:id", requireAllProjects(), handleUpdateUser)
+		admin.DELETE("/users/:id", requireAllProjects(), handleDeleteUser)
 	}
 
 	// 健康检查
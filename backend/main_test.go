@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestEnv 使用临时SQLite数据库初始化全局配置和数据库，测试结束后恢复原配置
+func setupTestEnv(t *testing.T, cfg *Config) {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	cfg.Database = DatabaseConfig{
+		Driver: "sqlite",
+		DSN:    filepath.Join(t.TempDir(), "test.db"),
+	}
+
+	previous := config
+	config = cfg
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		config = previous
+	})
+
+	if err := initDatabase(); err != nil {
+		t.Fatalf("initDatabase: %v", err)
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+}
+
+// newTestRouter 创建注册了全部路由的Gin引擎
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	setupRoutes(r)
+	return r
+}
+
+// doJSON 发送JSON请求并返回响应
+func doJSON(t *testing.T, r http.Handler, method, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSPreflightAllowsPatch(t *testing.T) {
+	for _, origins := range [][]string{nil, {"http://localhost:3000"}} {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(cors.New(corsConfig(&Config{Server: ServerConfig{CORSOrigins: origins}})))
+		setupRoutes(r)
+
+		req := httptest.NewRequest(http.MethodOptions, "/api/replay-sessions/rs1", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent || !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), http.MethodPatch) {
+			t.Fatalf("origins %v: preflight status %d, allowed methods %q", origins, w.Code, w.Header().Get("Access-Control-Allow-Methods"))
+		}
+	}
+}
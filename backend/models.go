@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -52,20 +53,34 @@ func initDatabase() error {
 	}
 
 	// 自动迁移表结构
-	if err := db.AutoMigrate(&Session{}, &Record{}, &ReplaySession{}, &ReplayRecord{}); err != nil {
+	if err := db.AutoMigrate(&Project{}, &Session{}, &Record{}, &ReplaySession{}, &ReplayRecord{}, &ToolStub{}, &CachedResponse{}, &Dataset{}, &DatasetItem{}, &DatasetVersion{}, &ExperimentRun{}, &ExperimentResult{}, &AssertionResult{}, &JudgeEvaluator{}, &JudgeScore{}, &Feedback{}, &Tag{}, &TagAssignment{}, &Note{}, &APIKey{}, &User{}, &LoginSession{}); err != nil {
 		return fmt.Errorf("failed to migrate database: %v", err)
 	}
 
+	// 确保默认项目存在，未指定项目的数据都归属于默认项目
+	if err := ensureDefaultProject(); err != nil {
+		return err
+	}
+
+	// 上次进程退出时仍在运行的全量重放已经中断，不会再有进度更新
+	interrupted, err := failInterruptedReplaySessions()
+	if err != nil {
+		return err
+	}
+	if interrupted > 0 {
+		log.Printf("Marked %d interrupted session replays as failed", interrupted)
+	}
+
 	log.Printf("Database initialized successfully with driver: %s", cfg.Database.Driver)
 	return nil
 }
 
-// saveTraceData 保存埋点数据
-func saveTraceData(trace *TraceRequest) error {
+// saveTraceData 保存埋点数据，返回创建的记录
+func saveTraceData(trace *TraceRequest) (*Record, error) {
 	// 开始事务
 	tx := db.Begin()
 	if tx.Error != nil {
-		return tx.Error
+		return nil, tx.Error
 	}
 	defer func() {
 		if r := recover(); r != nil {
@@ -74,16 +89,16 @@ func saveTraceData(trace *TraceRequest) error {
 	}()
 
 	// 检查或创建会话
-	if err := ensureSession(tx, trace.SessionID); err != nil {
+	if err := ensureSession(tx, trace); err != nil {
 		tx.Rollback()
-		return err
+		return nil, err
 	}
 
 	// 序列化数据
 	requestJSON, err := json.Marshal(trace.Request)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	var responseJSON []byte
@@ -91,7 +106,7 @@ func saveTraceData(trace *TraceRequest) error {
 		responseJSON, err = json.Marshal(trace.Response)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to marshal response: %v", err)
+			return nil, fmt.Errorf("failed to marshal response: %v", err)
 		}
 	}
 
@@ -100,13 +115,14 @@ func saveTraceData(trace *TraceRequest) error {
 		metadataJSON, err = json.Marshal(trace.Metadata)
 		if err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to marshal metadata: %v", err)
+			return nil, fmt.Errorf("failed to marshal metadata: %v", err)
 		}
 	}
 
 	// 创建记录
 	record := &Record{
 		ID:         uuid.New().String(),
+		ProjectID:  trace.ProjectID,
 		SessionID:  trace.SessionID,
 		TurnNumber: trace.TurnNumber,
 		Request:    string(requestJSON),
@@ -114,50 +130,159 @@ func saveTraceData(trace *TraceRequest) error {
 		Status:     trace.Status,
 		ErrorMsg:   trace.ErrorMessage,
 		Metadata:   string(metadataJSON),
+		LatencyMs:  trace.LatencyMs,
+		Attempts:   trace.Attempts,
+	}
+
+	// 上报方未提供错误分类时，根据错误信息识别
+	record.ErrorCategory = trace.ErrorCategory
+	if record.ErrorCategory == "" && trace.Status == "error" {
+		record.ErrorCategory = classifyErrorMessage(trace.ErrorMessage)
 	}
 
 	if err := tx.Create(record).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to create record: %v", err)
+		return nil, fmt.Errorf("failed to create record: %v", err)
 	}
 
 	// 提交事务
-	return tx.Commit().Error
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return record, nil
 }
 
-// ensureSession 确保会话存在
-func ensureSession(tx *gorm.DB, sessionID string) error {
-	var count int64
-	if err := tx.Model(&Session{}).Where("id = ?", sessionID).Count(&count).Error; err != nil {
+// ensureSession 确保会话存在，并写入埋点数据携带的会话级字段
+func ensureSession(tx *gorm.DB, trace *TraceRequest) error {
+	var session Session
+	err := tx.Where("id = ?", trace.SessionID).First(&session).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
 		return fmt.Errorf("failed to check session: %v", err)
 	}
 
-	if count == 0 {
-		// 会话不存在，创建新会话
-		session := &Session{
-			ID:   sessionID,
-			Name: fmt.Sprintf("对话-%s", time.Now().Format("2006-01-02 15:04:05")),
+	if err == gorm.ErrRecordNotFound {
+		// 会话不存在，在埋点数据指定的项目中创建新会话
+		name := strings.TrimSpace(trace.SessionName)
+		if name == "" {
+			name = fmt.Sprintf("对话-%s", time.Now().Format("2006-01-02 15:04:05"))
+		}
+		session = Session{
+			ID:          trace.SessionID,
+			ProjectID:   trace.ProjectID,
+			Name:        name,
+			UserID:      trace.UserID,
+			AppName:     trace.AppName,
+			Environment: trace.Environment,
+			Version:     trace.Version,
+			Attributes:  trace.SessionAttributes,
 		}
-		if err := tx.Create(session).Error; err != nil {
+		if err := tx.Create(&session).Error; err != nil {
 			return fmt.Errorf("failed to create session: %v", err)
 		}
+		return nil
+	}
+
+	if session.ProjectID != trace.ProjectID {
+		return errSessionProjectMismatch
+	}
+
+	// 会话已存在，只补充为空的字段，不覆盖已有的值（包括通过接口修改的值）
+	changed := false
+	fillEmpty := func(field *string, value string) {
+		if *field == "" && value != "" {
+			*field = value
+			changed = true
+		}
+	}
+	fillEmpty(&session.UserID, trace.UserID)
+	fillEmpty(&session.AppName, trace.AppName)
+	fillEmpty(&session.Environment, trace.Environment)
+	fillEmpty(&session.Version, trace.Version)
+
+	for key, value := range trace.SessionAttributes {
+		if _, exists := session.Attributes[key]; exists {
+			continue
+		}
+		if session.Attributes == nil {
+			session.Attributes = make(map[string]interface{})
+		}
+		session.Attributes[key] = value
+		changed = true
+	}
+
+	if changed {
+		if err := tx.Save(&session).Error; err != nil {
+			return fmt.Errorf("failed to update session: %v", err)
+		}
 	}
 	return nil
 }
 
+// filterSessions 应用会话列表的过滤条件
+func filterSessions(tx *gorm.DB, filter SessionFilter) *gorm.DB {
+	if filter.ProjectID != "" {
+		tx = tx.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.Name != "" {
+		tx = tx.Where("name LIKE ?", "%"+filter.Name+"%")
+	}
+	if filter.UserID != "" {
+		tx = tx.Where("user_id = ?", filter.UserID)
+	}
+	if filter.AppName != "" {
+		tx = tx.Where("app_name = ?", filter.AppName)
+	}
+	if filter.Environment != "" {
+		tx = tx.Where("environment = ?", filter.Environment)
+	}
+	if filter.Version != "" {
+		tx = tx.Where("version = ?", filter.Version)
+	}
+	for key, value := range filter.Attributes {
+		tx = filterAttribute(tx, key, value)
+	}
+	return filterTagged(tx, filter.ProjectID, TagTargetSession, filter.Tags)
+}
+
+// filterAttribute 限定顶层属性等于指定值的会话，值可以是字符串或数字、布尔等字面量
+// 属性以JSON对象保存，按数据库各自的JSON函数取出顶层的值，键中不能包含双引号
+func filterAttribute(tx *gorm.DB, key string, value string) *gorm.DB {
+	path := `$."` + key + `"`
+	switch db.Dialector.Name() {
+	case "mysql":
+		return tx.Where("JSON_UNQUOTE(JSON_EXTRACT(attributes, ?)) = ?", path, value)
+	case "postgres":
+		return tx.Where("attributes::jsonb ->> ? = ?", key, value)
+	}
+	// SQLite 的 ->> 将布尔值取为 0/1，字符串以外的值按JSON文本比较
+	return tx.Where("(CASE json_type(attributes, ?) WHEN 'text' THEN attributes ->> ? ELSE attributes -> ? END) = ?", path, path, path, value)
+}
+
 // getSessions 获取会话列表
-func getSessions(page, size int) (*PaginatedResponse, error) {
+func getSessions(page, size int, filter SessionFilter) (*PaginatedResponse, error) {
 	var total int64
-	if err := db.Model(&Session{}).Count(&total).Error; err != nil {
+	if err := filterSessions(db.Model(&Session{}), filter).Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count sessions: %v", err)
 	}
 
 	var sessions []Session
 	offset := (page - 1) * size
-	if err := db.Order("created_at DESC").Offset(offset).Limit(size).Find(&sessions).Error; err != nil {
+	if err := filterSessions(db, filter).Order("created_at DESC").Offset(offset).Limit(size).Find(&sessions).Error; err != nil {
 		return nil, fmt.Errorf("failed to query sessions: %v", err)
 	}
 
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	tags, err := getTargetTags(TagTargetSession, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Tags = tags[sessions[i].ID]
+	}
+
 	totalPages := int((total + int64(size) - 1) / int64(size))
 
 	return &PaginatedResponse{
@@ -169,21 +294,42 @@ func getSessions(page, size int) (*PaginatedResponse, error) {
 	}, nil
 }
 
+// filterRecords 应用记录列表的过滤条件，对重放记录同样适用
+func filterRecords(tx *gorm.DB, filter RecordFilter) *gorm.DB {
+	if filter.ErrorCategory != "" {
+		tx = tx.Where("error_category = ?", filter.ErrorCategory)
+	}
+	return tx
+}
+
 // getSessionRecords 获取会话记录
-func getSessionRecords(sessionID string, page, size int) (*PaginatedResponse, error) {
+func getSessionRecords(sessionID string, page, size int, filter RecordFilter) (*PaginatedResponse, error) {
 	var total int64
-	if err := db.Model(&Record{}).Where("session_id = ?", sessionID).Count(&total).Error; err != nil {
+	if err := filterTagged(filterRecords(db.Model(&Record{}), filter), filter.ProjectID, TagTargetRecord, filter.Tags).
+		Where("session_id = ?", sessionID).Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count records: %v", err)
 	}
 
 	var records []Record
 	offset := (page - 1) * size
-	if err := db.Where("session_id = ?", sessionID).
+	if err := filterTagged(filterRecords(db, filter), filter.ProjectID, TagTargetRecord, filter.Tags).Where("session_id = ?", sessionID).
 		Order("turn_number ASC, created_at ASC").
 		Offset(offset).Limit(size).Find(&records).Error; err != nil {
 		return nil, fmt.Errorf("failed to query records: %v", err)
 	}
 
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	tags, err := getTargetTags(TagTargetRecord, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		records[i].Tags = tags[records[i].ID]
+	}
+
 	totalPages := int((total + int64(size) - 1) / int64(size))
 
 	return &PaginatedResponse{
@@ -195,6 +341,17 @@ func getSessionRecords(sessionID string, page, size int) (*PaginatedResponse, er
 	}, nil
 }
 
+// getAllSessionRecords 获取会话的全部记录（按轮次排序）
+func getAllSessionRecords(sessionID string) ([]Record, error) {
+	var records []Record
+	if err := db.Where("session_id = ?", sessionID).
+		Order("turn_number ASC, created_at ASC").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query records: %v", err)
+	}
+	return records, nil
+}
+
 // getRecord 获取单条记录
 func getRecord(recordID string) (*Record, error) {
 	var record Record
@@ -207,29 +364,48 @@ func getRecord(recordID string) (*Record, error) {
 	return &record, nil
 }
 
-// deleteRecord 删除记录
+// deleteRecord 删除记录及其标签关联和备注
 func deleteRecord(recordID string) error {
-	result := db.Where("id = ?", recordID).Delete(&Record{})
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	result := tx.Where("id = ?", recordID).Delete(&Record{})
 	if result.Error != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to delete record: %v", result.Error)
 	}
 	if result.RowsAffected == 0 {
+		tx.Rollback()
 		return fmt.Errorf("record not found")
 	}
-	return nil
+	if err := deleteTargetAnnotations(tx, TagTargetRecord, recordID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
 }
 
 // createReplaySession 创建重放会话
-func createReplaySession(req *CreateReplaySessionRequest) (*ReplaySession, error) {
-	// 检查原始会话是否存在
+func createReplaySession(projectID string, req *CreateReplaySessionRequest) (*ReplaySession, error) {
+	// 检查原始会话是否存在于项目中
 	var originalSession Session
-	if err := db.Where("id = ?", req.OriginalSessionID).First(&originalSession).Error; err != nil {
+	if err := db.Where("id = ? AND project_id = ?", req.OriginalSessionID, projectID).First(&originalSession).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("original session not found")
 		}
 		return nil, fmt.Errorf("failed to check original session: %v", err)
 	}
 
+	// 快照起始轮次之前的对话历史，作为调试的基础上下文
+	records, err := getAllSessionRecords(req.OriginalSessionID)
+	if err != nil {
+		return nil, err
+	}
+
 	// 生成会话名称
 	sessionName := req.Name
 	if sessionName == "" {
@@ -239,10 +415,90 @@ func createReplaySession(req *CreateReplaySessionRequest) (*ReplaySession, error
 	// 创建重放会话
 	replaySession := &ReplaySession{
 		ID:                uuid.New().String(),
+		ProjectID:         originalSession.ProjectID,
 		Name:              sessionName,
 		OriginalSessionID: req.OriginalSessionID,
 		StartTurnNumber:   req.StartTurnNumber,
 		Status:            "active",
+		BaseContext:       snapshotBaseContext(records, req.StartTurnNumber),
+	}
+
+	if err := db.Create(replaySession).Error; err != nil {
+		return nil, fmt.Errorf("failed to create replay session: %v", err)
+	}
+
+	return replaySession, nil
+}
+
+// createFullReplaySession 为全量会话重放创建重放会话
+func createFullReplaySession(originalSession *Session, name string, mode string, records []Record) (*ReplaySession, error) {
+	if name == "" {
+		name = fmt.Sprintf("全量重放-%s", originalSession.Name)
+	}
+
+	replaySession := &ReplaySession{
+		ID:                uuid.New().String(),
+		ProjectID:         originalSession.ProjectID,
+		Name:              name,
+		OriginalSessionID: originalSession.ID,
+		StartTurnNumber:   records[0].TurnNumber,
+		Status:            "running",
+		Mode:              mode,
+		TotalTurns:        len(records),
+	}
+
+	if err := db.Create(replaySession).Error; err != nil {
+		return nil, fmt.Errorf("failed to create replay session: %v", err)
+	}
+
+	return replaySession, nil
+}
+
+// updateReplaySessionProgress 更新全量重放进度
+func updateReplaySessionProgress(sessionID string, completed int, failed int) error {
+	if err := db.Model(&ReplaySession{}).Where("id = ?", sessionID).
+		Updates(map[string]interface{}{"completed_turns": completed, "failed_turns": failed}).Error; err != nil {
+		return fmt.Errorf("failed to update replay session progress: %v", err)
+	}
+	return nil
+}
+
+// getSession 获取单个会话
+func getSession(sessionID string) (*Session, error) {
+	var session Session
+	if err := db.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session: %v", err)
+	}
+	return &session, nil
+}
+
+// saveSession 保存会话的修改
+func saveSession(session *Session) error {
+	if err := db.Save(session).Error; err != nil {
+		return fmt.Errorf("failed to save session: %v", err)
+	}
+	return nil
+}
+
+// forkReplaySession 从重放记录创建分支重放会话
+func forkReplaySession(parentSession *ReplaySession, parentRecord *ReplayRecord, name string) (*ReplaySession, error) {
+	if name == "" {
+		name = fmt.Sprintf("%s-分支-轮次%d", parentSession.Name, parentRecord.TurnNumber)
+	}
+
+	replaySession := &ReplaySession{
+		ID:                    uuid.New().String(),
+		ProjectID:             parentSession.ProjectID,
+		Name:                  name,
+		OriginalSessionID:     parentSession.OriginalSessionID,
+		StartTurnNumber:       parentRecord.TurnNumber,
+		Status:                "active",
+		ParentReplaySessionID: parentSession.ID,
+		ParentReplayRecordID:  parentRecord.ID,
+		BaseContext:           conversationWithResponse(parentRecord.Request, parentRecord.Response),
 	}
 
 	if err := db.Create(replaySession).Error; err != nil {
@@ -252,19 +508,80 @@ func createReplaySession(req *CreateReplaySessionRequest) (*ReplaySession, error
 	return replaySession, nil
 }
 
+// getChildReplaySessions 获取多个重放会话的直接分支
+func getChildReplaySessions(parentIDs []string) ([]ReplaySession, error) {
+	var children []ReplaySession
+	if err := db.Where("parent_replay_session_id IN ?", parentIDs).
+		Order("created_at ASC").
+		Find(&children).Error; err != nil {
+		return nil, fmt.Errorf("failed to query child replay sessions: %v", err)
+	}
+	return children, nil
+}
+
+// getReplayRecordSummaries 获取多个重放会话的记录摘要，按会话分组
+func getReplayRecordSummaries(sessionIDs []string) (map[string][]ReplayRecordSummary, error) {
+	var replayRecords []ReplayRecord
+	if err := db.Select("id", "replay_session_id", "turn_number", "status", "provider", "model", "created_at").
+		Where("replay_session_id IN ?", sessionIDs).
+		Order("turn_number ASC, created_at ASC").
+		Find(&replayRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to query replay records: %v", err)
+	}
+
+	summaries := make(map[string][]ReplayRecordSummary)
+	for _, replayRecord := range replayRecords {
+		summaries[replayRecord.ReplaySessionID] = append(summaries[replayRecord.ReplaySessionID], ReplayRecordSummary{
+			ID:         replayRecord.ID,
+			TurnNumber: replayRecord.TurnNumber,
+			Status:     replayRecord.Status,
+			Provider:   replayRecord.Provider,
+			Model:      replayRecord.Model,
+			CreatedAt:  replayRecord.CreatedAt,
+		})
+	}
+	return summaries, nil
+}
+
+// filterReplaySessions 应用重放会话列表的过滤条件
+func filterReplaySessions(tx *gorm.DB, filter ReplaySessionFilter) *gorm.DB {
+	if filter.ProjectID != "" {
+		tx = tx.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.OriginalSessionID != "" {
+		tx = tx.Where("original_session_id = ?", filter.OriginalSessionID)
+	}
+	if filter.Status != "" {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+	return filterTagged(tx, filter.ProjectID, TagTargetReplaySession, filter.Tags)
+}
+
 // getReplaySessions 获取重放会话列表
-func getReplaySessions(page, size int) (*PaginatedResponse, error) {
+func getReplaySessions(page, size int, filter ReplaySessionFilter) (*PaginatedResponse, error) {
 	var total int64
-	if err := db.Model(&ReplaySession{}).Count(&total).Error; err != nil {
+	if err := filterReplaySessions(db.Model(&ReplaySession{}), filter).Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count replay sessions: %v", err)
 	}
 
 	var replaySessions []ReplaySession
 	offset := (page - 1) * size
-	if err := db.Order("created_at DESC").Offset(offset).Limit(size).Find(&replaySessions).Error; err != nil {
+	if err := filterReplaySessions(db, filter).Order("created_at DESC").Offset(offset).Limit(size).Find(&replaySessions).Error; err != nil {
 		return nil, fmt.Errorf("failed to query replay sessions: %v", err)
 	}
 
+	ids := make([]string, len(replaySessions))
+	for i, replaySession := range replaySessions {
+		ids[i] = replaySession.ID
+	}
+	tags, err := getTargetTags(TagTargetReplaySession, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range replaySessions {
+		replaySessions[i].Tags = tags[replaySessions[i].ID]
+	}
+
 	totalPages := int((total + int64(size) - 1) / int64(size))
 
 	return &PaginatedResponse{
@@ -289,15 +606,15 @@ func getReplaySession(sessionID string) (*ReplaySession, error) {
 }
 
 // getReplaySessionRecords 获取重放会话记录
-func getReplaySessionRecords(sessionID string, page, size int) (*PaginatedResponse, error) {
+func getReplaySessionRecords(sessionID string, page, size int, filter RecordFilter) (*PaginatedResponse, error) {
 	var total int64
-	if err := db.Model(&ReplayRecord{}).Where("replay_session_id = ?", sessionID).Count(&total).Error; err != nil {
+	if err := filterRecords(db.Model(&ReplayRecord{}), filter).Where("replay_session_id = ?", sessionID).Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count replay records: %v", err)
 	}
 
 	var replayRecords []ReplayRecord
 	offset := (page - 1) * size
-	if err := db.Where("replay_session_id = ?", sessionID).
+	if err := filterRecords(db, filter).Where("replay_session_id = ?", sessionID).
 		Order("turn_number ASC, created_at ASC").
 		Offset(offset).Limit(size).Find(&replayRecords).Error; err != nil {
 		return nil, fmt.Errorf("failed to query replay records: %v", err)
@@ -314,32 +631,56 @@ func getReplaySessionRecords(sessionID string, page, size int) (*PaginatedRespon
 	}, nil
 }
 
-// saveReplayRecord 保存重放记录
-func saveReplayRecord(replaySessionID string, turnNumber int, request interface{}, response interface{}, status string, errorMsg string, provider string, model string, config interface{}) error {
+// getAllReplaySessionRecords 获取重放会话的全部记录（按轮次排序）
+func getAllReplaySessionRecords(sessionID string) ([]ReplayRecord, error) {
+	var replayRecords []ReplayRecord
+	if err := db.Where("replay_session_id = ?", sessionID).
+		Order("turn_number ASC, created_at ASC").
+		Find(&replayRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to query replay records: %v", err)
+	}
+	return replayRecords, nil
+}
+
+// getReplayRecordsByOriginal 获取某条原始记录的全部重放记录
+func getReplayRecordsByOriginal(recordID string) ([]ReplayRecord, error) {
+	var replayRecords []ReplayRecord
+	if err := db.Where("original_record_id = ?", recordID).
+		Order("created_at ASC").
+		Find(&replayRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to query replay records: %v", err)
+	}
+	return replayRecords, nil
+}
+
+// getComparisonGroupRecords 获取多模型对比分组的全部重放记录
+func getComparisonGroupRecords(groupID string) ([]ReplayRecord, error) {
+	var replayRecords []ReplayRecord
+	if err := db.Where("comparison_group_id = ?", groupID).
+		Order("created_at ASC").
+		Find(&replayRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to query comparison records: %v", err)
+	}
+	return replayRecords, nil
+}
+
+// buildReplayRecord 序列化请求、响应和配置，构造重放记录
+func buildReplayRecord(replaySessionID string, turnNumber int, request interface{}, response interface{}, status string, errorMsg string, provider string, model string, config *ReplayConfig) (*ReplayRecord, error) {
 	// 序列化数据
 	requestJSON, err := json.Marshal(request)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %v", err)
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	var responseJSON []byte
 	if response != nil {
 		responseJSON, err = json.Marshal(response)
 		if err != nil {
-			return fmt.Errorf("failed to marshal response: %v", err)
-		}
-	}
-
-	var configJSON []byte
-	if config != nil {
-		configJSON, err = json.Marshal(config)
-		if err != nil {
-			return fmt.Errorf("failed to marshal config: %v", err)
+			return nil, fmt.Errorf("failed to marshal response: %v", err)
 		}
 	}
 
-	// 创建重放记录
-	replayRecord := &ReplayRecord{
+	return &ReplayRecord{
 		ID:              uuid.New().String(),
 		ReplaySessionID: replaySessionID,
 		TurnNumber:      turnNumber,
@@ -349,52 +690,1809 @@ func saveReplayRecord(replaySessionID string, turnNumber int, request interface{
 		ErrorMsg:        errorMsg,
 		Provider:        provider,
 		Model:           model,
-		Config:          string(configJSON),
-	}
+		Config:          config,
+	}, nil
+}
 
+// saveReplayRecord 保存重放记录
+func saveReplayRecord(replayRecord *ReplayRecord) error {
 	if err := db.Create(replayRecord).Error; err != nil {
 		return fmt.Errorf("failed to create replay record: %v", err)
 	}
-
 	return nil
 }
 
-// updateReplaySessionStatus 更新重放会话状态
-func updateReplaySessionStatus(sessionID string, status string) error {
-	result := db.Model(&ReplaySession{}).Where("id = ?", sessionID).Update("status", status)
-	if result.Error != nil {
-		return fmt.Errorf("failed to update replay session status: %v", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("replay session not found")
+// getReplayRecord 获取单条重放记录
+func getReplayRecord(recordID string) (*ReplayRecord, error) {
+	var replayRecord ReplayRecord
+	if err := db.Where("id = ?", recordID).First(&replayRecord).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get replay record: %v", err)
 	}
-	return nil
+	return &replayRecord, nil
 }
 
-// deleteReplaySession 删除重放会话
-func deleteReplaySession(sessionID string) error {
+// saveContinuedReplayRecord 在同一事务中保存工具往返的新重放记录，并为上一条等待中的记录写入工具结果
+func saveContinuedReplayRecord(replayRecord *ReplayRecord, toolResults string) error {
 	// 开始事务
 	tx := db.Begin()
 	if tx.Error != nil {
 		return tx.Error
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
 
-	// 删除相关的重放记录
-	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&ReplayRecord{}).Error; err != nil {
+	result := tx.Model(&ReplayRecord{}).
+		Where("id = ? AND status = ?", replayRecord.ContinuedFromID, ReplayStatusToolPending).
+		Updates(map[string]interface{}{"status": "success", "tool_results": toolResults})
+	if result.Error != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to delete replay records: %v", err)
+		return fmt.Errorf("failed to update replay record: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("replay record is not waiting for tool results")
 	}
 
-	// 删除重放会话
-	if err := tx.Where("id = ?", sessionID).Delete(&ReplaySession{}).Error; err != nil {
+	if err := tx.Create(replayRecord).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to delete replay session: %v", err)
+		return fmt.Errorf("failed to create replay record: %v", err)
 	}
 
 	return tx.Commit().Error
 }
+
+// failReplayRecord 将重放记录标记为失败
+func failReplayRecord(recordID string, errorMsg string) error {
+	if err := db.Model(&ReplayRecord{}).Where("id = ?", recordID).
+		Updates(map[string]interface{}{"status": "error", "error_msg": errorMsg}).Error; err != nil {
+		return fmt.Errorf("failed to update replay record: %v", err)
+	}
+	return nil
+}
+
+// flagUnmatchedToolCalls 标记没有录制结果可匹配的工具调用
+func flagUnmatchedToolCalls(recordID string, unmatched string) error {
+	if err := db.Model(&ReplayRecord{}).Where("id = ?", recordID).
+		Update("unmatched_tool_calls", unmatched).Error; err != nil {
+		return fmt.Errorf("failed to flag unmatched tool calls: %v", err)
+	}
+	return nil
+}
+
+// createToolStub 在项目中注册工具桩
+func createToolStub(projectID string, req *CreateToolStubRequest) (*ToolStub, error) {
+	responseJSON := req.Response
+	if responseJSON == "" && req.ResponseJSON != nil {
+		b, err := json.Marshal(req.ResponseJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal stub response: %v", err)
+		}
+		responseJSON = string(b)
+	}
+
+	stub := &ToolStub{
+		ID:              uuid.New().String(),
+		ProjectID:       projectID,
+		ReplaySessionID: req.ReplaySessionID,
+		ToolName:        req.ToolName,
+		Response:        responseJSON,
+	}
+	if err := db.Create(stub).Error; err != nil {
+		return nil, fmt.Errorf("failed to create tool stub: %v", err)
+	}
+	return stub, nil
+}
+
+// getToolStubs 获取项目中重放会话可用的工具桩（含项目内的全局工具桩）
+func getToolStubs(projectID string, replaySessionID string) ([]ToolStub, error) {
+	var stubs []ToolStub
+	query := db.Where("project_id = ?", projectID)
+	if replaySessionID != "" {
+		query = query.Where("replay_session_id = ? OR replay_session_id = ''", replaySessionID)
+	} else {
+		query = query.Where("replay_session_id = ''")
+	}
+	if err := query.Order("created_at ASC").Find(&stubs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tool stubs: %v", err)
+	}
+	return stubs, nil
+}
+
+// getToolStub 获取单个工具桩
+func getToolStub(stubID string) (*ToolStub, error) {
+	var stub ToolStub
+	if err := db.Where("id = ?", stubID).First(&stub).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tool stub: %v", err)
+	}
+	return &stub, nil
+}
+
+// deleteToolStub 删除工具桩
+func deleteToolStub(stubID string) error {
+	result := db.Where("id = ?", stubID).Delete(&ToolStub{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete tool stub: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("tool stub not found")
+	}
+	return nil
+}
+
+// getCachedResponse 获取未过期的缓存响应
+func getCachedResponse(key string) (*CachedResponse, error) {
+	var entry CachedResponse
+	if err := db.Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&entry).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get cached response: %v", err)
+	}
+	return &entry, nil
+}
+
+// touchCachedResponse 记录一次缓存命中
+func touchCachedResponse(key string) error {
+	if err := db.Model(&CachedResponse{}).Where("cache_key = ?", key).Updates(map[string]interface{}{
+		"hit_count":   gorm.Expr("hit_count + 1"),
+		"last_hit_at": time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update cached response: %v", err)
+	}
+	return nil
+}
+
+// saveCachedResponse 写入缓存响应，已存在（如已过期）的同键条目会被覆盖
+func saveCachedResponse(entry *CachedResponse) error {
+	if err := db.Save(entry).Error; err != nil {
+		return fmt.Errorf("failed to save cached response: %v", err)
+	}
+	return nil
+}
+
+// pruneCachedResponses 删除过期的缓存响应，并在超出条数上限时淘汰最久未命中的条目
+func pruneCachedResponses(maxEntries int) error {
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&CachedResponse{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired cached responses: %v", err)
+	}
+
+	var total int64
+	if err := db.Model(&CachedResponse{}).Count(&total).Error; err != nil {
+		return fmt.Errorf("failed to count cached responses: %v", err)
+	}
+	if total <= int64(maxEntries) {
+		return nil
+	}
+
+	var keys []string
+	if err := db.Model(&CachedResponse{}).Order("last_hit_at ASC").Limit(int(total)-maxEntries).Pluck("cache_key", &keys).Error; err != nil {
+		return fmt.Errorf("failed to query cached responses: %v", err)
+	}
+	if err := db.Where("cache_key IN ?", keys).Delete(&CachedResponse{}).Error; err != nil {
+		return fmt.Errorf("failed to evict cached responses: %v", err)
+	}
+	return nil
+}
+
+// updateReplaySessionStatus 更新重放会话状态
+func updateReplaySessionStatus(sessionID string, status string) error {
+	result := db.Model(&ReplaySession{}).Where("id = ?", sessionID).Update("status", status)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update replay session status: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("replay session not found")
+	}
+	return nil
+}
+
+// failInterruptedReplaySessions 将仍处于running状态的全量重放标记为失败，返回更新的数量
+func failInterruptedReplaySessions() (int64, error) {
+	result := db.Model(&ReplaySession{}).Where("status = ?", "running").Update("status", "failed")
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to update interrupted replay sessions: %v", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// updateReplaySession 更新重放会话的指定字段
+func updateReplaySession(sessionID string, updates map[string]interface{}) error {
+	result := db.Model(&ReplaySession{}).Where("id = ?", sessionID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update replay session: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("replay session not found")
+	}
+	return nil
+}
+
+// cloneReplaySession 复制重放会话及其重放记录和工具桩
+func cloneReplaySession(source *ReplaySession, name string) (*ReplaySession, error) {
+	if name == "" {
+		name = fmt.Sprintf("%s-副本", source.Name)
+	}
+
+	replaySession := *source
+	replaySession.ID = uuid.New().String()
+	replaySession.Name = name
+	replaySession.Status = "active"
+	replaySession.Conclusion = ""
+	replaySession.CreatedAt = time.Time{}
+	replaySession.UpdatedAt = time.Time{}
+
+	var replayRecords []ReplayRecord
+	if err := db.Where("replay_session_id = ?", source.ID).
+		Order("turn_number ASC, created_at ASC").
+		Find(&replayRecords).Error; err != nil {
+		return nil, fmt.Errorf("failed to query replay records: %v", err)
+	}
+
+	var toolStubs []ToolStub
+	if err := db.Where("replay_session_id = ?", source.ID).Find(&toolStubs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tool stubs: %v", err)
+	}
+
+	// 记录之间的引用和对比分组改为指向副本
+	recordIDs := make(map[string]string, len(replayRecords))
+	groupIDs := make(map[string]string)
+	for _, replayRecord := range replayRecords {
+		recordIDs[replayRecord.ID] = uuid.New().String()
+		if replayRecord.ComparisonGroupID != "" && groupIDs[replayRecord.ComparisonGroupID] == "" {
+			groupIDs[replayRecord.ComparisonGroupID] = uuid.New().String()
+		}
+	}
+	for i := range replayRecords {
+		replayRecords[i].ID = recordIDs[replayRecords[i].ID]
+		replayRecords[i].ReplaySessionID = replaySession.ID
+		if replayRecords[i].ContinuedFromID != "" {
+			replayRecords[i].ContinuedFromID = recordIDs[replayRecords[i].ContinuedFromID]
+		}
+		if replayRecords[i].ComparisonGroupID != "" {
+			replayRecords[i].ComparisonGroupID = groupIDs[replayRecords[i].ComparisonGroupID]
+		}
+	}
+	for i := range toolStubs {
+		toolStubs[i].ID = uuid.New().String()
+		toolStubs[i].ReplaySessionID = replaySession.ID
+		toolStubs[i].CreatedAt = time.Time{}
+	}
+
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	if err := tx.Create(&replaySession).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create replay session: %v", err)
+	}
+
+	if len(replayRecords) > 0 {
+		if err := tx.Create(&replayRecords).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to copy replay records: %v", err)
+		}
+	}
+
+	if len(toolStubs) > 0 {
+		if err := tx.Create(&toolStubs).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to copy tool stubs: %v", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return &replaySession, nil
+}
+
+// deleteReplaySession 删除重放会话
+func deleteReplaySession(sessionID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 删除相关的重放记录和工具桩
+	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&ToolStub{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete tool stubs: %v", err)
+	}
+	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&ReplayRecord{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete replay records: %v", err)
+	}
+	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&AssertionResult{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete assertion results: %v", err)
+	}
+	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&JudgeScore{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete judge scores: %v", err)
+	}
+	if err := tx.Where("replay_session_id = ?", sessionID).Delete(&Feedback{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete feedback: %v", err)
+	}
+	if err := deleteTargetAnnotations(tx, TagTargetReplaySession, sessionID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// 分支会话脱离被删除的父会话，成为独立的根会话
+	if err := tx.Model(&ReplaySession{}).Where("parent_replay_session_id = ?", sessionID).
+		Updates(map[string]interface{}{"parent_replay_session_id": "", "parent_replay_record_id": ""}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to detach child replay sessions: %v", err)
+	}
+
+	// 删除重放会话
+	if err := tx.Where("id = ?", sessionID).Delete(&ReplaySession{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete replay session: %v", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// createDataset 创建数据集
+func createDataset(projectID string, req *CreateDatasetRequest) (*Dataset, error) {
+	dataset := &Dataset{
+		ID:          uuid.New().String(),
+		ProjectID:   projectID,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := db.Create(dataset).Error; err != nil {
+		return nil, fmt.Errorf("failed to create dataset: %v", err)
+	}
+	return dataset, nil
+}
+
+// countDatasetItems 统计数据集的条目数
+func countDatasetItems(datasetIDs []string) (map[string]int64, error) {
+	var rows []struct {
+		DatasetID string
+		Count     int64
+	}
+	if err := db.Model(&DatasetItem{}).Select("dataset_id, COUNT(*) AS count").
+		Where("dataset_id IN ?", datasetIDs).Group("dataset_id").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count dataset items: %v", err)
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.DatasetID] = row.Count
+	}
+	return counts, nil
+}
+
+// getDatasets 获取数据集列表
+func getDatasets(projectID string, page, size int) (*PaginatedResponse, error) {
+	var total int64
+	if err := db.Model(&Dataset{}).Where("project_id = ?", projectID).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count datasets: %v", err)
+	}
+
+	var datasets []Dataset
+	offset := (page - 1) * size
+	if err := db.Where("project_id = ?", projectID).Order("created_at DESC").Offset(offset).Limit(size).Find(&datasets).Error; err != nil {
+		return nil, fmt.Errorf("failed to query datasets: %v", err)
+	}
+
+	if len(datasets) > 0 {
+		ids := make([]string, len(datasets))
+		for i, dataset := range datasets {
+			ids[i] = dataset.ID
+		}
+		counts, err := countDatasetItems(ids)
+		if err != nil {
+			return nil, err
+		}
+		for i := range datasets {
+			datasets[i].ItemCount = counts[datasets[i].ID]
+		}
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       datasets,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getDataset 获取单个数据集
+func getDataset(datasetID string) (*Dataset, error) {
+	var dataset Dataset
+	if err := db.Where("id = ?", datasetID).First(&dataset).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get dataset: %v", err)
+	}
+
+	counts, err := countDatasetItems([]string{datasetID})
+	if err != nil {
+		return nil, err
+	}
+	dataset.ItemCount = counts[datasetID]
+	return &dataset, nil
+}
+
+// updateDataset 更新数据集的指定字段
+func updateDataset(datasetID string, updates map[string]interface{}) error {
+	result := db.Model(&Dataset{}).Where("id = ?", datasetID).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update dataset: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("dataset not found")
+	}
+	return nil
+}
+
+// deleteDataset 删除数据集及其条目和版本
+func deleteDataset(datasetID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("dataset_id = ?", datasetID).Delete(&DatasetItem{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete dataset items: %v", err)
+	}
+	if err := tx.Where("dataset_id = ?", datasetID).Delete(&DatasetVersion{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete dataset versions: %v", err)
+	}
+	if err := tx.Where("id = ?", datasetID).Delete(&Dataset{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete dataset: %v", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// findRecords 按条件查询项目中的调用记录（按时间排序，最多limit条）
+func findRecords(projectID string, filter DatasetRecordFilter, limit int) ([]Record, error) {
+	query := db.Model(&Record{}).Where("project_id = ?", projectID)
+	if filter.SessionID != "" {
+		query = query.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ErrorCategory != "" {
+		query = query.Where("error_category = ?", filter.ErrorCategory)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+
+	var records []Record
+	if err := query.Order("created_at ASC, turn_number ASC").Limit(limit).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query records: %v", err)
+	}
+	return records, nil
+}
+
+// getRecordsByIDs 按ID查询项目中的调用记录，保持传入的顺序，不存在的ID被忽略
+func getRecordsByIDs(projectID string, recordIDs []string) ([]Record, error) {
+	var found []Record
+	if err := db.Where("id IN ? AND project_id = ?", recordIDs, projectID).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed to query records: %v", err)
+	}
+
+	byID := make(map[string]Record, len(found))
+	for _, record := range found {
+		byID[record.ID] = record
+	}
+	records := make([]Record, 0, len(recordIDs))
+	for _, id := range recordIDs {
+		if record, ok := byID[id]; ok {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// getDatasetSourceRecordIDs 获取数据集中已有条目的来源记录
+func getDatasetSourceRecordIDs(datasetID string) (map[string]bool, error) {
+	var recordIDs []string
+	if err := db.Model(&DatasetItem{}).Where("dataset_id = ?", datasetID).
+		Pluck("source_record_id", &recordIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dataset items: %v", err)
+	}
+
+	existing := make(map[string]bool, len(recordIDs))
+	for _, id := range recordIDs {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// createDatasetItems 批量创建数据集条目，条目按传入顺序排在数据集末尾
+func createDatasetItems(datasetID string, items []DatasetItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var lastPosition int
+	if err := db.Model(&DatasetItem{}).Where("dataset_id = ?", datasetID).
+		Select("COALESCE(MAX(position), 0)").Scan(&lastPosition).Error; err != nil {
+		return fmt.Errorf("failed to query dataset items: %v", err)
+	}
+	for i := range items {
+		items[i].Position = lastPosition + i + 1
+	}
+
+	if err := db.Create(&items).Error; err != nil {
+		return fmt.Errorf("failed to create dataset items: %v", err)
+	}
+	return nil
+}
+
+// getDatasetItems 分页获取数据集条目
+func getDatasetItems(datasetID string, page, size int) (*PaginatedResponse, error) {
+	var total int64
+	if err := db.Model(&DatasetItem{}).Where("dataset_id = ?", datasetID).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count dataset items: %v", err)
+	}
+
+	var items []DatasetItem
+	offset := (page - 1) * size
+	if err := db.Where("dataset_id = ?", datasetID).
+		Order("position ASC").
+		Offset(offset).Limit(size).Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dataset items: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       items,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getAllDatasetItems 获取数据集的全部条目
+func getAllDatasetItems(datasetID string) ([]DatasetItem, error) {
+	var items []DatasetItem
+	if err := db.Where("dataset_id = ?", datasetID).
+		Order("position ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dataset items: %v", err)
+	}
+	return items, nil
+}
+
+// getDatasetItem 获取单个数据集条目
+func getDatasetItem(itemID string) (*DatasetItem, error) {
+	var item DatasetItem
+	if err := db.Where("id = ?", itemID).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get dataset item: %v", err)
+	}
+	return &item, nil
+}
+
+// saveDatasetItem 保存编辑后的数据集条目
+func saveDatasetItem(item *DatasetItem) error {
+	if err := db.Save(item).Error; err != nil {
+		return fmt.Errorf("failed to save dataset item: %v", err)
+	}
+	return nil
+}
+
+// deleteDatasetItem 删除数据集条目
+func deleteDatasetItem(itemID string) error {
+	result := db.Where("id = ?", itemID).Delete(&DatasetItem{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete dataset item: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("dataset item not found")
+	}
+	return nil
+}
+
+// createDatasetVersion 将数据集当前的条目发布为新版本
+func createDatasetVersion(dataset *Dataset, note string) (*DatasetVersion, error) {
+	items, err := getAllDatasetItems(dataset.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+
+	// 在事务内重新读取版本号，避免并发发布时版本号重复
+	var current Dataset
+	if err := tx.Where("id = ?", dataset.ID).First(&current).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to get dataset: %v", err)
+	}
+
+	version := &DatasetVersion{
+		ID:        uuid.New().String(),
+		DatasetID: dataset.ID,
+		Version:   current.Version + 1,
+		Note:      note,
+		ItemCount: len(items),
+		Items:     items,
+	}
+	if err := tx.Create(version).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create dataset version: %v", err)
+	}
+
+	if err := tx.Model(&Dataset{}).Where("id = ?", dataset.ID).Update("version", version.Version).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update dataset version: %v", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// getDatasetVersions 获取数据集的版本列表（不含条目快照）
+func getDatasetVersions(datasetID string) ([]DatasetVersion, error) {
+	var versions []DatasetVersion
+	if err := db.Omit("items").Where("dataset_id = ?", datasetID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to query dataset versions: %v", err)
+	}
+	return versions, nil
+}
+
+// getDatasetVersion 获取数据集的指定版本
+func getDatasetVersion(datasetID string, version int) (*DatasetVersion, error) {
+	var datasetVersion DatasetVersion
+	if err := db.Where("dataset_id = ? AND version = ?", datasetID, version).First(&datasetVersion).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get dataset version: %v", err)
+	}
+	return &datasetVersion, nil
+}
+
+// createExperimentRun 创建实验运行
+func createExperimentRun(run *ExperimentRun) error {
+	if err := db.Create(run).Error; err != nil {
+		return fmt.Errorf("failed to create experiment run: %v", err)
+	}
+	return nil
+}
+
+// filterExperimentRuns 应用实验运行列表的过滤条件
+func filterExperimentRuns(tx *gorm.DB, filter ExperimentRunFilter) *gorm.DB {
+	if filter.ProjectID != "" {
+		tx = tx.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.DatasetID != "" {
+		tx = tx.Where("dataset_id = ?", filter.DatasetID)
+	}
+	if filter.Status != "" {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+	return tx
+}
+
+// getExperimentRuns 获取实验运行列表
+func getExperimentRuns(page, size int, filter ExperimentRunFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterExperimentRuns(db.Model(&ExperimentRun{}), filter).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count experiment runs: %v", err)
+	}
+
+	var runs []ExperimentRun
+	offset := (page - 1) * size
+	if err := filterExperimentRuns(db, filter).Order("created_at DESC").Offset(offset).Limit(size).Find(&runs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query experiment runs: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       runs,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getExperimentRun 获取单个实验运行
+func getExperimentRun(runID string) (*ExperimentRun, error) {
+	var run ExperimentRun
+	if err := db.Where("id = ?", runID).First(&run).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get experiment run: %v", err)
+	}
+	return &run, nil
+}
+
+// updateExperimentRun 更新实验运行的指定字段
+func updateExperimentRun(runID string, updates map[string]interface{}) error {
+	if err := db.Model(&ExperimentRun{}).Where("id = ?", runID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update experiment run: %v", err)
+	}
+	return nil
+}
+
+// saveExperimentResult 保存实验运行中单个条目的结果
+func saveExperimentResult(result *ExperimentResult) error {
+	if err := db.Create(result).Error; err != nil {
+		return fmt.Errorf("failed to create experiment result: %v", err)
+	}
+	return nil
+}
+
+// filterExperimentResults 应用实验结果的过滤条件
+func filterExperimentResults(tx *gorm.DB, filter ExperimentResultFilter) *gorm.DB {
+	if filter.Passed != nil {
+		tx = tx.Where("passed = ?", *filter.Passed)
+	}
+	if filter.Changed != nil {
+		tx = tx.Where("changed = ?", *filter.Changed)
+	}
+	return tx
+}
+
+// getExperimentResults 分页获取实验运行的条目结果
+func getExperimentResults(runID string, page, size int, filter ExperimentResultFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterExperimentResults(db.Model(&ExperimentResult{}), filter).Where("run_id = ?", runID).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count experiment results: %v", err)
+	}
+
+	var results []ExperimentResult
+	offset := (page - 1) * size
+	if err := filterExperimentResults(db, filter).Where("run_id = ?", runID).
+		Order("position ASC").
+		Offset(offset).Limit(size).Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query experiment results: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       results,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getAllExperimentResults 获取实验运行的全部条目结果
+func getAllExperimentResults(runID string) ([]ExperimentResult, error) {
+	var results []ExperimentResult
+	if err := db.Where("run_id = ?", runID).Order("position ASC").Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query experiment results: %v", err)
+	}
+	return results, nil
+}
+
+// deleteExperimentRun 删除实验运行及其条目结果和重放记录
+func deleteExperimentRun(runID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("run_id = ?", runID).Delete(&ExperimentResult{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete experiment results: %v", err)
+	}
+	if err := tx.Where("experiment_run_id = ?", runID).Delete(&ReplayRecord{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete replay records: %v", err)
+	}
+	if err := tx.Where("id = ?", runID).Delete(&ExperimentRun{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete experiment run: %v", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// saveAssertionResults 批量保存检查结果
+func saveAssertionResults(results []AssertionResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	if err := db.Create(&results).Error; err != nil {
+		return fmt.Errorf("failed to save assertion results: %v", err)
+	}
+	return nil
+}
+
+// filterAssertionResults 按过滤条件限定检查结果查询
+func filterAssertionResults(tx *gorm.DB, filter AssertionResultFilter) *gorm.DB {
+	tx = filterDerivedByProject(tx, filter.ProjectID)
+	if filter.ReplayRecordID != "" {
+		tx = tx.Where("replay_record_id = ?", filter.ReplayRecordID)
+	}
+	if filter.RecordID != "" {
+		tx = tx.Where("record_id = ?", filter.RecordID)
+	}
+	if filter.ReplaySessionID != "" {
+		tx = tx.Where("replay_session_id = ?", filter.ReplaySessionID)
+	}
+	if filter.SessionID != "" {
+		tx = tx.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Type != "" {
+		tx = tx.Where("type = ?", filter.Type)
+	}
+	if filter.Passed != nil {
+		tx = tx.Where("passed = ?", *filter.Passed)
+	}
+	return tx
+}
+
+// getAssertionResults 分页获取检查结果，最新的在前
+func getAssertionResults(page, size int, filter AssertionResultFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterAssertionResults(db.Model(&AssertionResult{}), filter).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count assertion results: %v", err)
+	}
+
+	var results []AssertionResult
+	offset := (page - 1) * size
+	if err := filterAssertionResults(db, filter).
+		Order("created_at DESC").Order("position ASC").
+		Offset(offset).Limit(size).Find(&results).Error; err != nil {
+		return nil, fmt.Errorf("failed to query assertion results: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       results,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// createJudgeEvaluator 创建评审模型评估器
+func createJudgeEvaluator(evaluator *JudgeEvaluator) error {
+	if err := db.Create(evaluator).Error; err != nil {
+		return fmt.Errorf("failed to create judge evaluator: %v", err)
+	}
+	return nil
+}
+
+// getJudgeEvaluators 获取项目的评审模型评估器列表
+func getJudgeEvaluators(projectID string, page, size int) (*PaginatedResponse, error) {
+	var total int64
+	if err := db.Model(&JudgeEvaluator{}).Where("project_id = ?", projectID).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count judge evaluators: %v", err)
+	}
+
+	var evaluators []JudgeEvaluator
+	offset := (page - 1) * size
+	if err := db.Where("project_id = ?", projectID).Order("created_at DESC").Offset(offset).Limit(size).Find(&evaluators).Error; err != nil {
+		return nil, fmt.Errorf("failed to query judge evaluators: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       evaluators,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getJudgeEvaluator 获取单个评审模型评估器
+func getJudgeEvaluator(evaluatorID string) (*JudgeEvaluator, error) {
+	var evaluator JudgeEvaluator
+	if err := db.Where("id = ?", evaluatorID).First(&evaluator).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get judge evaluator: %v", err)
+	}
+	return &evaluator, nil
+}
+
+// saveJudgeEvaluator 保存修改后的评审模型评估器
+func saveJudgeEvaluator(evaluator *JudgeEvaluator) error {
+	if err := db.Save(evaluator).Error; err != nil {
+		return fmt.Errorf("failed to save judge evaluator: %v", err)
+	}
+	return nil
+}
+
+// deleteJudgeEvaluator 删除评审模型评估器及其评分
+func deleteJudgeEvaluator(evaluatorID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("evaluator_id = ?", evaluatorID).Delete(&JudgeScore{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete judge scores: %v", err)
+	}
+	if err := tx.Where("id = ?", evaluatorID).Delete(&JudgeEvaluator{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete judge evaluator: %v", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// saveJudgeScore 保存评审评分
+func saveJudgeScore(score *JudgeScore) error {
+	if err := db.Create(score).Error; err != nil {
+		return fmt.Errorf("failed to save judge score: %v", err)
+	}
+	return nil
+}
+
+// filterJudgeScores 按过滤条件限定评审评分查询
+func filterJudgeScores(tx *gorm.DB, filter JudgeScoreFilter) *gorm.DB {
+	tx = filterDerivedByProject(tx, filter.ProjectID)
+	if filter.EvaluatorID != "" {
+		tx = tx.Where("evaluator_id = ?", filter.EvaluatorID)
+	}
+	if filter.ReplayRecordID != "" {
+		tx = tx.Where("replay_record_id = ?", filter.ReplayRecordID)
+	}
+	if filter.RecordID != "" {
+		tx = tx.Where("record_id = ?", filter.RecordID)
+	}
+	if filter.ReplaySessionID != "" {
+		tx = tx.Where("replay_session_id = ?", filter.ReplaySessionID)
+	}
+	if filter.SessionID != "" {
+		tx = tx.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Status != "" {
+		tx = tx.Where("status = ?", filter.Status)
+	}
+	return tx
+}
+
+// getJudgeScores 分页获取评审评分，最新的在前
+func getJudgeScores(page, size int, filter JudgeScoreFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterJudgeScores(db.Model(&JudgeScore{}), filter).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count judge scores: %v", err)
+	}
+
+	var scores []JudgeScore
+	offset := (page - 1) * size
+	if err := filterJudgeScores(db, filter).Order("created_at DESC").
+		Offset(offset).Limit(size).Find(&scores).Error; err != nil {
+		return nil, fmt.Errorf("failed to query judge scores: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       scores,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// findSessionTurnRecord 获取会话中指定轮次最新的调用记录
+func findSessionTurnRecord(sessionID string, turnNumber int) (*Record, error) {
+	var record Record
+	if err := db.Where("session_id = ? AND turn_number = ?", sessionID, turnNumber).
+		Order("created_at DESC").First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get record: %v", err)
+	}
+	return &record, nil
+}
+
+// createFeedback 创建反馈
+func createFeedback(feedback *Feedback) error {
+	if err := db.Create(feedback).Error; err != nil {
+		return fmt.Errorf("failed to create feedback: %v", err)
+	}
+	return nil
+}
+
+// getFeedback 获取单条反馈
+func getFeedback(feedbackID string) (*Feedback, error) {
+	var feedback Feedback
+	if err := db.Where("id = ?", feedbackID).First(&feedback).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get feedback: %v", err)
+	}
+	return &feedback, nil
+}
+
+// saveFeedback 保存修改后的反馈
+func saveFeedback(feedback *Feedback) error {
+	if err := db.Save(feedback).Error; err != nil {
+		return fmt.Errorf("failed to save feedback: %v", err)
+	}
+	return nil
+}
+
+// deleteFeedback 删除反馈
+func deleteFeedback(feedbackID string) error {
+	result := db.Where("id = ?", feedbackID).Delete(&Feedback{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete feedback: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("feedback not found")
+	}
+	return nil
+}
+
+// filterFeedback 按过滤条件限定反馈查询
+func filterFeedback(tx *gorm.DB, filter FeedbackFilter) *gorm.DB {
+	if filter.ProjectID != "" {
+		tx = tx.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.RecordID != "" {
+		tx = tx.Where("record_id = ?", filter.RecordID)
+	}
+	if filter.ReplayRecordID != "" {
+		tx = tx.Where("replay_record_id = ?", filter.ReplayRecordID)
+	}
+	if filter.SessionID != "" {
+		tx = tx.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.Model != "" {
+		tx = tx.Where("model = ?", filter.Model)
+	}
+	if filter.Source != "" {
+		tx = tx.Where("source = ?", filter.Source)
+	}
+	if filter.Author != "" {
+		tx = tx.Where("author = ?", filter.Author)
+	}
+	if filter.Rating != "" {
+		tx = tx.Where("rating = ?", filter.Rating)
+	}
+	if filter.Label != "" {
+		// 标签以JSON数组保存，按带引号的标签匹配
+		label, _ := json.Marshal(filter.Label)
+		tx = tx.Where("labels LIKE ?", "%"+string(label)+"%")
+	}
+	return tx
+}
+
+// getFeedbackList 分页获取反馈，最新的在前
+func getFeedbackList(page, size int, filter FeedbackFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterFeedback(db.Model(&Feedback{}), filter).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count feedback: %v", err)
+	}
+
+	var feedback []Feedback
+	offset := (page - 1) * size
+	if err := filterFeedback(db, filter).Order("created_at DESC").
+		Offset(offset).Limit(size).Find(&feedback).Error; err != nil {
+		return nil, fmt.Errorf("failed to query feedback: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       feedback,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// getFeedbackSummary 按列（session_id 或 model）分组汇总反馈，反馈数多的在前
+func getFeedbackSummary(column string, page, size int, filter FeedbackFilter) (*PaginatedResponse, error) {
+	var total int64
+	if err := filterFeedback(db.Model(&Feedback{}), filter).Where(column+" <> ?", "").
+		Distinct(column).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count feedback groups: %v", err)
+	}
+
+	var rows []struct {
+		GroupKey    string
+		Total       int64
+		Good        int64
+		Bad         int64
+		ScoredCount int64
+		AvgScore    *float64
+	}
+	offset := (page - 1) * size
+	if err := filterFeedback(db.Model(&Feedback{}), filter).Where(column+" <> ?", "").
+		Select(column+" AS group_key, COUNT(*) AS total, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS good, "+
+			"SUM(CASE WHEN rating = ? THEN 1 ELSE 0 END) AS bad, "+
+			"COUNT(score) AS scored_count, AVG(score) AS avg_score", FeedbackRatingGood, FeedbackRatingBad).
+		Group(column).Order("total DESC").Order(column + " ASC").
+		Offset(offset).Limit(size).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to summarize feedback: %v", err)
+	}
+
+	summaries := make([]FeedbackSummary, len(rows))
+	for i, row := range rows {
+		summaries[i] = FeedbackSummary{
+			Key:         row.GroupKey,
+			Total:       row.Total,
+			Good:        row.Good,
+			Bad:         row.Bad,
+			ScoredCount: row.ScoredCount,
+			AvgScore:    row.AvgScore,
+		}
+		if rated := row.Good + row.Bad; rated > 0 {
+			summaries[i].GoodRate = float64(row.Good) / float64(rated)
+		}
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       summaries,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// filterTagged 限定带有全部指定标签的目标，按名称匹配项目内的标签，tx 的主表需以 id 为主键
+func filterTagged(tx *gorm.DB, projectID string, targetType string, tags []string) *gorm.DB {
+	for _, name := range tags {
+		tagged := db.Model(&TagAssignment{}).
+			Select("tag_assignments.target_id").
+			Joins("JOIN tags ON tags.id = tag_assignments.tag_id").
+			Where("tag_assignments.target_type = ? AND tags.name = ?", targetType, name)
+		if projectID != "" {
+			tagged = tagged.Where("tags.project_id = ?", projectID)
+		}
+		tx = tx.Where("id IN (?)", tagged)
+	}
+	return tx
+}
+
+// getTargetTags 批量获取目标的标签，按目标ID分组
+func getTargetTags(targetType string, targetIDs []string) (map[string][]Tag, error) {
+	result := make(map[string][]Tag)
+	if len(targetIDs) == 0 {
+		return result, nil
+	}
+
+	var rows []struct {
+		TargetID string
+		Tag
+	}
+	if err := db.Model(&TagAssignment{}).
+		Select("tag_assignments.target_id, tags.id, tags.project_id, tags.name, tags.color, tags.created_at").
+		Joins("JOIN tags ON tags.id = tag_assignments.tag_id").
+		Where("tag_assignments.target_type = ? AND tag_assignments.target_id IN ?", targetType, targetIDs).
+		Order("tags.name ASC").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tags: %v", err)
+	}
+
+	for _, row := range rows {
+		result[row.TargetID] = append(result[row.TargetID], row.Tag)
+	}
+	return result, nil
+}
+
+// deleteTargetAnnotations 在事务中删除目标的标签关联和备注
+func deleteTargetAnnotations(tx *gorm.DB, targetType string, targetID string) error {
+	if err := tx.Where("target_type = ? AND target_id = ?", targetType, targetID).Delete(&TagAssignment{}).Error; err != nil {
+		return fmt.Errorf("failed to delete tag assignments: %v", err)
+	}
+	if err := tx.Where("target_type = ? AND target_id = ?", targetType, targetID).Delete(&Note{}).Error; err != nil {
+		return fmt.Errorf("failed to delete notes: %v", err)
+	}
+	return nil
+}
+
+// createTag 创建标签
+func createTag(tag *Tag) error {
+	if err := db.Create(tag).Error; err != nil {
+		return fmt.Errorf("failed to create tag: %v", err)
+	}
+	return nil
+}
+
+// getTags 获取项目的全部标签（按名称排序）
+func getTags(projectID string) ([]Tag, error) {
+	var tags []Tag
+	if err := db.Where("project_id = ?", projectID).Order("name ASC").Find(&tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tags: %v", err)
+	}
+	return tags, nil
+}
+
+// getTag 获取单个标签
+func getTag(tagID string) (*Tag, error) {
+	var tag Tag
+	if err := db.Where("id = ?", tagID).First(&tag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tag: %v", err)
+	}
+	return &tag, nil
+}
+
+// getTagByName 按名称获取项目内的标签
+func getTagByName(projectID string, name string) (*Tag, error) {
+	var tag Tag
+	if err := db.Where("project_id = ? AND name = ?", projectID, name).First(&tag).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get tag: %v", err)
+	}
+	return &tag, nil
+}
+
+// saveTag 保存修改后的标签
+func saveTag(tag *Tag) error {
+	if err := db.Save(tag).Error; err != nil {
+		return fmt.Errorf("failed to save tag: %v", err)
+	}
+	return nil
+}
+
+// deleteTag 删除标签及其全部关联
+func deleteTag(tagID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("tag_id = ?", tagID).Delete(&TagAssignment{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete tag assignments: %v", err)
+	}
+	if err := tx.Where("id = ?", tagID).Delete(&Tag{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete tag: %v", err)
+	}
+
+	return tx.Commit().Error
+}
+
+// ensureTags 按名称获取项目内的标签，不存在时创建
+func ensureTags(projectID string, names []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag, err := getTagByName(projectID, name)
+		if err != nil {
+			return nil, err
+		}
+		if tag == nil {
+			tag = &Tag{ID: uuid.New().String(), ProjectID: projectID, Name: name}
+			if err := createTag(tag); err != nil {
+				return nil, err
+			}
+		}
+		tags = append(tags, *tag)
+	}
+	return tags, nil
+}
+
+// addTagAssignments 为目标添加标签，已添加的标签会被跳过
+func addTagAssignments(tags []Tag, targetType string, targetID string) error {
+	for _, tag := range tags {
+		var count int64
+		if err := db.Model(&TagAssignment{}).
+			Where("tag_id = ? AND target_type = ? AND target_id = ?", tag.ID, targetType, targetID).
+			Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check tag assignment: %v", err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		assignment := &TagAssignment{
+			ID:         uuid.New().String(),
+			TagID:      tag.ID,
+			TargetType: targetType,
+			TargetID:   targetID,
+		}
+		if err := db.Create(assignment).Error; err != nil {
+			return fmt.Errorf("failed to create tag assignment: %v", err)
+		}
+	}
+	return nil
+}
+
+// removeTagAssignment 移除目标上的标签
+func removeTagAssignment(tagID string, targetType string, targetID string) error {
+	result := db.Where("tag_id = ? AND target_type = ? AND target_id = ?", tagID, targetType, targetID).Delete(&TagAssignment{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete tag assignment: %v", result.Error)
+	}
+	return nil
+}
+
+// getTagAssignments 分页获取标签的关联目标，可按目标类型过滤
+func getTagAssignments(projectID string, tagID string, targetType string, page, size int) (*PaginatedResponse, error) {
+	query := func() *gorm.DB {
+		tx := db.Model(&TagAssignment{}).Where("tag_id = ?", tagID)
+		if targetType != "" {
+			tx = tx.Where("target_type = ?", targetType)
+		}
+		// 只返回项目内的目标
+		return tx.Where("((target_type = ? AND target_id IN (?)) OR (target_type = ? AND target_id IN (?)) OR (target_type = ? AND target_id IN (?)))",
+			TagTargetSession, db.Model(&Session{}).Select("id").Where("project_id = ?", projectID),
+			TagTargetRecord, db.Model(&Record{}).Select("id").Where("project_id = ?", projectID),
+			TagTargetReplaySession, db.Model(&ReplaySession{}).Select("id").Where("project_id = ?", projectID))
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count tag assignments: %v", err)
+	}
+
+	var assignments []TagAssignment
+	offset := (page - 1) * size
+	if err := query().Order("created_at DESC").Offset(offset).Limit(size).Find(&assignments).Error; err != nil {
+		return nil, fmt.Errorf("failed to query tag assignments: %v", err)
+	}
+
+	totalPages := int((total + int64(size) - 1) / int64(size))
+
+	return &PaginatedResponse{
+		Data:       assignments,
+		Total:      int(total),
+		Page:       page,
+		Size:       size,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// createNote 创建备注
+func createNote(note *Note) error {
+	if err := db.Create(note).Error; err != nil {
+		return fmt.Errorf("failed to create note: %v", err)
+	}
+	return nil
+}
+
+// getTargetNotes 获取目标的全部备注（按时间排序）
+func getTargetNotes(targetType string, targetID string) ([]Note, error) {
+	var notes []Note
+	if err := db.Where("target_type = ? AND target_id = ?", targetType, targetID).
+		Order("created_at ASC").Find(&notes).Error; err != nil {
+		return nil, fmt.Errorf("failed to query notes: %v", err)
+	}
+	return notes, nil
+}
+
+// getNote 获取单条备注
+func getNote(noteID string) (*Note, error) {
+	var note Note
+	if err := db.Where("id = ?", noteID).First(&note).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get note: %v", err)
+	}
+	return &note, nil
+}
+
+// saveNote 保存修改后的备注
+func saveNote(note *Note) error {
+	if err := db.Save(note).Error; err != nil {
+		return fmt.Errorf("failed to save note: %v", err)
+	}
+	return nil
+}
+
+// deleteNote 删除备注
+func deleteNote(noteID string) error {
+	result := db.Where("id = ?", noteID).Delete(&Note{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete note: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("note not found")
+	}
+	return nil
+}
+
+// ensureDefaultProject 创建默认项目（已存在时跳过）
+func ensureDefaultProject() error {
+	project := Project{ID: DefaultProjectID, Name: DefaultProjectID}
+	if err := db.Where("id = ?", DefaultProjectID).FirstOrCreate(&project).Error; err != nil {
+		return fmt.Errorf("failed to create default project: %v", err)
+	}
+	return nil
+}
+
+// createProject 创建项目
+func createProject(project *Project) error {
+	if err := db.Create(project).Error; err != nil {
+		return fmt.Errorf("failed to create project: %v", err)
+	}
+	return nil
+}
+
+// getProjects 获取全部项目
+func getProjects() ([]Project, error) {
+	var projects []Project
+	if err := db.Order("created_at ASC").Find(&projects).Error; err != nil {
+		return nil, fmt.Errorf("failed to query projects: %v", err)
+	}
+	return projects, nil
+}
+
+// getProject 获取单个项目
+func getProject(projectID string) (*Project, error) {
+	var project Project
+	if err := db.Where("id = ?", projectID).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project: %v", err)
+	}
+	return &project, nil
+}
+
+// getProjectByName 按名称获取项目
+func getProjectByName(name string) (*Project, error) {
+	var project Project
+	if err := db.Where("name = ?", name).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get project: %v", err)
+	}
+	return &project, nil
+}
+
+// resolveProject 按ID或名称查找项目
+func resolveProject(ref string) (*Project, error) {
+	project, err := getProject(ref)
+	if err != nil || project != nil {
+		return project, err
+	}
+	return getProjectByName(ref)
+}
+
+// saveProject 保存项目的修改
+func saveProject(project *Project) error {
+	if err := db.Save(project).Error; err != nil {
+		return fmt.Errorf("failed to save project: %v", err)
+	}
+	return nil
+}
+
+// countProjectData 统计项目中的会话、重放会话、数据集和实验运行数量
+func countProjectData(projectID string) (int64, error) {
+	var total int64
+	for _, model := range []interface{}{&Session{}, &ReplaySession{}, &Dataset{}, &ExperimentRun{}, &JudgeEvaluator{}} {
+		var count int64
+		if err := db.Model(model).Where("project_id = ?", projectID).Count(&count).Error; err != nil {
+			return 0, fmt.Errorf("failed to count project data: %v", err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// deleteProject 删除项目及限定在该项目的API密钥、标签和工具桩
+func deleteProject(projectID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("project_id = ?", projectID).Delete(&APIKey{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project api keys: %v", err)
+	}
+	if err := tx.Where("tag_id IN (?)", tx.Model(&Tag{}).Select("id").Where("project_id = ?", projectID)).Delete(&TagAssignment{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project tag assignments: %v", err)
+	}
+	if err := tx.Where("project_id = ?", projectID).Delete(&Tag{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project tags: %v", err)
+	}
+	if err := tx.Where("project_id = ?", projectID).Delete(&ToolStub{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project tool stubs: %v", err)
+	}
+	result := tx.Where("id = ?", projectID).Delete(&Project{})
+	if result.Error != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete project: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("project not found")
+	}
+
+	return tx.Commit().Error
+}
+
+// filterDerivedByProject 将关联调用记录或重放记录的数据（检查结果、评审评分）限定在项目内：
+// 按所属会话、重放会话或实验运行产生的重放记录匹配
+func filterDerivedByProject(tx *gorm.DB, projectID string) *gorm.DB {
+	if projectID == "" {
+		return tx
+	}
+	return tx.Where("(session_id IN (?) OR replay_session_id IN (?) OR replay_record_id IN (?))",
+		db.Model(&Session{}).Select("id").Where("project_id = ?", projectID),
+		db.Model(&ReplaySession{}).Select("id").Where("project_id = ?", projectID),
+		db.Model(&ReplayRecord{}).Select("id").Where("experiment_run_id IN (?)",
+			db.Model(&ExperimentRun{}).Select("id").Where("project_id = ?", projectID)))
+}
+
+// replayRecordProjectID 获取重放记录所属的项目：调试重放取重放会话的项目，实验运行取实验运行的项目
+func replayRecordProjectID(record *ReplayRecord) (string, error) {
+	var projectIDs []string
+	var err error
+	switch {
+	case record.ReplaySessionID != "":
+		err = db.Model(&ReplaySession{}).Where("id = ?", record.ReplaySessionID).Pluck("project_id", &projectIDs).Error
+	case record.ExperimentRunID != "":
+		err = db.Model(&ExperimentRun{}).Where("id = ?", record.ExperimentRunID).Pluck("project_id", &projectIDs).Error
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get replay record project: %v", err)
+	}
+	if len(projectIDs) == 0 {
+		return "", nil
+	}
+	return projectIDs[0], nil
+}
+
+// createAPIKey 创建API密钥
+func createAPIKey(key *APIKey) error {
+	if err := db.Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %v", err)
+	}
+	return nil
+}
+
+// getAPIKeys 获取API密钥，projectID 不为空时只返回限定在该项目的密钥
+func getAPIKeys(projectID string) ([]APIKey, error) {
+	query := db.Model(&APIKey{})
+	if projectID != "" {
+		query = query.Where("project_id = ?", projectID)
+	}
+
+	var keys []APIKey
+	if err := query.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %v", err)
+	}
+	return keys, nil
+}
+
+// getAPIKey 获取单个API密钥
+func getAPIKey(keyID string) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("id = ?", keyID).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get api key: %v", err)
+	}
+	return &key, nil
+}
+
+// getAPIKeyByHash 按密钥摘要查找API密钥
+func getAPIKeyByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get api key: %v", err)
+	}
+	return &key, nil
+}
+
+// touchAPIKey 更新API密钥的最近使用时间
+func touchAPIKey(keyID string, usedAt time.Time) error {
+	if err := db.Model(&APIKey{}).Where("id = ?", keyID).UpdateColumn("last_used_at", usedAt).Error; err != nil {
+		return fmt.Errorf("failed to update api key: %v", err)
+	}
+	return nil
+}
+
+// deleteAPIKey 删除（吊销）API密钥
+func deleteAPIKey(keyID string) error {
+	result := db.Where("id = ?", keyID).Delete(&APIKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete api key: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+// createUser 创建用户
+func createUser(user *User) error {
+	if err := db.Create(user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	return nil
+}
+
+// getUsers 获取全部用户
+func getUsers() ([]User, error) {
+	var users []User
+	if err := db.Order("created_at ASC").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+	return users, nil
+}
+
+// getUser 获取单个用户
+func getUser(userID string) (*User, error) {
+	var user User
+	if err := db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+	return &user, nil
+}
+
+// getUserByUsername 按用户名获取用户
+func getUserByUsername(username string) (*User, error) {
+	var user User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+	return &user, nil
+}
+
+// saveUser 保存用户
+func saveUser(user *User) error {
+	if err := db.Save(user).Error; err != nil {
+		return fmt.Errorf("failed to save user: %v", err)
+	}
+	return nil
+}
+
+// countActiveAdmins 统计未停用的管理员数量
+func countActiveAdmins() (int64, error) {
+	var count int64
+	if err := db.Model(&User{}).Where("role = ? AND disabled = ?", RoleAdmin, false).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count admins: %v", err)
+	}
+	return count, nil
+}
+
+// deleteUser 删除用户及其登录会话
+func deleteUser(userID string) error {
+	// 开始事务
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Where("user_id = ?", userID).Delete(&LoginSession{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete login sessions: %v", err)
+	}
+	result := tx.Where("id = ?", userID).Delete(&User{})
+	if result.Error != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete user: %v", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return fmt.Errorf("user not found")
+	}
+
+	return tx.Commit().Error
+}
+
+// createLoginSession 创建登录会话
+func createLoginSession(session *LoginSession) error {
+	if err := db.Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create login session: %v", err)
+	}
+	return nil
+}
+
+// getLoginSessionByHash 按令牌摘要获取未过期的登录会话
+func getLoginSessionByHash(tokenHash string) (*LoginSession, error) {
+	var session LoginSession
+	if err := db.Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&session).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login session: %v", err)
+	}
+	return &session, nil
+}
+
+// deleteLoginSessionByHash 删除登录会话（退出登录）
+func deleteLoginSessionByHash(tokenHash string) error {
+	if err := db.Where("token_hash = ?", tokenHash).Delete(&LoginSession{}).Error; err != nil {
+		return fmt.Errorf("failed to delete login session: %v", err)
+	}
+	return nil
+}
+
+// deleteUserLoginSessions 删除用户的登录会话（exceptTokenHash 对应的会话除外），重置密码或停用用户后需要重新登录
+func deleteUserLoginSessions(userID, exceptTokenHash string) error {
+	query := db.Where("user_id = ?", userID)
+	if exceptTokenHash != "" {
+		query = query.Where("token_hash <> ?", exceptTokenHash)
+	}
+	if err := query.Delete(&LoginSession{}).Error; err != nil {
+		return fmt.Errorf("failed to delete login sessions: %v", err)
+	}
+	return nil
+}
+
+// deleteExpiredLoginSessions 清理过期的登录会话
+func deleteExpiredLoginSessions() error {
+	if err := db.Where("expires_at <= ?", time.Now()).Delete(&LoginSession{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired login sessions: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 请求修改操作类型
+const (
+	MutationSetSystemPrompt = "set_system_prompt" // 替换系统提示词，不存在时插入到开头
+	MutationInsertMessage   = "insert_message"    // 在指定位置插入消息，未指定位置时追加到末尾
+	MutationDeleteMessage   = "delete_message"    // 删除指定位置的消息
+	MutationEditMessage     = "edit_message"      // 替换指定位置的消息或仅替换其内容
+	MutationTruncateHistory = "truncate_history"  // 只保留最近K轮对话（保留开头的系统消息）
+	MutationStripTools      = "strip_tools"       // 移除工具定义
+	MutationSetModel        = "set_model"         // 替换模型
+)
+
+// RequestMutation 重放前对请求的修改操作
+// Index 为负数时从末尾计数（-1 表示最后一条消息）
+type RequestMutation struct {
+	Op      string                        `json:"op" binding:"required"`
+	Index   *int                          `json:"index,omitempty"`
+	Message *openai.ChatCompletionMessage `json:"message,omitempty"`
+	Content *string                       `json:"content,omitempty"`
+	Turns   int                           `json:"turns,omitempty"`
+	Model   string                        `json:"model,omitempty"`
+}
+
+// validateRequestMutations 校验修改操作的参数是否完整
+func validateRequestMutations(mutations []RequestMutation) error {
+	for i, mutation := range mutations {
+		var err error
+		switch mutation.Op {
+		case MutationSetSystemPrompt:
+			if mutation.Content == nil {
+				err = fmt.Errorf("content is required")
+			}
+		case MutationInsertMessage:
+			if mutation.Message == nil {
+				err = fmt.Errorf("message is required")
+			}
+		case MutationDeleteMessage:
+			if mutation.Index == nil {
+				err = fmt.Errorf("index is required")
+			}
+		case MutationEditMessage:
+			if mutation.Index == nil {
+				err = fmt.Errorf("index is required")
+			} else if mutation.Message == nil && mutation.Content == nil {
+				err = fmt.Errorf("message or content is required")
+			}
+		case MutationTruncateHistory:
+			if mutation.Turns < 1 {
+				err = fmt.Errorf("turns must be positive")
+			}
+		case MutationStripTools:
+		case MutationSetModel:
+			if mutation.Model == "" {
+				err = fmt.Errorf("model is required")
+			}
+		default:
+			err = fmt.Errorf("unsupported op: %s", mutation.Op)
+		}
+		if err != nil {
+			return fmt.Errorf("mutation %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// resolveMessageIndex 将可能为负数的下标转换为消息列表中的位置
+func resolveMessageIndex(index int, length int) (int, error) {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return 0, fmt.Errorf("message index %d out of range", index)
+	}
+	return index, nil
+}
+
+// truncateHistory 保留开头的系统消息和最近的turns轮对话，每轮从一条用户消息开始
+func truncateHistory(messages []openai.ChatCompletionMessage, turns int) []openai.ChatCompletionMessage {
+	head := 0
+	for head < len(messages) && messages[head].Role == openai.ChatMessageRoleSystem {
+		head++
+	}
+
+	start := len(messages)
+	count := 0
+	for i := len(messages) - 1; i >= head; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			count++
+			start = i
+			if count == turns {
+				break
+			}
+		}
+	}
+	if count < turns {
+		start = head
+	}
+
+	truncated := make([]openai.ChatCompletionMessage, 0, head+len(messages)-start)
+	truncated = append(truncated, messages[:head]...)
+	return append(truncated, messages[start:]...)
+}
+
+// applyRequestMutations 按顺序将修改操作应用到请求上
+func applyRequestMutations(req *openai.ChatCompletionRequest, mutations []RequestMutation) error {
+	for i, mutation := range mutations {
+		messages := req.Messages
+		switch mutation.Op {
+		case MutationSetSystemPrompt:
+			if len(messages) > 0 && messages[0].Role == openai.ChatMessageRoleSystem {
+				messages[0].Content = *mutation.Content
+				messages[0].MultiContent = nil
+			} else {
+				system := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: *mutation.Content}
+				messages = append([]openai.ChatCompletionMessage{system}, messages...)
+			}
+		case MutationInsertMessage:
+			index := len(messages)
+			if mutation.Index != nil {
+				index = *mutation.Index
+				if index < 0 {
+					index += len(messages)
+				}
+				if index < 0 || index > len(messages) {
+					return fmt.Errorf("mutation %d: message index %d out of range", i, *mutation.Index)
+				}
+			}
+			inserted := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+			inserted = append(inserted, messages[:index]...)
+			inserted = append(inserted, *mutation.Message)
+			messages = append(inserted, messages[index:]...)
+		case MutationDeleteMessage:
+			index, err := resolveMessageIndex(*mutation.Index, len(messages))
+			if err != nil {
+				return fmt.Errorf("mutation %d: %v", i, err)
+			}
+			messages = append(messages[:index:index], messages[index+1:]...)
+		case MutationEditMessage:
+			index, err := resolveMessageIndex(*mutation.Index, len(messages))
+			if err != nil {
+				return fmt.Errorf("mutation %d: %v", i, err)
+			}
+			if mutation.Message != nil {
+				messages[index] = *mutation.Message
+			} else {
+				messages[index].Content = *mutation.Content
+				messages[index].MultiContent = nil
+			}
+		case MutationTruncateHistory:
+			messages = truncateHistory(messages, mutation.Turns)
+		case MutationStripTools:
+			req.Tools = nil
+			req.ToolChoice = nil
+			req.ParallelToolCalls = nil
+			req.Functions = nil
+			req.FunctionCall = nil
+		case MutationSetModel:
+			req.Model = mutation.Model
+		default:
+			return fmt.Errorf("mutation %d: unsupported op: %s", i, mutation.Op)
+		}
+		req.Messages = messages
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+func stringPtr(v string) *string { return &v }
+
+func TestValidateRequestMutations(t *testing.T) {
+	message := &openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hi"}
+
+	cases := []struct {
+		name      string
+		mutations []RequestMutation
+		wantErr   string
+	}{
+		{name: "no mutations", mutations: nil},
+		{
+			name: "all ops valid",
+			mutations: []RequestMutation{
+				{Op: MutationSetSystemPrompt, Content: stringPtr("")},
+				{Op: MutationInsertMessage, Message: message},
+				{Op: MutationDeleteMessage, Index: intPtr(-1)},
+				{Op: MutationEditMessage, Index: intPtr(0), Content: stringPtr("x")},
+				{Op: MutationEditMessage, Index: intPtr(0), Message: message},
+				{Op: MutationTruncateHistory, Turns: 1},
+				{Op: MutationStripTools},
+				{Op: MutationSetModel, Model: "m"},
+			},
+		},
+		{name: "set_system_prompt without content", mutations: []RequestMutation{{Op: MutationSetSystemPrompt}}, wantErr: "mutation 0: content is required"},
+		{name: "insert_message without message", mutations: []RequestMutation{{Op: MutationInsertMessage}}, wantErr: "message is required"},
+		{name: "delete_message without index", mutations: []RequestMutation{{Op: MutationDeleteMessage}}, wantErr: "index is required"},
+		{name: "edit_message without index", mutations: []RequestMutation{{Op: MutationEditMessage, Content: stringPtr("x")}}, wantErr: "index is required"},
+		{name: "edit_message without replacement", mutations: []RequestMutation{{Op: MutationEditMessage, Index: intPtr(0)}}, wantErr: "message or content is required"},
+		{name: "truncate_history without turns", mutations: []RequestMutation{{Op: MutationTruncateHistory}}, wantErr: "turns must be positive"},
+		{name: "set_model without model", mutations: []RequestMutation{{Op: MutationSetModel}}, wantErr: "model is required"},
+		{name: "unknown op reports its position", mutations: []RequestMutation{{Op: MutationStripTools}, {Op: "shuffle"}}, wantErr: "mutation 1: unsupported op: shuffle"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRequestMutations(tc.mutations)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyRequestMutations(t *testing.T) {
+	msg := func(role, content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: role, Content: content}
+	}
+	system := msg(openai.ChatMessageRoleSystem, "sys")
+	user1 := msg(openai.ChatMessageRoleUser, "u1")
+	assistant1 := msg(openai.ChatMessageRoleAssistant, "a1")
+	user2 := msg(openai.ChatMessageRoleUser, "u2")
+	assistant2 := msg(openai.ChatMessageRoleAssistant, "a2")
+	user3 := msg(openai.ChatMessageRoleUser, "u3")
+	inserted := msg(openai.ChatMessageRoleUser, "new")
+
+	base := func() openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{
+			Model:      "m",
+			Messages:   []openai.ChatCompletionMessage{system, user1, assistant1, user2, assistant2, user3},
+			Tools:      []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "lookup"}}},
+			ToolChoice: "auto",
+		}
+	}
+	withMessages := func(messages ...openai.ChatCompletionMessage) func(req *openai.ChatCompletionRequest) {
+		return func(req *openai.ChatCompletionRequest) { req.Messages = messages }
+	}
+
+	cases := []struct {
+		name      string
+		mutations []RequestMutation
+		want      func(req *openai.ChatCompletionRequest)
+		wantErr   string
+	}{
+		{
+			name:      "replace system prompt",
+			mutations: []RequestMutation{{Op: MutationSetSystemPrompt, Content: stringPtr("new sys")}},
+			want:      withMessages(msg(openai.ChatMessageRoleSystem, "new sys"), user1, assistant1, user2, assistant2, user3),
+		},
+		{
+			name: "insert system prompt when missing",
+			mutations: []RequestMutation{
+				{Op: MutationDeleteMessage, Index: intPtr(0)},
+				{Op: MutationSetSystemPrompt, Content: stringPtr("new sys")},
+			},
+			want: withMessages(msg(openai.ChatMessageRoleSystem, "new sys"), user1, assistant1, user2, assistant2, user3),
+		},
+		{
+			name:      "append message",
+			mutations: []RequestMutation{{Op: MutationInsertMessage, Message: &inserted}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2, user3, inserted),
+		},
+		{
+			name:      "insert before last message",
+			mutations: []RequestMutation{{Op: MutationInsertMessage, Index: intPtr(-1), Message: &inserted}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2, inserted, user3),
+		},
+		{
+			name:      "insert at end by index",
+			mutations: []RequestMutation{{Op: MutationInsertMessage, Index: intPtr(6), Message: &inserted}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2, user3, inserted),
+		},
+		{
+			name:      "insert out of range",
+			mutations: []RequestMutation{{Op: MutationInsertMessage, Index: intPtr(7), Message: &inserted}},
+			wantErr:   "mutation 0: message index 7 out of range",
+		},
+		{
+			name:      "delete last message",
+			mutations: []RequestMutation{{Op: MutationDeleteMessage, Index: intPtr(-1)}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2),
+		},
+		{
+			name:      "delete out of range",
+			mutations: []RequestMutation{{Op: MutationDeleteMessage, Index: intPtr(-7)}},
+			wantErr:   "out of range",
+		},
+		{
+			name:      "edit content",
+			mutations: []RequestMutation{{Op: MutationEditMessage, Index: intPtr(1), Content: stringPtr("edited")}},
+			want:      withMessages(system, msg(openai.ChatMessageRoleUser, "edited"), assistant1, user2, assistant2, user3),
+		},
+		{
+			name:      "replace message",
+			mutations: []RequestMutation{{Op: MutationEditMessage, Index: intPtr(-1), Message: &inserted}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2, inserted),
+		},
+		{
+			name:      "truncate to last turn",
+			mutations: []RequestMutation{{Op: MutationTruncateHistory, Turns: 1}},
+			want:      withMessages(system, user3),
+		},
+		{
+			name:      "truncate to two turns",
+			mutations: []RequestMutation{{Op: MutationTruncateHistory, Turns: 2}},
+			want:      withMessages(system, user2, assistant2, user3),
+		},
+		{
+			name:      "truncate keeps everything when history is short",
+			mutations: []RequestMutation{{Op: MutationTruncateHistory, Turns: 5}},
+			want:      withMessages(system, user1, assistant1, user2, assistant2, user3),
+		},
+		{
+			name:      "strip tools",
+			mutations: []RequestMutation{{Op: MutationStripTools}},
+			want: func(req *openai.ChatCompletionRequest) {
+				req.Tools = nil
+				req.ToolChoice = nil
+			},
+		},
+		{
+			name:      "set model",
+			mutations: []RequestMutation{{Op: MutationSetModel, Model: "other"}},
+			want:      func(req *openai.ChatCompletionRequest) { req.Model = "other" },
+		},
+		{
+			name: "mutations apply in order",
+			mutations: []RequestMutation{
+				{Op: MutationTruncateHistory, Turns: 1},
+				{Op: MutationInsertMessage, Index: intPtr(1), Message: &inserted},
+			},
+			want: withMessages(system, inserted, user3),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := base()
+			err := applyRequestMutations(&got, tc.mutations)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := base()
+			tc.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("applyRequestMutations = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReplayRecordReturnsSavedRecord(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	request := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+	record := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Request: request, Status: "success"}
+	if err := db.Create(record).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/api/records/"+record.ID+"/replay", map[string]interface{}{
+		"session_id":  "s1",
+		"turn_number": 2,
+		"request":     json.RawMessage(request),
+		"provider":    "stub",
+		"mutations":   []RequestMutation{{Op: MutationSetSystemPrompt, Content: stringPtr("be brief")}},
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay: status %d, body %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data Record `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode replay: %v", err)
+	}
+
+	stored, err := getRecord(resp.Data.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("getRecord: %v, %v", stored, err)
+	}
+	if !strings.Contains(resp.Data.Request, "be brief") || resp.Data.Request != stored.Request {
+		t.Fatalf("returned request %s, stored request %s", resp.Data.Request, stored.Request)
+	}
+	if resp.Data.ProjectID != DefaultProjectID || resp.Data.Metadata != stored.Metadata || !strings.Contains(resp.Data.Metadata, record.ID) {
+		t.Fatalf("returned record %+v, stored record %+v", resp.Data, stored)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DefaultProjectID 默认项目，未指定项目的请求和迁移前的数据都归属于默认项目
+const DefaultProjectID = "default"
+
+// ProjectHeader 指定调用方所属项目的请求头，值为项目ID或名称
+const ProjectHeader = "X-Project"
+
+// projectContextKey 请求上下文中保存调用方项目ID的键
+const projectContextKey = "project_id"
+
+// errSessionProjectMismatch 上报的会话已存在于其他项目中
+var errSessionProjectMismatch = errors.New("session belongs to another project")
+
+// projectMiddleware 根据请求头 X-Project（或查询参数 project）确定调用方的项目，
+// 未指定时使用API密钥限定的项目或默认项目
+func projectMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ref := strings.TrimSpace(c.GetHeader(ProjectHeader))
+		if ref == "" {
+			ref = strings.TrimSpace(c.Query("project"))
+		}
+		if ref == "" {
+			projectID := DefaultProjectID
+			if key := currentAPIKey(c); key != nil && key.ProjectID != "" {
+				projectID = key.ProjectID
+			}
+			c.Set(projectContextKey, projectID)
+			c.Next()
+			return
+		}
+
+		project, err := resolveProject(ref)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get project: " + err.Error(),
+			})
+			return
+		}
+
+		if project == nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, APIResponse{
+				Success: false,
+				Message: "Project not found: " + ref,
+			})
+			return
+		}
+
+		if !keyAllowsProject(c, project.ID) {
+			c.AbortWithStatusJSON(http.StatusForbidden, APIResponse{
+				Success: false,
+				Message: "API key cannot access project: " + ref,
+			})
+			return
+		}
+
+		c.Set(projectContextKey, project.ID)
+		c.Next()
+	}
+}
+
+// currentProjectID 获取调用方的项目ID
+func currentProjectID(c *gin.Context) string {
+	if projectID := c.GetString(projectContextKey); projectID != "" {
+		return projectID
+	}
+	return DefaultProjectID
+}
+
+// inCurrentProject 检查数据是否属于调用方的项目，其他项目的数据按不存在处理
+func inCurrentProject(c *gin.Context, projectID string) bool {
+	return projectID == currentProjectID(c)
+}
+
+// replayRecordInCurrentProject 检查重放记录是否属于调用方的项目
+func replayRecordInCurrentProject(c *gin.Context, record *ReplayRecord) (bool, error) {
+	projectID, err := replayRecordProjectID(record)
+	if err != nil {
+		return false, err
+	}
+	return inCurrentProject(c, projectID), nil
+}
+
+// loadProject 根据路径参数加载项目（ID或名称），失败时直接写入错误响应
+func loadProject(c *gin.Context) *Project {
+	ref := c.Param("id")
+	if ref == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Project ID is required",
+		})
+		return nil
+	}
+
+	project, err := resolveProject(ref)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get project: " + err.Error(),
+		})
+		return nil
+	}
+
+	if project == nil || !keyAllowsProject(c, project.ID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Project not found",
+		})
+		return nil
+	}
+
+	return project
+}
+
+// handleCreateProject 创建项目
+func handleCreateProject(c *gin.Context) {
+	var req CreateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name cannot be empty",
+		})
+		return
+	}
+
+	// 名称与已有项目的ID或名称相同时，按ID或名称查找项目会产生歧义
+	existing, err := resolveProject(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to check project: " + err.Error(),
+		})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Project already exists: " + name,
+		})
+		return
+	}
+
+	project := &Project{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Description: req.Description,
+	}
+	if err := createProject(project); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create project: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    project,
+	})
+}
+
+// handleGetProjects 获取全部项目，限定项目的API密钥只能看到所属项目
+func handleGetProjects(c *gin.Context) {
+	allProjects, err := getProjects()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get projects: " + err.Error(),
+		})
+		return
+	}
+
+	projects := make([]Project, 0, len(allProjects))
+	for _, project := range allProjects {
+		if keyAllowsProject(c, project.ID) {
+			projects = append(projects, project)
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    projects,
+	})
+}
+
+// handleGetProject 获取单个项目
+func handleGetProject(c *gin.Context) {
+	project := loadProject(c)
+	if project == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    project,
+	})
+}
+
+// handleUpdateProject 重命名项目或修改描述（只更新传入的字段）
+func handleUpdateProject(c *gin.Context) {
+	project := loadProject(c)
+	if project == nil {
+		return
+	}
+
+	var req UpdateProjectRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Name == nil && req.Description == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Name cannot be empty",
+			})
+			return
+		}
+		if name != project.Name {
+			existing, err := resolveProject(name)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to check project: " + err.Error(),
+				})
+				return
+			}
+			if existing != nil && existing.ID != project.ID {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Project already exists: " + name,
+				})
+				return
+			}
+		}
+		project.Name = name
+	}
+	if req.Description != nil {
+		project.Description = *req.Description
+	}
+
+	if err := saveProject(project); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update project: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    project,
+	})
+}
+
+// handleDeleteProject 删除项目，默认项目和仍有数据的项目不能删除
+func handleDeleteProject(c *gin.Context) {
+	project := loadProject(c)
+	if project == nil {
+		return
+	}
+
+	if project.ID == DefaultProjectID {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot delete the default project",
+		})
+		return
+	}
+
+	count, err := countProjectData(project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to check project: " + err.Error(),
+		})
+		return
+	}
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Project still has sessions, replay sessions, datasets, experiment runs or judge evaluators",
+		})
+		return
+	}
+
+	if err := deleteProject(project.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete project: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Project deleted successfully",
+	})
+}
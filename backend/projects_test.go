@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestProjectIsolation(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	team := &Project{ID: uuid.New().String(), Name: "team-a"}
+	if err := createProject(team); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	teamHeader := map[string]string{ProjectHeader: "team-a"}
+
+	trace := func(sessionID string, project string, headers map[string]string) int {
+		body := map[string]interface{}{
+			"session_id":  sessionID,
+			"turn_number": 1,
+			"request":     map[string]interface{}{"model": "m", "messages": []map[string]string{{"role": "user", "content": "hi"}}},
+			"status":      "success",
+			"project":     project,
+		}
+		return doJSON(t, r, http.MethodPost, "/api/trace", body, headers).Code
+	}
+
+	// 上报时通过字段或请求头指定项目
+	if code := trace("a1", "team-a", nil); code != http.StatusOK {
+		t.Fatalf("trace with project field: status %d", code)
+	}
+	if code := trace("a2", "", teamHeader); code != http.StatusOK {
+		t.Fatalf("trace with project header: status %d", code)
+	}
+	if code := trace("d1", "", nil); code != http.StatusOK {
+		t.Fatalf("trace to default project: status %d", code)
+	}
+	if code := trace("a1", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("trace to another project's session: status %d, want 400", code)
+	}
+	if code := trace("x1", "missing", nil); code != http.StatusNotFound {
+		t.Fatalf("trace to an unknown project: status %d, want 404", code)
+	}
+
+	listSessions := func(headers map[string]string) []string {
+		w := doJSON(t, r, http.MethodGet, "/api/sessions", nil, headers)
+		var resp struct {
+			Data struct {
+				Data []Session `json:"data"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode sessions: %v", err)
+		}
+		var ids []string
+		for _, session := range resp.Data.Data {
+			ids = append(ids, session.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	if got := listSessions(nil); !reflect.DeepEqual(got, []string{"d1"}) {
+		t.Fatalf("default project sessions: %v", got)
+	}
+	if got := listSessions(teamHeader); !reflect.DeepEqual(got, []string{"a1", "a2"}) {
+		t.Fatalf("team project sessions: %v", got)
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/sessions", nil, map[string]string{ProjectHeader: "missing"}); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown project header: status %d, want 404", w.Code)
+	}
+
+	var teamRecord, defaultRecord Record
+	if err := db.Where("session_id = ?", "a1").First(&teamRecord).Error; err != nil {
+		t.Fatalf("find team record: %v", err)
+	}
+	if err := db.Where("session_id = ?", "d1").First(&defaultRecord).Error; err != nil {
+		t.Fatalf("find default record: %v", err)
+	}
+	if teamRecord.ProjectID != team.ID || defaultRecord.ProjectID != DefaultProjectID {
+		t.Fatalf("record projects: %q, %q", teamRecord.ProjectID, defaultRecord.ProjectID)
+	}
+
+	// 其他项目的会话和记录按不存在处理
+	blocked := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodGet, "/api/sessions/a1/records", nil},
+		{http.MethodPatch, "/api/sessions/a1", map[string]string{"name": "renamed"}},
+		{http.MethodGet, "/api/records/" + teamRecord.ID + "/diff", nil},
+		{http.MethodGet, "/api/records/" + teamRecord.ID + "/feedback", nil},
+		{http.MethodPost, "/api/records/" + teamRecord.ID + "/replay", map[string]interface{}{"session_id": "d1", "turn_number": 2, "request": map[string]string{"model": "m"}}},
+		{http.MethodDelete, "/api/records/" + teamRecord.ID, nil},
+	}
+	for _, tc := range blocked {
+		if w := doJSON(t, r, tc.method, tc.path, tc.body, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s from default project: status %d, want 404", tc.method, tc.path, w.Code)
+		}
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/sessions/a1/records", nil, teamHeader); w.Code != http.StatusOK {
+		t.Fatalf("session records from its own project: status %d", w.Code)
+	}
+	if stored, err := getRecord(teamRecord.ID); err != nil || stored == nil {
+		t.Fatalf("record deleted from another project: %v, %v", stored, err)
+	}
+
+	// 重放结果不能写入其他项目的会话
+	replayInto := map[string]interface{}{"session_id": "a1", "turn_number": 2, "request": map[string]string{"model": "m"}}
+	if w := doJSON(t, r, http.MethodPost, "/api/records/"+defaultRecord.ID+"/replay", replayInto, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("replay into another project's session: status %d, want 400", w.Code)
+	}
+
+	// 重放会话归属于原始会话的项目
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-sessions", CreateReplaySessionRequest{OriginalSessionID: "a1", StartTurnNumber: 1}, nil); w.Code == http.StatusOK {
+		t.Fatalf("replay session for another project's session: status %d", w.Code)
+	}
+	w := doJSON(t, r, http.MethodPost, "/api/replay-sessions", CreateReplaySessionRequest{OriginalSessionID: "a1", StartTurnNumber: 1}, teamHeader)
+	var created struct {
+		Data ReplaySession `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("create replay session: status %d, body %s", w.Code, w.Body.String())
+	}
+	if created.Data.ProjectID != team.ID {
+		t.Fatalf("replay session project: %q, want %q", created.Data.ProjectID, team.ID)
+	}
+	replayPath := "/api/replay-sessions/" + created.Data.ID
+	for _, path := range []string{replayPath, replayPath + "/records", replayPath + "/tree"} {
+		if w := doJSON(t, r, http.MethodGet, path, nil, nil); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s from default project: status %d, want 404", path, w.Code)
+		}
+	}
+	if w := doJSON(t, r, http.MethodDelete, replayPath, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("delete replay session from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodGet, replayPath, nil, teamHeader); w.Code != http.StatusOK {
+		t.Fatalf("replay session from its own project: status %d", w.Code)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// defaultQueueTimeout 等待限流额度的默认最长时间
+const defaultQueueTimeout = 30 * time.Second
+
+// errRateLimitQueueTimeout 本地限流排队超时
+var errRateLimitQueueTimeout = errors.New("rate limit queue timeout exceeded")
+
+// tokenBucket 令牌桶，容量为每分钟的额度，按秒匀速补充
+type tokenBucket struct {
+	capacity float64
+	rate     float64 // 每秒补充的令牌数
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket 创建每分钟额度为perMinute的令牌桶，初始为满
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+// wait 补充令牌，返回取出n个令牌还需等待的时间
+func (b *tokenBucket) wait(n float64, now time.Time) time.Duration {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// 单次请求超过桶容量时按满桶计算，避免永远无法满足
+	n = math.Min(n, b.capacity)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// take 取出n个令牌，n为负数时归还令牌
+func (b *tokenBucket) take(n float64) {
+	b.tokens = math.Min(b.capacity, b.tokens-math.Min(n, b.capacity))
+}
+
+// providerLimiter 单个provider的请求速率、token速率和并发限制
+type providerLimiter struct {
+	mu           sync.Mutex
+	requests     *tokenBucket  // 每分钟请求数，为nil时不限制
+	tokens       *tokenBucket  // 每分钟token数，为nil时不限制
+	slots        chan struct{} // 并发调用数，为nil时不限制
+	queueTimeout time.Duration
+}
+
+var (
+	providerLimitersMu sync.Mutex
+	providerLimiters   = make(map[string]*providerLimiter)
+)
+
+// getProviderLimiter 获取provider的限流器，未配置任何限制时返回nil
+func getProviderLimiter(provider string) *providerLimiter {
+	key, ok := findProviderKey(provider)
+	if !ok {
+		return nil
+	}
+
+	providerLimitersMu.Lock()
+	defer providerLimitersMu.Unlock()
+
+	if limiter, exists := providerLimiters[key]; exists {
+		return limiter
+	}
+
+	cfg := GetConfig().Providers[key].RateLimit
+	var limiter *providerLimiter
+	if cfg.RequestsPerMinute > 0 || cfg.TokensPerMinute > 0 || cfg.MaxInFlight > 0 {
+		limiter = &providerLimiter{queueTimeout: time.Duration(cfg.QueueTimeoutMs) * time.Millisecond}
+		if limiter.queueTimeout <= 0 {
+			limiter.queueTimeout = defaultQueueTimeout
+		}
+		if cfg.RequestsPerMinute > 0 {
+			limiter.requests = newTokenBucket(cfg.RequestsPerMinute)
+		}
+		if cfg.TokensPerMinute > 0 {
+			limiter.tokens = newTokenBucket(cfg.TokensPerMinute)
+		}
+		if cfg.MaxInFlight > 0 {
+			limiter.slots = make(chan struct{}, cfg.MaxInFlight)
+		}
+	}
+	providerLimiters[key] = limiter
+	return limiter
+}
+
+// reserve 同时从请求桶和token桶取出额度，任一不足时都不扣除，返回需要等待的时间
+func (l *providerLimiter) reserve(estimatedTokens float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	if l.requests != nil {
+		wait = l.requests.wait(1, now)
+	}
+	if l.tokens != nil {
+		if tokenWait := l.tokens.wait(estimatedTokens, now); tokenWait > wait {
+			wait = tokenWait
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if l.requests != nil {
+		l.requests.take(1)
+	}
+	if l.tokens != nil {
+		l.tokens.take(estimatedTokens)
+	}
+	return 0
+}
+
+// settleTokens 按实际用量修正预估扣除的token
+func (l *providerLimiter) settleTokens(estimatedTokens float64, usedTokens float64) {
+	if l.tokens == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.take(usedTokens - estimatedTokens)
+}
+
+// refund 归还reserve扣除的请求额度和预估token，用于拿到额度后未发出调用的情况
+func (l *providerLimiter) refund(estimatedTokens float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.requests != nil {
+		l.requests.take(-1)
+	}
+	if l.tokens != nil {
+		l.tokens.take(-estimatedTokens)
+	}
+}
+
+// acquire 排队等待额度，返回排队时间和调用结束后的释放函数（传入实际使用的token数）
+// 在queueTimeout内拿不到额度时返回errRateLimitQueueTimeout
+func (l *providerLimiter) acquire(ctx context.Context, estimatedTokens int) (time.Duration, func(usedTokens int), error) {
+	if l == nil {
+		return 0, func(int) {}, nil
+	}
+
+	start := time.Now()
+	queueCtx, cancel := context.WithTimeout(ctx, l.queueTimeout)
+	defer cancel()
+
+	estimated := float64(estimatedTokens)
+	for {
+		wait := l.reserve(estimated)
+		if wait == 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-queueCtx.Done():
+			timer.Stop()
+			return time.Since(start), nil, l.queueError(ctx)
+		case <-timer.C:
+		}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-queueCtx.Done():
+			// 等待并发槽位超时，调用没有发出，归还请求额度和token额度
+			l.refund(estimated)
+			return time.Since(start), nil, l.queueError(ctx)
+		}
+	}
+
+	release := func(usedTokens int) {
+		if l.slots != nil {
+			<-l.slots
+		}
+		l.settleTokens(estimated, float64(usedTokens))
+	}
+	return time.Since(start), release, nil
+}
+
+// queueError 区分调用方取消和排队超时
+func (l *providerLimiter) queueError(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return errRateLimitQueueTimeout
+}
+
+// estimateRequestTokens 粗略估算请求占用的token数（约4个字符1个token，加上最大输出token数）
+func estimateRequestTokens(req openai.ChatCompletionRequest) int {
+	chars := 0
+	for _, message := range req.Messages {
+		chars += len(message.Content)
+		for _, part := range message.MultiContent {
+			chars += len(part.Text)
+		}
+		for _, toolCall := range message.ToolCalls {
+			chars += len(toolCall.Function.Name) + len(toolCall.Function.Arguments)
+		}
+	}
+	for _, tool := range req.Tools {
+		if tool.Function != nil {
+			chars += len(tool.Function.Name) + len(tool.Function.Description)
+		}
+	}
+
+	tokens := chars/4 + 4*len(req.Messages)
+	if req.MaxCompletionTokens > 0 {
+		tokens += req.MaxCompletionTokens
+	} else {
+		tokens += req.MaxTokens
+	}
+	return tokens
+}
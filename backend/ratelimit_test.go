@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireRefundsQuotaWhenSlotWaitTimesOut(t *testing.T) {
+	limiter := &providerLimiter{
+		requests:     newTokenBucket(2),
+		tokens:       newTokenBucket(1000),
+		slots:        make(chan struct{}, 1),
+		queueTimeout: 50 * time.Millisecond,
+	}
+
+	_, release, err := limiter.acquire(context.Background(), 300)
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	defer release(0)
+
+	// 唯一的并发槽位被占用，第二次调用排队超时
+	if _, _, err := limiter.acquire(context.Background(), 300); !errors.Is(err, errRateLimitQueueTimeout) {
+		t.Fatalf("second acquire error = %v, want queue timeout", err)
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if got := limiter.requests.tokens; got < 0.99 || got > 1.01 {
+		t.Fatalf("request bucket has %.3f left, want the timed-out request refunded (1)", got)
+	}
+	if got := limiter.tokens.tokens; got < 699 || got > 701 {
+		t.Fatalf("token bucket has %.1f left, want the timed-out estimate refunded (700)", got)
+	}
+}
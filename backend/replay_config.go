@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/sashabaranov/go-openai"
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("lenientjson", lenientJSONSerializer{})
+}
+
+// lenientJSONSerializer 兼容旧数据的JSON序列化器。重放记录的调试配置原先保存任意JSON，
+// 无法解析为当前类型的旧值按未设置处理，避免整条记录无法读取
+type lenientJSONSerializer struct {
+	schema.JSONSerializer
+}
+
+// Scan 解析数据库中的JSON，失败时将字段置为零值
+func (s lenientJSONSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	if err := s.JSONSerializer.Scan(ctx, field, dst, dbValue); err != nil {
+		return field.Set(ctx, dst, reflect.Zero(field.FieldType).Interface())
+	}
+	return nil
+}
+
+// ReplayConfig 重放调试参数，未设置的字段保留原始请求中的值
+type ReplayConfig struct {
+	Temperature         *float32                             `json:"temperature,omitempty"`
+	TopP                *float32                             `json:"top_p,omitempty"`
+	MaxTokens           *int                                 `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                                 `json:"max_completion_tokens,omitempty"`
+	FrequencyPenalty    *float32                             `json:"frequency_penalty,omitempty"`
+	PresencePenalty     *float32                             `json:"presence_penalty,omitempty"`
+	Seed                *int                                 `json:"seed,omitempty"`
+	Stop                []string                             `json:"stop,omitempty"`
+	N                   *int                                 `json:"n,omitempty"`
+	LogProbs            *bool                                `json:"logprobs,omitempty"`
+	TopLogProbs         *int                                 `json:"top_logprobs,omitempty"`
+	ResponseFormat      *openai.ChatCompletionResponseFormat `json:"response_format,omitempty"`
+	ToolChoice          interface{}                          `json:"tool_choice,omitempty"` // none/auto/required 或 {"type":"function","function":{"name":"..."}}
+	ParallelToolCalls   *bool                                `json:"parallel_tool_calls,omitempty"`
+	LogitBias           map[string]int                       `json:"logit_bias,omitempty"`
+	User                string                               `json:"user,omitempty"`
+	ReasoningEffort     string                               `json:"reasoning_effort,omitempty"` // minimal/low/medium/high
+}
+
+// Validate 校验参数取值范围
+func (c *ReplayConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Temperature != nil && (*c.Temperature < 0 || *c.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if c.TopP != nil && (*c.TopP < 0 || *c.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1")
+	}
+	if c.MaxTokens != nil && *c.MaxTokens < 1 {
+		return fmt.Errorf("max_tokens must be positive")
+	}
+	if c.MaxCompletionTokens != nil && *c.MaxCompletionTokens < 1 {
+		return fmt.Errorf("max_completion_tokens must be positive")
+	}
+	if c.MaxTokens != nil && c.MaxCompletionTokens != nil {
+		return fmt.Errorf("max_tokens and max_completion_tokens cannot be set together")
+	}
+	if c.FrequencyPenalty != nil && (*c.FrequencyPenalty < -2 || *c.FrequencyPenalty > 2) {
+		return fmt.Errorf("frequency_penalty must be between -2 and 2")
+	}
+	if c.PresencePenalty != nil && (*c.PresencePenalty < -2 || *c.PresencePenalty > 2) {
+		return fmt.Errorf("presence_penalty must be between -2 and 2")
+	}
+	if len(c.Stop) > 4 {
+		return fmt.Errorf("stop supports at most 4 sequences")
+	}
+	if c.N != nil && (*c.N < 1 || *c.N > 128) {
+		return fmt.Errorf("n must be between 1 and 128")
+	}
+	if c.TopLogProbs != nil {
+		if *c.TopLogProbs < 0 || *c.TopLogProbs > 20 {
+			return fmt.Errorf("top_logprobs must be between 0 and 20")
+		}
+		if c.LogProbs == nil || !*c.LogProbs {
+			return fmt.Errorf("top_logprobs requires logprobs to be true")
+		}
+	}
+	if c.ResponseFormat != nil {
+		switch c.ResponseFormat.Type {
+		case openai.ChatCompletionResponseFormatTypeText, openai.ChatCompletionResponseFormatTypeJSONObject:
+		case openai.ChatCompletionResponseFormatTypeJSONSchema:
+			if c.ResponseFormat.JSONSchema == nil || c.ResponseFormat.JSONSchema.Name == "" || c.ResponseFormat.JSONSchema.Schema == nil {
+				return fmt.Errorf("response_format json_schema requires name and schema")
+			}
+		default:
+			return fmt.Errorf("unsupported response_format type: %s", c.ResponseFormat.Type)
+		}
+	}
+	if err := validateToolChoice(c.ToolChoice); err != nil {
+		return err
+	}
+	for token, bias := range c.LogitBias {
+		if bias < -100 || bias > 100 {
+			return fmt.Errorf("logit_bias for token %s must be between -100 and 100", token)
+		}
+	}
+	switch c.ReasoningEffort {
+	case "", "minimal", "low", "medium", "high":
+	default:
+		return fmt.Errorf("unsupported reasoning_effort: %s", c.ReasoningEffort)
+	}
+	return nil
+}
+
+// validateToolChoice 校验tool_choice，支持字符串或指定函数的对象
+func validateToolChoice(toolChoice interface{}) error {
+	switch choice := toolChoice.(type) {
+	case nil:
+		return nil
+	case string:
+		switch choice {
+		case "none", "auto", "required":
+			return nil
+		}
+		return fmt.Errorf("unsupported tool_choice: %s", choice)
+	case map[string]interface{}:
+		if choice["type"] != string(openai.ToolTypeFunction) {
+			return fmt.Errorf("tool_choice object must have type function")
+		}
+		function, ok := choice["function"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("tool_choice object requires function.name")
+		}
+		if name, ok := function["name"].(string); !ok || name == "" {
+			return fmt.Errorf("tool_choice object requires function.name")
+		}
+		return nil
+	}
+	return fmt.Errorf("tool_choice must be a string or an object")
+}
+
+// explicitFloat 返回写入请求的浮点参数：go-openai 的这些字段带 omitempty，0 会被省略，
+// provider 会改用默认值，所以 0 用 math.SmallestNonzeroFloat32 代替
+func explicitFloat(value float32) float32 {
+	if value == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return value
+}
+
+// apply 将已设置的参数写入请求
+func (c *ReplayConfig) apply(req *openai.ChatCompletionRequest) {
+	if c == nil {
+		return
+	}
+	if c.Temperature != nil {
+		req.Temperature = explicitFloat(*c.Temperature)
+	}
+	if c.TopP != nil {
+		req.TopP = explicitFloat(*c.TopP)
+	}
+	if c.MaxTokens != nil {
+		req.MaxTokens = *c.MaxTokens
+	}
+	if c.MaxCompletionTokens != nil {
+		req.MaxCompletionTokens = *c.MaxCompletionTokens
+	}
+	if c.FrequencyPenalty != nil {
+		req.FrequencyPenalty = explicitFloat(*c.FrequencyPenalty)
+	}
+	if c.PresencePenalty != nil {
+		req.PresencePenalty = explicitFloat(*c.PresencePenalty)
+	}
+	if c.Seed != nil {
+		seed := *c.Seed
+		req.Seed = &seed
+	}
+	if c.Stop != nil {
+		req.Stop = c.Stop
+	}
+	if c.N != nil {
+		req.N = *c.N
+	}
+	if c.LogProbs != nil {
+		req.LogProbs = *c.LogProbs
+	}
+	if c.TopLogProbs != nil {
+		req.TopLogProbs = *c.TopLogProbs
+	}
+	if c.ResponseFormat != nil {
+		req.ResponseFormat = c.ResponseFormat
+	}
+	if c.ToolChoice != nil {
+		req.ToolChoice = c.ToolChoice
+	}
+	if c.ParallelToolCalls != nil {
+		req.ParallelToolCalls = *c.ParallelToolCalls
+	}
+	if c.LogitBias != nil {
+		req.LogitBias = c.LogitBias
+	}
+	if c.User != "" {
+		req.User = c.User
+	}
+	if c.ReasoningEffort != "" {
+		req.ReasoningEffort = c.ReasoningEffort
+	}
+}
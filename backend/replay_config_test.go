@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+func float32Ptr(v float32) *float32 { return &v }
+func intPtr(v int) *int             { return &v }
+func boolPtr(v bool) *bool          { return &v }
+
+func TestReplayConfigValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  *ReplayConfig
+		wantErr string
+	}{
+		{name: "nil config", config: nil},
+		{name: "empty config", config: &ReplayConfig{}},
+		{name: "valid values", config: &ReplayConfig{Temperature: float32Ptr(0.7), TopP: float32Ptr(1), MaxTokens: intPtr(256), Stop: []string{"\n"}}},
+		{name: "temperature too high", config: &ReplayConfig{Temperature: float32Ptr(2.5)}, wantErr: "temperature"},
+		{name: "negative temperature", config: &ReplayConfig{Temperature: float32Ptr(-0.1)}, wantErr: "temperature"},
+		{name: "top_p above 1", config: &ReplayConfig{TopP: float32Ptr(1.1)}, wantErr: "top_p"},
+		{name: "zero max_tokens", config: &ReplayConfig{MaxTokens: intPtr(0)}, wantErr: "max_tokens must be positive"},
+		{name: "zero max_completion_tokens", config: &ReplayConfig{MaxCompletionTokens: intPtr(0)}, wantErr: "max_completion_tokens must be positive"},
+		{name: "max_tokens with max_completion_tokens", config: &ReplayConfig{MaxTokens: intPtr(100), MaxCompletionTokens: intPtr(100)}, wantErr: "cannot be set together"},
+		{name: "frequency_penalty out of range", config: &ReplayConfig{FrequencyPenalty: float32Ptr(3)}, wantErr: "frequency_penalty"},
+		{name: "presence_penalty out of range", config: &ReplayConfig{PresencePenalty: float32Ptr(-3)}, wantErr: "presence_penalty"},
+		{name: "too many stop sequences", config: &ReplayConfig{Stop: []string{"a", "b", "c", "d", "e"}}, wantErr: "stop"},
+		{name: "n out of range", config: &ReplayConfig{N: intPtr(0)}, wantErr: "n must be"},
+		{name: "top_logprobs without logprobs", config: &ReplayConfig{TopLogProbs: intPtr(5)}, wantErr: "requires logprobs"},
+		{name: "top_logprobs with logprobs", config: &ReplayConfig{TopLogProbs: intPtr(5), LogProbs: boolPtr(true)}},
+		{name: "top_logprobs out of range", config: &ReplayConfig{TopLogProbs: intPtr(21), LogProbs: boolPtr(true)}, wantErr: "top_logprobs must be"},
+		{name: "json_object response format", config: &ReplayConfig{ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}}},
+		{name: "json_schema without schema", config: &ReplayConfig{ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONSchema}}, wantErr: "json_schema requires"},
+		{name: "unknown response format", config: &ReplayConfig{ResponseFormat: &openai.ChatCompletionResponseFormat{Type: "xml"}}, wantErr: "unsupported response_format"},
+		{name: "tool_choice string", config: &ReplayConfig{ToolChoice: "required"}},
+		{name: "unknown tool_choice string", config: &ReplayConfig{ToolChoice: "always"}, wantErr: "unsupported tool_choice"},
+		{name: "tool_choice function", config: &ReplayConfig{ToolChoice: map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "lookup"}}}},
+		{name: "tool_choice function without name", config: &ReplayConfig{ToolChoice: map[string]interface{}{"type": "function", "function": map[string]interface{}{}}}, wantErr: "function.name"},
+		{name: "tool_choice wrong type", config: &ReplayConfig{ToolChoice: 1}, wantErr: "string or an object"},
+		{name: "logit_bias out of range", config: &ReplayConfig{LogitBias: map[string]int{"50256": -101}}, wantErr: "logit_bias"},
+		{name: "reasoning_effort", config: &ReplayConfig{ReasoningEffort: "high"}},
+		{name: "unknown reasoning_effort", config: &ReplayConfig{ReasoningEffort: "max"}, wantErr: "reasoning_effort"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.config.Validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestReplayConfigApply(t *testing.T) {
+	base := func() openai.ChatCompletionRequest {
+		return openai.ChatCompletionRequest{Model: "m", Temperature: 1, MaxTokens: 50, Stop: []string{"END"}, User: "original"}
+	}
+
+	cases := []struct {
+		name   string
+		config *ReplayConfig
+		want   func(req *openai.ChatCompletionRequest)
+	}{
+		{name: "nil config keeps request", config: nil, want: func(req *openai.ChatCompletionRequest) {}},
+		{name: "empty config keeps request", config: &ReplayConfig{}, want: func(req *openai.ChatCompletionRequest) {}},
+		{
+			name:   "set fields override",
+			config: &ReplayConfig{Temperature: float32Ptr(0), MaxTokens: intPtr(10), Seed: intPtr(7), User: "replay"},
+			want: func(req *openai.ChatCompletionRequest) {
+				req.Temperature = math.SmallestNonzeroFloat32
+				req.MaxTokens = 10
+				req.Seed = intPtr(7)
+				req.User = "replay"
+			},
+		},
+		{
+			name:   "empty stop clears stop sequences",
+			config: &ReplayConfig{Stop: []string{}},
+			want:   func(req *openai.ChatCompletionRequest) { req.Stop = []string{} },
+		},
+		{
+			name:   "tool and format options",
+			config: &ReplayConfig{ToolChoice: "none", ParallelToolCalls: boolPtr(false), ReasoningEffort: "low", ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}},
+			want: func(req *openai.ChatCompletionRequest) {
+				req.ToolChoice = "none"
+				req.ParallelToolCalls = false
+				req.ReasoningEffort = "low"
+				req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := base()
+			tc.config.apply(&got)
+			want := base()
+			tc.want(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("apply = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReplayRecordLoadsLegacyConfig(t *testing.T) {
+	setupTestEnv(t, nil)
+
+	cases := []struct {
+		name   string
+		config string
+		want   *ReplayConfig
+	}{
+		{name: "typed config", config: `{"temperature":0.5}`, want: &ReplayConfig{Temperature: float32Ptr(0.5)}},
+		{name: "empty", config: ``, want: nil},
+		{name: "null", config: `null`, want: nil},
+		{name: "wrong field type", config: `{"temperature":"0.5","max_tokens":"100"}`, want: nil},
+		{name: "not an object", config: `"temperature=0.5"`, want: nil},
+		{name: "not json", config: `temperature=0.5`, want: nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id := uuid.New().String()
+			if err := db.Exec("INSERT INTO replay_records (id, replay_session_id, turn_number, request, status, config) VALUES (?, ?, ?, ?, ?, ?)",
+				id, "rs", 1, "{}", "success", tc.config).Error; err != nil {
+				t.Fatalf("insert legacy row: %v", err)
+			}
+
+			record, err := getReplayRecord(id)
+			if err != nil || record == nil {
+				t.Fatalf("getReplayRecord: %v, %v", record, err)
+			}
+			if !reflect.DeepEqual(record.Config, tc.want) {
+				t.Fatalf("config = %+v, want %+v", record.Config, tc.want)
+			}
+		})
+	}
+}
+
+func TestReplayDebugSendsExplicitZeroConfig(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		json.Unmarshal(raw, &body)
+		bodies <- body
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+	r := newTestRouter()
+
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "r", OriginalSessionID: "s1", StartTurnNumber: 1}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+
+	w := doJSON(t, r, http.MethodPost, "/api/replay-debug", map[string]interface{}{
+		"replay_session_id": replaySession.ID,
+		"turn_number":       1,
+		"request":           json.RawMessage(`{"model":"m","temperature":0.9,"top_p":0.5,"presence_penalty":0.5,"messages":[{"role":"user","content":"hi"}]}`),
+		"provider":          "stub",
+		"config":            map[string]interface{}{"temperature": 0, "top_p": 0, "presence_penalty": 0, "frequency_penalty": 0},
+	}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("replay debug: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	body := <-bodies
+	for _, field := range []string{"temperature", "top_p", "presence_penalty", "frequency_penalty"} {
+		value, ok := body[field].(float64)
+		if !ok || value > 1e-30 {
+			t.Errorf("provider received %s = %v, want an explicit zero", field, body[field])
+		}
+	}
+
+	var resp struct {
+		Data ReplayRecord `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode replay debug: %v", err)
+	}
+	stored, err := getReplayRecord(resp.Data.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("getReplayRecord: %v, %v", stored, err)
+	}
+	var saved openai.ChatCompletionRequest
+	if err := json.Unmarshal([]byte(stored.Request), &saved); err != nil {
+		t.Fatalf("decode saved request: %v", err)
+	}
+	if saved.Temperature > 1e-30 || saved.TopP > 1e-30 || saved.PresencePenalty > 1e-30 {
+		t.Fatalf("saved request %s, want the request with the config applied", stored.Request)
+	}
+}
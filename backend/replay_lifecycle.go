@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadReplaySession 根据路径参数加载重放会话，失败时直接写入错误响应
+func loadReplaySession(c *gin.Context) *ReplaySession {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay Session ID is required",
+		})
+		return nil
+	}
+
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return nil
+	}
+
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return nil
+	}
+
+	return replaySession
+}
+
+// bindOptionalJSON 请求体为空时跳过绑定
+func bindOptionalJSON(c *gin.Context, obj interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// respondUpdatedReplaySession 返回更新后的重放会话
+func respondUpdatedReplaySession(c *gin.Context, sessionID string) {
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    replaySession,
+	})
+}
+
+// handleUpdateReplaySession 重命名重放会话或更新调试结论
+func handleUpdateReplaySession(c *gin.Context) {
+	replaySession := loadReplaySession(c)
+	if replaySession == nil {
+		return
+	}
+
+	var req UpdateReplaySessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Name cannot be empty",
+			})
+			return
+		}
+		updates["name"] = name
+	}
+	if req.Conclusion != nil {
+		updates["conclusion"] = *req.Conclusion
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if err := updateReplaySession(replaySession.ID, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update replay session: " + err.Error(),
+		})
+		return
+	}
+
+	respondUpdatedReplaySession(c, replaySession.ID)
+}
+
+// handleCompleteReplaySession 将重放会话标记为已完成，可同时记录调试结论
+func handleCompleteReplaySession(c *gin.Context) {
+	replaySession := loadReplaySession(c)
+	if replaySession == nil {
+		return
+	}
+
+	var req CompleteReplaySessionRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	if replaySession.Status == "running" || replaySession.Status == "archived" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot complete replay session in status: " + replaySession.Status,
+		})
+		return
+	}
+
+	updates := map[string]interface{}{"status": "completed"}
+	if req.Conclusion != "" {
+		updates["conclusion"] = req.Conclusion
+	}
+
+	if err := updateReplaySession(replaySession.ID, updates); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to complete replay session: " + err.Error(),
+		})
+		return
+	}
+
+	respondUpdatedReplaySession(c, replaySession.ID)
+}
+
+// handleArchiveReplaySession 归档重放会话，归档后不能继续调试
+func handleArchiveReplaySession(c *gin.Context) {
+	replaySession := loadReplaySession(c)
+	if replaySession == nil {
+		return
+	}
+
+	if replaySession.Status == "running" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot archive a running replay session",
+		})
+		return
+	}
+
+	if err := updateReplaySessionStatus(replaySession.ID, "archived"); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to archive replay session: " + err.Error(),
+		})
+		return
+	}
+
+	respondUpdatedReplaySession(c, replaySession.ID)
+}
+
+// handleCloneReplaySession 复制重放会话，包括重放记录和会话级工具桩
+func handleCloneReplaySession(c *gin.Context) {
+	replaySession := loadReplaySession(c)
+	if replaySession == nil {
+		return
+	}
+
+	var req CloneReplaySessionRequest
+	if !bindOptionalJSON(c, &req) {
+		return
+	}
+
+	if replaySession.Status == "running" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot clone a running replay session",
+		})
+		return
+	}
+
+	clone, err := cloneReplaySession(replaySession, req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to clone replay session: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    clone,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReplaySessionLifecycle(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	for _, session := range []*Session{
+		{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"},
+		{ID: "s2", ProjectID: DefaultProjectID, Name: "s2"},
+	} {
+		if err := db.Create(session).Error; err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	decode := func(body []byte) ReplaySession {
+		t.Helper()
+		var resp struct {
+			Data ReplaySession `json:"data"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("decode replay session: %v", err)
+		}
+		return resp.Data
+	}
+	post := func(path string, body interface{}) (int, ReplaySession) {
+		t.Helper()
+		w := doJSON(t, r, http.MethodPost, path, body, nil)
+		if w.Code != http.StatusOK {
+			return w.Code, ReplaySession{}
+		}
+		return w.Code, decode(w.Body.Bytes())
+	}
+
+	replaySession := createTestReplaySession(t, r, "s1", 1)
+	if replaySession.Status != "active" {
+		t.Fatalf("new replay session status = %q, want active", replaySession.Status)
+	}
+	path := "/api/replay-sessions/" + replaySession.ID
+
+	// 重命名和记录结论
+	if w := doJSON(t, r, http.MethodPatch, path, map[string]string{}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty update: status %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, path, map[string]string{"name": "  "}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("blank name: status %d, want 400", w.Code)
+	}
+	w := doJSON(t, r, http.MethodPatch, path, UpdateReplaySessionRequest{Name: stringPtr(" prompt v3 "), Conclusion: stringPtr("investigating")}, nil)
+	if updated := decode(w.Body.Bytes()); w.Code != http.StatusOK || updated.Name != "prompt v3" || updated.Conclusion != "investigating" {
+		t.Fatalf("update: status %d, replay session %+v", w.Code, updated)
+	}
+
+	// 完成时可同时记录结论，未传结论时保留原有结论
+	code, completed := post(path+"/complete", CompleteReplaySessionRequest{Conclusion: "fixed by prompt v3"})
+	if code != http.StatusOK || completed.Status != "completed" || completed.Conclusion != "fixed by prompt v3" {
+		t.Fatalf("complete: status %d, replay session %+v", code, completed)
+	}
+	if code, completed := post(path+"/complete", nil); code != http.StatusOK || completed.Conclusion != "fixed by prompt v3" {
+		t.Fatalf("complete without body: status %d, replay session %+v", code, completed)
+	}
+
+	// 复制时带上重放记录和会话级工具桩，副本重新开始调试
+	replayRecord := &ReplayRecord{ID: uuid.New().String(), ReplaySessionID: replaySession.ID, TurnNumber: 1, Request: `{"model":"m"}`, Status: "success"}
+	if err := db.Create(replayRecord).Error; err != nil {
+		t.Fatalf("create replay record: %v", err)
+	}
+	if err := db.Create(&ToolStub{ID: uuid.New().String(), ProjectID: DefaultProjectID, ReplaySessionID: replaySession.ID, ToolName: "lookup", Response: "42"}).Error; err != nil {
+		t.Fatalf("create tool stub: %v", err)
+	}
+	code, clone := post(path+"/clone", CloneReplaySessionRequest{})
+	if code != http.StatusOK || clone.ID == replaySession.ID || clone.Name != "prompt v3-副本" || clone.Status != "active" || clone.Conclusion != "" {
+		t.Fatalf("clone: status %d, replay session %+v", code, clone)
+	}
+	var clonedRecords []ReplayRecord
+	if err := db.Where("replay_session_id = ?", clone.ID).Find(&clonedRecords).Error; err != nil || len(clonedRecords) != 1 || clonedRecords[0].ID == replayRecord.ID {
+		t.Fatalf("cloned replay records: %+v (err %v)", clonedRecords, err)
+	}
+	if stubs, err := getToolStubs(DefaultProjectID, clone.ID); err != nil || len(stubs) != 1 || stubs[0].ReplaySessionID != clone.ID {
+		t.Fatalf("cloned tool stubs: %+v (err %v)", stubs, err)
+	}
+
+	// 归档后不能再完成或继续调试
+	if code, archived := post(path+"/archive", nil); code != http.StatusOK || archived.Status != "archived" {
+		t.Fatalf("archive: status %d, replay session %+v", code, archived)
+	}
+	if code, _ := post(path+"/complete", nil); code != http.StatusBadRequest {
+		t.Fatalf("complete archived: status %d, want 400", code)
+	}
+	debug := map[string]interface{}{"replay_session_id": replaySession.ID, "turn_number": 1, "request": json.RawMessage(`{"model":"m","messages":[{"role":"user","content":"hi"}]}`)}
+	if w := doJSON(t, r, http.MethodPost, "/api/replay-debug", debug, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("replay debug on archived session: status %d, want 400", w.Code)
+	}
+
+	// 全量重放进行中的会话不能完成、归档或复制
+	running := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "running", OriginalSessionID: "s2", StartTurnNumber: 1, Status: "running"}
+	if err := db.Create(running).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+	for _, action := range []string{"complete", "archive", "clone"} {
+		if code, _ := post("/api/replay-sessions/"+running.ID+"/"+action, nil); code != http.StatusBadRequest {
+			t.Errorf("%s running replay session: status %d, want 400", action, code)
+		}
+	}
+
+	// 其他项目不能修改重放会话
+	for _, action := range []string{"complete", "archive", "clone"} {
+		if w := doJSON(t, r, http.MethodPost, "/api/replay-sessions/"+clone.ID+"/"+action, nil, map[string]string{ProjectHeader: "other"}); w.Code != http.StatusNotFound {
+			t.Errorf("%s from another project: status %d, want 404", action, w.Code)
+		}
+	}
+
+	// 列表按原始会话和状态过滤
+	cases := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: 3},
+		{query: "?original_session_id=s1", want: 2},
+		{query: "?status=archived", want: 1},
+		{query: "?status=active&original_session_id=s1", want: 1},
+		{query: "?status=running&original_session_id=s1", want: 0},
+	}
+	for _, tc := range cases {
+		w := doJSON(t, r, http.MethodGet, "/api/replay-sessions"+tc.query, nil, nil)
+		var resp struct {
+			Data PaginatedResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode replay sessions: %v", err)
+		}
+		if resp.Data.Total != tc.want {
+			t.Errorf("replay sessions%s: total %d, want %d", tc.query, resp.Data.Total, tc.want)
+		}
+	}
+}
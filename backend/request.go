@@ -1,66 +1,631 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
+
+	"github.com/sashabaranov/go-openai"
 )
 
 // TraceRequest 埋点请求数据结构
 type TraceRequest struct {
-	SessionID    string      `json:"session_id" binding:"required"`
-	TurnNumber   int         `json:"turn_number" binding:"required"`
-	Request      interface{} `json:"request" binding:"required"`
-	Response     interface{} `json:"response"`
-	Status       string      `json:"status" binding:"required"` // success/error/pending
-	ErrorMessage string      `json:"error_message"`
-	Metadata     interface{} `json:"metadata"`
+	SessionID     string      `json:"session_id" binding:"required"`
+	TurnNumber    int         `json:"turn_number" binding:"required"`
+	Request       interface{} `json:"request" binding:"required"`
+	Response      interface{} `json:"response"`
+	Status        string      `json:"status" binding:"required"` // success/error/pending/cancelled
+	ErrorMessage  string      `json:"error_message"`
+	Metadata      interface{} `json:"metadata"`
+	LatencyMs     int64       `json:"latency_ms"`     // 调用耗时（毫秒）
+	ErrorCategory string      `json:"error_category"` // 错误分类，为空时根据错误信息自动识别
+	Attempts      int         `json:"attempts"`       // 调用尝试次数（含重试）
+
+	// 会话级字段，创建会话时写入；会话已存在时只补充为空的字段，attributes 只补充不存在的键
+	SessionName       string                 `json:"session_name"`       // 会话名称，为空时自动生成
+	UserID            string                 `json:"user_id"`            // 终端用户标识
+	AppName           string                 `json:"app_name"`           // 应用或服务名称
+	Environment       string                 `json:"environment"`        // 运行环境，例如 production/staging
+	Version           string                 `json:"version"`            // 应用版本
+	SessionAttributes map[string]interface{} `json:"session_attributes"` // 自定义会话属性
+
+	Project   string `json:"project"` // 项目ID或名称，为空时使用请求头 X-Project 指定的项目
+	ProjectID string `json:"-"`       // 解析后的项目ID
 }
 
-// Session 对话会话（生产环境）
-type Session struct {
+// Project 项目，会话、调用记录、重放会话、数据集、实验运行、评审模型评估器和标签都归属于一个项目
+type Project struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	Name        string    `json:"name" gorm:"type:varchar(100);not null;uniqueIndex"`
+	Description string    `json:"description" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// CreateProjectRequest 创建项目请求
+type CreateProjectRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// UpdateProjectRequest 更新项目请求，未设置的字段保持不变
+type UpdateProjectRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// APIKey API密钥，只保存密钥的SHA-256摘要，明文只在创建时返回一次
+type APIKey struct {
+	ID         string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null"`
+	Scope      string     `json:"scope" gorm:"type:varchar(20);not null"`    // ingest/read/debug/admin
+	ProjectID  string     `json:"project_id" gorm:"type:varchar(255);index"` // 为空时可通过 X-Project 访问任意项目
+	Prefix     string     `json:"prefix" gorm:"type:varchar(20)"`            // 密钥开头几位，用于辨认密钥
+	KeyHash    string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+
+	// Key 密钥明文，只在创建响应中返回
+	Key string `json:"key,omitempty" gorm:"-"`
+}
+
+// CreateAPIKeyRequest 创建API密钥请求
+type CreateAPIKeyRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Scope   string `json:"scope" binding:"required"`
+	Project string `json:"project"` // 项目ID或名称，为空时不限项目
+}
+
+// User Web界面用户，密码使用bcrypt保存
+type User struct {
+	ID           string     `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	Username     string     `json:"username" gorm:"type:varchar(100);not null;uniqueIndex"`
+	PasswordHash string     `json:"-" gorm:"type:varchar(100);not null"`
+	Role         string     `json:"role" gorm:"type:varchar(20);not null"` // viewer/debugger/admin
+	Disabled     bool       `json:"disabled" gorm:"not null;default:false"`
+	LastLoginAt  *time.Time `json:"last_login_at"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// LoginSession 用户登录会话，Cookie中保存随机令牌，数据库只保存令牌的SHA-256摘要
+type LoginSession struct {
 	ID        string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	Name      string    `json:"name" gorm:"type:varchar(255);not null"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(255);not null;index"`
+	TokenHash string    `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateUserRequest 创建用户请求
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// UpdateUserRequest 更新用户请求，未设置的字段保持不变
+type UpdateUserRequest struct {
+	Role     *string `json:"role"`
+	Password *string `json:"password"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// ChangePasswordRequest 修改自己的密码
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// RecordFilter 记录列表过滤条件
+type RecordFilter struct {
+	ErrorCategory string
+	Tags          []string // 标签名称，记录需带有全部标签（只对调用记录生效）
+	ProjectID     string   // 标签所属的项目（只用于标签过滤）
+}
+
+// SessionFilter 会话列表过滤条件
+type SessionFilter struct {
+	ProjectID   string
+	Name        string // 名称模糊匹配
+	UserID      string
+	AppName     string
+	Environment string
+	Version     string
+	Attributes  map[string]string // 自定义属性，会话需匹配全部键值
+	Tags        []string          // 标签名称，会话需带有全部标签
+}
+
+// Session 对话会话（生产环境）
+type Session struct {
+	ID          string                 `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID   string                 `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	Name        string                 `json:"name" gorm:"type:varchar(255);not null"`
+	UserID      string                 `json:"user_id" gorm:"type:varchar(255);index"`      // 终端用户标识
+	AppName     string                 `json:"app_name" gorm:"type:varchar(255);index"`     // 应用或服务名称
+	Environment string                 `json:"environment" gorm:"type:varchar(100);index"`  // 运行环境
+	Version     string                 `json:"version" gorm:"type:varchar(100)"`            // 应用版本
+	Attributes  map[string]interface{} `json:"attributes" gorm:"serializer:json;type:text"` // 自定义会话属性
+	CreatedAt   time.Time              `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time              `json:"updated_at" gorm:"autoUpdateTime"`
+
+	Tags []Tag `json:"tags,omitempty" gorm:"-"` // 会话的标签
+}
+
+// UpdateSessionRequest 修改会话名称和会话级字段（只更新传入的字段）
+type UpdateSessionRequest struct {
+	Name        *string                `json:"name"`
+	UserID      *string                `json:"user_id"`
+	AppName     *string                `json:"app_name"`
+	Environment *string                `json:"environment"`
+	Version     *string                `json:"version"`
+	Attributes  map[string]interface{} `json:"attributes"` // 与已有属性合并，值为null时删除该键
+}
+
 // Record 调用记录（生产环境）
 type Record struct {
-	ID         string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	SessionID  string    `json:"session_id" gorm:"type:varchar(255);not null;index"`
-	TurnNumber int       `json:"turn_number" gorm:"not null"`
-	Request    string    `json:"request" gorm:"type:text;not null"`
-	Response   string    `json:"response" gorm:"type:text"`
-	Status     string    `json:"status" gorm:"type:varchar(50);not null"`
-	ErrorMsg   string    `json:"error_msg" gorm:"type:text"`
-	Metadata   string    `json:"metadata" gorm:"type:text"`
-	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+	ID            string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID     string    `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	SessionID     string    `json:"session_id" gorm:"type:varchar(255);not null;index"`
+	TurnNumber    int       `json:"turn_number" gorm:"not null"`
+	Request       string    `json:"request" gorm:"type:text;not null"`
+	Response      string    `json:"response" gorm:"type:text"`
+	Status        string    `json:"status" gorm:"type:varchar(50);not null"`
+	ErrorMsg      string    `json:"error_msg" gorm:"type:text"`
+	Metadata      string    `json:"metadata" gorm:"type:text"`
+	LatencyMs     int64     `json:"latency_ms"`                                   // 调用耗时（毫秒）
+	ErrorCategory string    `json:"error_category" gorm:"type:varchar(50);index"` // 错误分类
+	Attempts      int       `json:"attempts"`                                     // 调用尝试次数（含重试）
+	CreatedAt     time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+
+	AssertionResults []AssertionResult `json:"assertion_results,omitempty" gorm:"-"` // 重放时附带的检查结果
+	JudgeScores      []JudgeScore      `json:"judge_scores,omitempty" gorm:"-"`      // 重放时附带的评审评分
+	Tags             []Tag             `json:"tags,omitempty" gorm:"-"`              // 记录的标签
 }
 
 // ReplaySession 重放调试会话
 type ReplaySession struct {
-	ID                string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	Name              string    `json:"name" gorm:"type:varchar(255);not null"`
-	OriginalSessionID string    `json:"original_session_id" gorm:"type:varchar(255);not null;index"`
-	StartTurnNumber   int       `json:"start_turn_number" gorm:"not null"`
-	Status            string    `json:"status" gorm:"type:varchar(50);not null;default:'active'"` // active/completed
-	CreatedAt         time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt         time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+	ID                    string                         `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID             string                         `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	Name                  string                         `json:"name" gorm:"type:varchar(255);not null"`
+	OriginalSessionID     string                         `json:"original_session_id" gorm:"type:varchar(255);not null;index"`
+	StartTurnNumber       int                            `json:"start_turn_number" gorm:"not null"`
+	Status                string                         `json:"status" gorm:"type:varchar(50);not null;default:'active'"` // active/running/completed/failed/archived/cancelled
+	Mode                  string                         `json:"mode" gorm:"type:varchar(50)"`                             // 全量重放模式（original/chained），为空表示手动调试
+	TotalTurns            int                            `json:"total_turns"`                                              // 全量重放的总轮次
+	CompletedTurns        int                            `json:"completed_turns"`                                          // 全量重放已完成的轮次
+	FailedTurns           int                            `json:"failed_turns"`                                             // 全量重放失败的轮次
+	ParentReplaySessionID string                         `json:"parent_replay_session_id" gorm:"type:varchar(255);index"`  // 分支来源的重放会话
+	ParentReplayRecordID  string                         `json:"parent_replay_record_id" gorm:"type:varchar(255);index"`   // 分支来源的重放记录
+	BaseContext           []openai.ChatCompletionMessage `json:"base_context" gorm:"serializer:json;type:text"`            // 起始轮次之前的对话历史，调试重放时自动拼接在请求消息之前
+	Conclusion            string                         `json:"conclusion" gorm:"type:text"`                              // 调试结论，例如「prompt v3 修复」
+	CreatedAt             time.Time                      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt             time.Time                      `json:"updated_at" gorm:"autoUpdateTime"`
+
+	Tags []Tag `json:"tags,omitempty" gorm:"-"` // 重放会话的标签
 }
 
 // ReplayRecord 重放调试记录
 type ReplayRecord struct {
+	ID                 string            `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ReplaySessionID    string            `json:"replay_session_id" gorm:"type:varchar(255);not null;index"`
+	TurnNumber         int               `json:"turn_number" gorm:"not null"`
+	Request            string            `json:"request" gorm:"type:text;not null"`
+	Response           string            `json:"response" gorm:"type:text"`
+	Status             string            `json:"status" gorm:"type:varchar(50);not null"`
+	ErrorMsg           string            `json:"error_msg" gorm:"type:text"`
+	Provider           string            `json:"provider" gorm:"type:varchar(100)"`
+	Model              string            `json:"model" gorm:"type:varchar(100)"`
+	Config             *ReplayConfig     `json:"config" gorm:"serializer:lenientjson;type:text"`     // 调试配置（温度、token等），无法解析的旧数据按未设置处理
+	ToolMode           string            `json:"tool_mode" gorm:"type:varchar(50)"`                  // 工具调用模式（manual/stub）
+	ToolCalls          string            `json:"tool_calls" gorm:"type:text"`                        // 模型发起的工具调用
+	ToolResults        string            `json:"tool_results" gorm:"type:text"`                      // 回填给模型的工具结果
+	UnmatchedToolCalls string            `json:"unmatched_tool_calls" gorm:"type:text"`              // recorded 模式下没有录制结果的工具调用
+	ContinuedFromID    string            `json:"continued_from_id" gorm:"type:varchar(255);index"`   // 工具往返中的上一条重放记录
+	OriginalRecordID   string            `json:"original_record_id" gorm:"type:varchar(255);index"`  // 被重放的原始记录
+	ComparisonGroupID  string            `json:"comparison_group_id" gorm:"type:varchar(255);index"` // 多模型对比分组
+	ExperimentRunID    string            `json:"experiment_run_id" gorm:"type:varchar(255);index"`   // 所属的实验运行
+	DatasetItemID      string            `json:"dataset_item_id" gorm:"type:varchar(255)"`           // 实验运行中对应的数据集条目
+	LatencyMs          int64             `json:"latency_ms"`                                         // 调用耗时（毫秒，不含排队时间）
+	QueueWaitMs        int64             `json:"queue_wait_ms"`                                      // 等待provider限流额度的时间（毫秒）
+	ErrorCategory      string            `json:"error_category" gorm:"type:varchar(50);index"`       // 错误分类
+	Attempts           int               `json:"attempts"`                                           // 调用尝试次数（含重试）
+	CacheHit           bool              `json:"cache_hit"`                                          // 响应来自缓存
+	FailedAttempts     []ProviderAttempt `json:"failed_attempts" gorm:"serializer:json;type:text"`   // 回退到备用provider之前失败的调用
+	Mutations          []RequestMutation `json:"mutations" gorm:"serializer:json;type:text"`         // 调用前对请求的修改操作
+	BaseRequest        string            `json:"base_request" gorm:"type:text"`                      // 修改前的原始请求
+	CreatedAt          time.Time         `json:"created_at" gorm:"autoCreateTime;index"`
+
+	AssertionResults []AssertionResult `json:"assertion_results,omitempty" gorm:"-"` // 重放时附带的检查结果
+	JudgeScores      []JudgeScore      `json:"judge_scores,omitempty" gorm:"-"`      // 重放时附带的评审评分
+}
+
+// CachedResponse 重放响应缓存，按provider、模型和规范化请求的哈希寻址
+type CachedResponse struct {
+	CacheKey         string    `json:"cache_key" gorm:"primaryKey;type:varchar(64)"`
+	Provider         string    `json:"provider" gorm:"type:varchar(100)"`          // 请求的provider
+	Model            string    `json:"model" gorm:"type:varchar(100)"`             // 请求的模型
+	ResponseProvider string    `json:"response_provider" gorm:"type:varchar(100)"` // 实际提供响应的provider（可能为备用provider）
+	ResponseModel    string    `json:"response_model" gorm:"type:varchar(100)"`
+	Response         string    `json:"response" gorm:"type:text;not null"`
+	HitCount         int       `json:"hit_count"`
+	LastHitAt        time.Time `json:"last_hit_at" gorm:"index"`
+	ExpiresAt        time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt        time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ProviderAttempt 回退到备用provider之前失败的一次provider调用
+type ProviderAttempt struct {
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	Attempts      int    `json:"attempts"` // 该provider的尝试次数（含重试）
+	ErrorCategory string `json:"error_category"`
+	ErrorMsg      string `json:"error_msg"`
+	LatencyMs     int64  `json:"latency_ms"`
+}
+
+// ToolStub 工具桩，用于在调试时自动回答工具调用
+type ToolStub struct {
 	ID              string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
-	ReplaySessionID string    `json:"replay_session_id" gorm:"type:varchar(255);not null;index"`
-	TurnNumber      int       `json:"turn_number" gorm:"not null"`
-	Request         string    `json:"request" gorm:"type:text;not null"`
+	ProjectID       string    `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	ReplaySessionID string    `json:"replay_session_id" gorm:"type:varchar(255);index"` // 为空表示项目内的全局工具桩
+	ToolName        string    `json:"tool_name" gorm:"type:varchar(255);not null;index"`
 	Response        string    `json:"response" gorm:"type:text"`
-	Status          string    `json:"status" gorm:"type:varchar(50);not null"`
-	ErrorMsg        string    `json:"error_msg" gorm:"type:text"`
-	Provider        string    `json:"provider" gorm:"type:varchar(100)"`
-	Model           string    `json:"model" gorm:"type:varchar(100)"`
-	Config          string    `json:"config" gorm:"type:text"` // 调试配置（温度、token等）
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Dataset 评测数据集，由生产环境的调用记录整理而成
+type Dataset struct {
+	ID          string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID   string    `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	Name        string    `json:"name" gorm:"type:varchar(255);not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	Version     int       `json:"version"`             // 最新发布的版本号，0表示尚未发布
+	ItemCount   int64     `json:"item_count" gorm:"-"` // 当前（未发布）的条目数
+	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// DatasetItem 数据集条目：输入消息和参考输出
+type DatasetItem struct {
+	ID                string                         `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	DatasetID         string                         `json:"dataset_id" gorm:"type:varchar(255);not null;index"`
+	SourceRecordID    string                         `json:"source_record_id" gorm:"type:varchar(255);index"` // 来源的调用记录
+	SourceSessionID   string                         `json:"source_session_id" gorm:"type:varchar(255)"`
+	TurnNumber        int                            `json:"turn_number"`
+	Position          int                            `json:"position"`                                             // 条目在数据集中的顺序
+	Request           string                         `json:"request" gorm:"type:text"`                             // 来源记录的完整请求JSON（模型、工具等参数）
+	Input             []openai.ChatCompletionMessage `json:"input" gorm:"serializer:json;type:text"`               // 输入消息
+	ExpectedOutput    string                         `json:"expected_output" gorm:"type:text"`                     // 参考输出，默认为原始响应的助手回复
+	ExpectedToolCalls []openai.ToolCall              `json:"expected_tool_calls" gorm:"serializer:json;type:text"` // 参考的工具调用
+	CreatedAt         time.Time                      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt         time.Time                      `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// DatasetVersion 数据集发布时的条目快照
+type DatasetVersion struct {
+	ID        string        `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	DatasetID string        `json:"dataset_id" gorm:"type:varchar(255);not null;uniqueIndex:idx_dataset_version"`
+	Version   int           `json:"version" gorm:"not null;uniqueIndex:idx_dataset_version"`
+	Note      string        `json:"note" gorm:"type:text"`
+	ItemCount int           `json:"item_count"`
+	Items     []DatasetItem `json:"items,omitempty" gorm:"serializer:json;type:text"`
+	CreatedAt time.Time     `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// ExperimentRun 实验运行：在数据集的一个版本上批量重放，统计通过率和变化率
+type ExperimentRun struct {
+	ID             string            `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID      string            `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	Name           string            `json:"name" gorm:"type:varchar(255);not null"`
+	DatasetID      string            `json:"dataset_id" gorm:"type:varchar(255);not null;index"`
+	DatasetVersion int               `json:"dataset_version"`
+	Provider       string            `json:"provider" gorm:"type:varchar(100)"`
+	Model          string            `json:"model" gorm:"type:varchar(100)"`
+	Config         *ReplayConfig     `json:"config" gorm:"serializer:json;type:text"`
+	Mutations      []RequestMutation `json:"mutations" gorm:"serializer:json;type:text"`
+	PassThreshold  float64           `json:"pass_threshold"`                                            // 与参考输出的相似度不低于该值视为通过
+	Status         string            `json:"status" gorm:"type:varchar(50);not null;default:'running'"` // running/completed/failed/cancelled
+	TotalItems     int               `json:"total_items"`
+	CompletedItems int               `json:"completed_items"` // 调用成功的条目数
+	FailedItems    int               `json:"failed_items"`    // 调用失败的条目数
+	PassedItems    int               `json:"passed_items"`
+	ChangedItems   int               `json:"changed_items"` // 输出与参考输出不一致的条目数
+	PassRate       float64           `json:"pass_rate"`     // 通过数 / 已执行条目数
+	ChangeRate     float64           `json:"change_rate"`   // 变化数 / 调用成功的条目数
+	CreatedAt      time.Time         `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time         `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// ExperimentResult 实验运行中单个数据集条目的结果
+type ExperimentResult struct {
+	ID             string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	RunID          string    `json:"run_id" gorm:"type:varchar(255);not null;index"`
+	DatasetItemID  string    `json:"dataset_item_id" gorm:"type:varchar(255);index"`
+	ReplayRecordID string    `json:"replay_record_id" gorm:"type:varchar(255)"`
+	Position       int       `json:"position"`
+	Status         string    `json:"status" gorm:"type:varchar(50);not null"` // success/error/cancelled
+	Output         string    `json:"output" gorm:"type:text"`
+	Similarity     float64   `json:"similarity"` // 与参考输出的相似度（0-1）
+	Changed        bool      `json:"changed"`
+	Passed         bool      `json:"passed"`
+	ErrorMsg       string    `json:"error_msg" gorm:"type:text"`
+	LatencyMs      int64     `json:"latency_ms"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// AssertionResult 单条检查在一次重放输出上的结果
+type AssertionResult struct {
+	ID              string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ReplayRecordID  string    `json:"replay_record_id" gorm:"type:varchar(255);index"`  // 调试重放产生的重放记录
+	RecordID        string    `json:"record_id" gorm:"type:varchar(255);index"`         // 单次重放产生的调用记录
+	ReplaySessionID string    `json:"replay_session_id" gorm:"type:varchar(255);index"` // 调试重放所属的重放会话
+	SessionID       string    `json:"session_id" gorm:"type:varchar(255);index"`        // 单次重放所属的会话
+	Position        int       `json:"position"`                                         // 检查在请求中的位置
+	Type            string    `json:"type" gorm:"type:varchar(50);not null;index"`
+	Name            string    `json:"name" gorm:"type:varchar(255)"`
+	Assertion       Assertion `json:"assertion" gorm:"serializer:json;type:text"`
+	Passed          bool      `json:"passed" gorm:"index"`
+	Message         string    `json:"message" gorm:"type:text"` // 未通过的原因
 	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime;index"`
 }
 
+// JudgeCriterion 评审模型的评分维度
+type JudgeCriterion struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// JudgeEvaluator 评审模型评估器：使用配置的provider按评分标准为重放输出打分
+type JudgeEvaluator struct {
+	ID        string           `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID string           `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	Name      string           `json:"name" gorm:"type:varchar(255);not null"`
+	Provider  string           `json:"provider" gorm:"type:varchar(100);not null"`
+	Model     string           `json:"model" gorm:"type:varchar(100);not null"`
+	Rubric    string           `json:"rubric" gorm:"type:text"`                   // 评分标准说明，拼接在评审提示词中
+	Criteria  []JudgeCriterion `json:"criteria" gorm:"serializer:json;type:text"` // 评分维度
+	ScaleMin  int              `json:"scale_min"`                                 // 最低分
+	ScaleMax  int              `json:"scale_max"`                                 // 最高分
+	CreatedAt time.Time        `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time        `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// JudgeScore 评审模型对一次重放输出的评分
+type JudgeScore struct {
+	ID              string             `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	EvaluatorID     string             `json:"evaluator_id" gorm:"type:varchar(255);not null;index"`
+	EvaluatorName   string             `json:"evaluator_name" gorm:"type:varchar(255)"`
+	ReplayRecordID  string             `json:"replay_record_id" gorm:"type:varchar(255);index"`  // 被评分的重放记录
+	RecordID        string             `json:"record_id" gorm:"type:varchar(255);index"`         // 被评分的调用记录（单次重放）
+	ReplaySessionID string             `json:"replay_session_id" gorm:"type:varchar(255);index"` // 重放记录所属的重放会话
+	SessionID       string             `json:"session_id" gorm:"type:varchar(255);index"`        // 调用记录所属的会话
+	Provider        string             `json:"provider" gorm:"type:varchar(100)"`                // 实际提供评分的provider
+	Model           string             `json:"model" gorm:"type:varchar(100)"`
+	Reference       string             `json:"reference" gorm:"type:text"`              // 评分时使用的参考输出
+	Scores          map[string]float64 `json:"scores" gorm:"serializer:json;type:text"` // 各维度得分
+	OverallScore    float64            `json:"overall_score"`                           // 各维度得分的平均值
+	Rationale       string             `json:"rationale" gorm:"type:text"`              // 评审模型给出的理由
+	Status          string             `json:"status" gorm:"type:varchar(50);not null"` // success/error
+	ErrorMsg        string             `json:"error_msg" gorm:"type:text"`
+	LatencyMs       int64              `json:"latency_ms"`
+	CreatedAt       time.Time          `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Feedback 人工反馈：评审人员或终端用户对调用记录、重放记录的评价
+type Feedback struct {
+	ID              string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID       string    `json:"project_id" gorm:"type:varchar(255);not null;default:'default';index"`
+	RecordID        string    `json:"record_id" gorm:"type:varchar(255);index"`         // 被评价的调用记录
+	ReplayRecordID  string    `json:"replay_record_id" gorm:"type:varchar(255);index"`  // 被评价的重放记录
+	ReplaySessionID string    `json:"replay_session_id" gorm:"type:varchar(255);index"` // 重放记录所属的重放会话
+	SessionID       string    `json:"session_id" gorm:"type:varchar(255);index"`        // 调用记录所属的会话
+	TurnNumber      int       `json:"turn_number"`
+	Model           string    `json:"model" gorm:"type:varchar(100);index"`          // 被评价输出使用的模型
+	Source          string    `json:"source" gorm:"type:varchar(50);not null;index"` // reviewer/end_user
+	Author          string    `json:"author" gorm:"type:varchar(255);index"`         // 评审人员或终端用户标识
+	Rating          string    `json:"rating" gorm:"type:varchar(20);index"`          // good/bad，为空表示只打分或纠错
+	Score           *float64  `json:"score"`                                         // 可选的分数
+	Correction      string    `json:"correction" gorm:"type:text"`                   // 修正后的回复
+	Comment         string    `json:"comment" gorm:"type:text"`
+	Labels          []string  `json:"labels" gorm:"serializer:json;type:text"` // 自由标签
+	CreatedAt       time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+	UpdatedAt       time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// Tag 标签，可以添加到会话、调用记录和重放会话上
+type Tag struct {
+	ID        string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	ProjectID string    `json:"project_id" gorm:"type:varchar(255);not null;default:'default';uniqueIndex:idx_tag_project_name"`
+	Name      string    `json:"name" gorm:"type:varchar(100);not null;uniqueIndex:idx_tag_project_name"` // 项目内唯一
+	Color     string    `json:"color" gorm:"type:varchar(20)"`                                           // 前端展示颜色，例如 #ff4d4f
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TagAssignment 标签与会话、调用记录或重放会话的多对多关联
+type TagAssignment struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	TagID      string    `json:"tag_id" gorm:"type:varchar(255);not null;uniqueIndex:idx_tag_target"`
+	TargetType string    `json:"target_type" gorm:"type:varchar(50);not null;uniqueIndex:idx_tag_target;index:idx_tag_target_lookup"` // session/record/replay_session
+	TargetID   string    `json:"target_id" gorm:"type:varchar(255);not null;uniqueIndex:idx_tag_target;index:idx_tag_target_lookup"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// Note 会话、调用记录或重放会话上的自由文本备注
+type Note struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:varchar(255)"`
+	TargetType string    `json:"target_type" gorm:"type:varchar(50);not null;index:idx_note_target"` // session/record/replay_session
+	TargetID   string    `json:"target_id" gorm:"type:varchar(255);not null;index:idx_note_target"`
+	Author     string    `json:"author" gorm:"type:varchar(255)"`
+	Content    string    `json:"content" gorm:"type:text;not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// AssertionResultFilter 检查结果过滤条件
+type AssertionResultFilter struct {
+	ProjectID       string
+	ReplayRecordID  string
+	RecordID        string
+	ReplaySessionID string
+	SessionID       string
+	Type            string
+	Passed          *bool
+}
+
+// JudgeScoreFilter 评审评分过滤条件
+type JudgeScoreFilter struct {
+	ProjectID       string
+	EvaluatorID     string
+	ReplayRecordID  string
+	RecordID        string
+	ReplaySessionID string
+	SessionID       string
+	Status          string
+}
+
+// CreateJudgeEvaluatorRequest 创建评审模型评估器请求
+type CreateJudgeEvaluatorRequest struct {
+	Name     string           `json:"name" binding:"required"`
+	Provider string           `json:"provider" binding:"required"`
+	Model    string           `json:"model" binding:"required"`
+	Rubric   string           `json:"rubric"`
+	Criteria []JudgeCriterion `json:"criteria" binding:"dive"` // 为空时使用 correctness/helpfulness/safety
+	ScaleMin int              `json:"scale_min"`               // 为0时默认1
+	ScaleMax int              `json:"scale_max"`               // 为0时默认5
+}
+
+// UpdateJudgeEvaluatorRequest 更新评审模型评估器请求，未设置的字段保持不变
+type UpdateJudgeEvaluatorRequest struct {
+	Name     *string          `json:"name"`
+	Provider *string          `json:"provider"`
+	Model    *string          `json:"model"`
+	Rubric   *string          `json:"rubric"`
+	Criteria []JudgeCriterion `json:"criteria" binding:"dive"`
+	ScaleMin *int             `json:"scale_min"`
+	ScaleMax *int             `json:"scale_max"`
+}
+
+// JudgeEvaluateRequest 使用评估器为重放记录或调用记录评分
+type JudgeEvaluateRequest struct {
+	ReplayRecordID    string  `json:"replay_record_id"`    // 与 record_id 二选一
+	RecordID          string  `json:"record_id"`           // 与 replay_record_id 二选一
+	Reference         *string `json:"reference"`           // 参考输出，优先于其他来源
+	ReferenceRecordID string  `json:"reference_record_id"` // 使用该调用记录的回复作为参考输出
+	NoCache           bool    `json:"no_cache"`            // 为true时跳过响应缓存
+}
+
+// FeedbackFilter 反馈过滤条件
+type FeedbackFilter struct {
+	ProjectID      string
+	RecordID       string
+	ReplayRecordID string
+	SessionID      string
+	Model          string
+	Source         string
+	Author         string
+	Rating         string
+	Label          string
+}
+
+// CreateFeedbackRequest 评审人员提交反馈请求，rating、score、correction、comment、labels 至少设置一项
+type CreateFeedbackRequest struct {
+	Author     string   `json:"author"` // 登录用户提交时使用其用户名，否则必填
+	Rating     string   `json:"rating"` // good/bad（也接受 up/down）
+	Score      *float64 `json:"score"`
+	Correction string   `json:"correction"`
+	Comment    string   `json:"comment"`
+	Labels     []string `json:"labels"`
+}
+
+// UpdateFeedbackRequest 更新反馈请求，未设置的字段保持不变
+type UpdateFeedbackRequest struct {
+	Rating     *string  `json:"rating"`
+	Score      *float64 `json:"score"`
+	Correction *string  `json:"correction"`
+	Comment    *string  `json:"comment"`
+	Labels     []string `json:"labels"`
+}
+
+// IngestFeedbackRequest 应用上报终端用户反馈（点赞/点踩），按会话和轮次关联调用记录
+type IngestFeedbackRequest struct {
+	SessionID  string   `json:"session_id" binding:"required"`
+	TurnNumber int      `json:"turn_number" binding:"required"`
+	Rating     string   `json:"rating" binding:"required"` // up/down（也接受 good/bad）
+	UserID     string   `json:"user_id"`
+	Score      *float64 `json:"score"`
+	Comment    string   `json:"comment"`
+	Labels     []string `json:"labels"`
+}
+
+// FeedbackSummary 按会话或模型汇总的反馈统计
+type FeedbackSummary struct {
+	Key         string   `json:"key"` // 会话ID或模型
+	Total       int64    `json:"total"`
+	Good        int64    `json:"good"`
+	Bad         int64    `json:"bad"`
+	GoodRate    float64  `json:"good_rate"` // good / (good + bad)
+	ScoredCount int64    `json:"scored_count"`
+	AvgScore    *float64 `json:"avg_score"`
+}
+
+// CreateTagRequest 创建标签请求
+type CreateTagRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Color string `json:"color"`
+}
+
+// UpdateTagRequest 更新标签请求，未设置的字段保持不变
+type UpdateTagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+// AddTagsRequest 按名称添加标签，不存在的标签自动创建
+type AddTagsRequest struct {
+	Tags []string `json:"tags" binding:"required"`
+}
+
+// CreateNoteRequest 添加备注请求
+type CreateNoteRequest struct {
+	Author  string `json:"author"`
+	Content string `json:"content" binding:"required"`
+}
+
+// UpdateNoteRequest 修改备注请求
+type UpdateNoteRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// ReplaySessionFilter 重放会话列表过滤条件
+type ReplaySessionFilter struct {
+	ProjectID         string
+	OriginalSessionID string
+	Status            string
+	Tags              []string // 标签名称，重放会话需带有全部标签
+}
+
+// UpdateReplaySessionRequest 更新重放会话请求，未设置的字段保持不变
+type UpdateReplaySessionRequest struct {
+	Name       *string `json:"name"`
+	Conclusion *string `json:"conclusion"`
+}
+
+// CompleteReplaySessionRequest 完成重放会话请求
+type CompleteReplaySessionRequest struct {
+	Conclusion string `json:"conclusion"`
+}
+
+// CloneReplaySessionRequest 复制重放会话请求
+type CloneReplaySessionRequest struct {
+	Name string `json:"name"`
+}
+
 // CreateReplaySessionRequest 创建重放会话请求
 type CreateReplaySessionRequest struct {
 	OriginalSessionID string `json:"original_session_id" binding:"required"`
@@ -68,23 +633,357 @@ type CreateReplaySessionRequest struct {
 	Name              string `json:"name"`
 }
 
+// CreateDatasetRequest 创建数据集请求
+type CreateDatasetRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// UpdateDatasetRequest 更新数据集请求，未设置的字段保持不变
+type UpdateDatasetRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// DatasetRecordFilter 按条件挑选调用记录加入数据集
+type DatasetRecordFilter struct {
+	SessionID     string     `json:"session_id"`
+	Status        string     `json:"status"`
+	ErrorCategory string     `json:"error_category"`
+	CreatedAfter  *time.Time `json:"created_after"`
+	CreatedBefore *time.Time `json:"created_before"`
+}
+
+// AddDatasetItemsRequest 将调用记录加入数据集，record_ids 和 filter 至少提供一个
+type AddDatasetItemsRequest struct {
+	RecordIDs []string             `json:"record_ids"`
+	Filter    *DatasetRecordFilter `json:"filter"`
+	Limit     int                  `json:"limit"` // 按条件挑选时最多加入的记录数，默认100，最大1000
+}
+
+// AddDatasetItemsResponse 加入数据集的结果
+type AddDatasetItemsResponse struct {
+	Added   int           `json:"added"`
+	Skipped int           `json:"skipped"` // 已在数据集中或请求无法解析的记录
+	Items   []DatasetItem `json:"items"`
+}
+
+// UpdateDatasetItemRequest 编辑数据集条目，未设置的字段保持不变
+type UpdateDatasetItemRequest struct {
+	Input             []openai.ChatCompletionMessage `json:"input"`
+	ExpectedOutput    *string                        `json:"expected_output"`
+	ExpectedToolCalls []openai.ToolCall              `json:"expected_tool_calls"`
+}
+
+// CreateDatasetVersionRequest 发布数据集版本请求
+type CreateDatasetVersionRequest struct {
+	Note string `json:"note"`
+}
+
+// DatasetExportItem 导出的数据集条目
+type DatasetExportItem struct {
+	ID                string                         `json:"id"`
+	Input             []openai.ChatCompletionMessage `json:"input"`
+	ExpectedOutput    string                         `json:"expected_output"`
+	ExpectedToolCalls []openai.ToolCall              `json:"expected_tool_calls,omitempty"`
+	Request           json.RawMessage                `json:"request,omitempty"`
+	SourceRecordID    string                         `json:"source_record_id"`
+	SourceSessionID   string                         `json:"source_session_id"`
+	TurnNumber        int                            `json:"turn_number"`
+}
+
+// CreateExperimentRunRequest 创建实验运行请求
+// 指定 dataset_id 时在数据集上运行；否则按 record_ids 或 filter 挑选记录，保存为新的数据集后运行
+type CreateExperimentRunRequest struct {
+	Name           string               `json:"name"`
+	DatasetID      string               `json:"dataset_id"`
+	DatasetVersion int                  `json:"dataset_version"` // 为0时使用最新版本，数据集尚未发布时自动发布当前条目
+	RecordIDs      []string             `json:"record_ids"`
+	Filter         *DatasetRecordFilter `json:"filter"`
+	Limit          int                  `json:"limit"`
+	Provider       string               `json:"provider" binding:"required"`
+	Model          string               `json:"model"`
+	Config         *ReplayConfig        `json:"config"`
+	Mutations      []RequestMutation    `json:"mutations"`
+	TimeoutSeconds int                  `json:"timeout_seconds"`
+	NoCache        bool                 `json:"no_cache"`
+	PassThreshold  *float64             `json:"pass_threshold"` // 默认0.8
+	Concurrency    int                  `json:"concurrency"`    // 并发执行的条目数，默认4，最大16
+}
+
+// ExperimentRunFilter 实验运行列表过滤条件
+type ExperimentRunFilter struct {
+	ProjectID string
+	DatasetID string
+	Status    string
+}
+
+// ExperimentResultFilter 实验结果过滤条件
+type ExperimentResultFilter struct {
+	Passed  *bool
+	Changed *bool
+}
+
+// ExperimentItemComparison 两次实验运行中同一数据集条目的对比
+type ExperimentItemComparison struct {
+	DatasetItemID    string            `json:"dataset_item_id"`
+	Position         int               `json:"position"`
+	Base             *ExperimentResult `json:"base"`
+	Target           *ExperimentResult `json:"target"`
+	Verdict          string            `json:"verdict"`           // improved/regressed/unchanged/only_base/only_target
+	SimilarityDelta  float64           `json:"similarity_delta"`  // 目标运行与基准运行相对参考输出的相似度之差
+	OutputSimilarity *float64          `json:"output_similarity"` // 两次运行输出之间的相似度，任一失败时为空
+}
+
+// ExperimentComparisonSummary 实验运行对比汇总
+type ExperimentComparisonSummary struct {
+	Improved         int     `json:"improved"`
+	Regressed        int     `json:"regressed"`
+	Unchanged        int     `json:"unchanged"`
+	OnlyBase         int     `json:"only_base"`
+	OnlyTarget       int     `json:"only_target"`
+	BasePassRate     float64 `json:"base_pass_rate"`
+	TargetPassRate   float64 `json:"target_pass_rate"`
+	PassRateDelta    float64 `json:"pass_rate_delta"`
+	BaseChangeRate   float64 `json:"base_change_rate"`
+	TargetChangeRate float64 `json:"target_change_rate"`
+}
+
+// ExperimentRunComparison 两次实验运行的逐条对比结果
+type ExperimentRunComparison struct {
+	BaseRun   *ExperimentRun              `json:"base_run"`
+	TargetRun *ExperimentRun              `json:"target_run"`
+	Summary   ExperimentComparisonSummary `json:"summary"`
+	Items     []ExperimentItemComparison  `json:"items"`
+}
+
+// CancelReplayResponse 取消重放调用的结果
+type CancelReplayResponse struct {
+	ReplaySessionID string `json:"replay_session_id"`
+	Cancelled       int    `json:"cancelled"` // 被取消的进行中调用数量
+}
+
+// ForkReplaySessionRequest 从重放记录创建分支请求
+type ForkReplaySessionRequest struct {
+	Name string `json:"name"`
+}
+
+// ReplayRecordSummary 重放记录摘要
+type ReplayRecordSummary struct {
+	ID         string    `json:"id"`
+	TurnNumber int       `json:"turn_number"`
+	Status     string    `json:"status"`
+	Provider   string    `json:"provider"`
+	Model      string    `json:"model"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReplaySessionTreeNode 重放会话分支树节点
+type ReplaySessionTreeNode struct {
+	ReplaySession
+	Records  []ReplayRecordSummary    `json:"records"`
+	Children []*ReplaySessionTreeNode `json:"children"`
+}
+
+// SessionReplayRequest 全量会话重放请求
+type SessionReplayRequest struct {
+	Provider       string            `json:"provider" binding:"required"`
+	Model          string            `json:"model"`
+	Config         *ReplayConfig     `json:"config"`
+	Mode           string            `json:"mode"`      // original：保留原始历史；chained：将新响应带入下一轮
+	Mutations      []RequestMutation `json:"mutations"` // 每一轮调用前对请求的修改操作
+	Name           string            `json:"name"`
+	TimeoutSeconds int               `json:"timeout_seconds"` // 单个provider的调用超时（秒），为0时使用provider配置或默认值
+	NoCache        bool              `json:"no_cache"`        // 为true时跳过响应缓存
+}
+
+// TurnProgress 全量重放中单轮的执行状态
+type TurnProgress struct {
+	TurnNumber       int    `json:"turn_number"`
+	OriginalRecordID string `json:"original_record_id"`
+	ReplayRecordID   string `json:"replay_record_id,omitempty"`
+	Status           string `json:"status"` // pending/success/error/skipped
+	ErrorMsg         string `json:"error_msg,omitempty"`
+}
+
+// SessionReplayProgress 全量重放进度
+type SessionReplayProgress struct {
+	ReplaySessionID string         `json:"replay_session_id"`
+	Status          string         `json:"status"`
+	Mode            string         `json:"mode"`
+	TotalTurns      int            `json:"total_turns"`
+	CompletedTurns  int            `json:"completed_turns"`
+	FailedTurns     int            `json:"failed_turns"`
+	Turns           []TurnProgress `json:"turns"`
+}
+
 // ReplayRequest 重放请求（用于单次重放）
 type ReplayRequest struct {
-	SessionID  string      `json:"session_id" binding:"required"`
-	TurnNumber int         `json:"turn_number" binding:"required"`
-	Request    interface{} `json:"request" binding:"required"`
-	Provider   string      `json:"provider"`
-	Model      string      `json:"model"`
+	SessionID      string            `json:"session_id" binding:"required"`
+	TurnNumber     int               `json:"turn_number" binding:"required"`
+	Request        interface{}       `json:"request" binding:"required"`
+	Provider       string            `json:"provider"`
+	Model          string            `json:"model"`
+	Config         *ReplayConfig     `json:"config"`          // 重放参数
+	Mutations      []RequestMutation `json:"mutations"`       // 调用前对请求的修改操作
+	TimeoutSeconds int               `json:"timeout_seconds"` // 单个provider的调用超时（秒），为0时使用provider配置或默认值
+	NoCache        bool              `json:"no_cache"`        // 为true时跳过响应缓存
+	Assertions     []Assertion       `json:"assertions"`      // 调用成功后对输出执行的检查
+	Judges         []string          `json:"judges"`          // 调用成功后为输出评分的评估器ID，以原始记录的回复为参考
 }
 
 // ReplayDebugRequest 调试重放请求（用于多轮调试）
 type ReplayDebugRequest struct {
-	ReplaySessionID string      `json:"replay_session_id" binding:"required"`
-	TurnNumber      int         `json:"turn_number" binding:"required"`
-	Request         interface{} `json:"request" binding:"required"`
-	Provider        string      `json:"provider"`
-	Model           string      `json:"model"`
-	Config          interface{} `json:"config"` // 调试配置
+	ReplaySessionID string            `json:"replay_session_id" binding:"required"`
+	TurnNumber      int               `json:"turn_number" binding:"required"`
+	Request         interface{}       `json:"request" binding:"required"`
+	Provider        string            `json:"provider"`
+	Model           string            `json:"model"`
+	Config          *ReplayConfig     `json:"config"`            // 调试配置
+	RecordID        string            `json:"record_id"`         // 被重放的原始记录，为空时取原始会话中同一轮次的记录
+	Mutations       []RequestMutation `json:"mutations"`         // 调用前对请求的修改操作
+	ToolMode        string            `json:"tool_mode"`         // 工具调用模式：为空不处理，manual 暂停等待结果，stub 使用工具桩，recorded 使用原始会话的工具结果
+	SkipBaseContext bool              `json:"skip_base_context"` // 为true时不拼接重放会话的基础上下文（请求已包含完整历史）
+	TimeoutSeconds  int               `json:"timeout_seconds"`   // 单个provider的调用超时（秒），为0时使用provider配置或默认值
+	NoCache         bool              `json:"no_cache"`          // 为true时跳过响应缓存
+	Assertions      []Assertion       `json:"assertions"`        // 调用成功后对输出执行的检查（工具往返时针对最终输出）
+	Judges          []string          `json:"judges"`            // 调用成功后为最终输出评分的评估器ID
+}
+
+// ToolResult 工具调用结果
+type ToolResult struct {
+	ToolCallID string `json:"tool_call_id" binding:"required"`
+	Name       string `json:"name"`
+	Content    string `json:"content"`
+	Source     string `json:"source"` // manual/stub/recorded
+}
+
+// SubmitToolResultsRequest 提交工具结果请求
+type SubmitToolResultsRequest struct {
+	ReplayRecordID string       `json:"replay_record_id" binding:"required"`
+	Results        []ToolResult `json:"results" binding:"required,dive"`
+}
+
+// CreateToolStubRequest 注册工具桩请求
+type CreateToolStubRequest struct {
+	ReplaySessionID string      `json:"replay_session_id"`
+	ToolName        string      `json:"tool_name" binding:"required"`
+	Response        string      `json:"response"`      // 工具返回的原始文本
+	ResponseJSON    interface{} `json:"response_json"` // 工具返回的JSON，Response为空时使用
+}
+
+// CompareTarget 多模型对比中的一个目标
+type CompareTarget struct {
+	Provider       string        `json:"provider" binding:"required"`
+	Model          string        `json:"model"`
+	Config         *ReplayConfig `json:"config"`
+	TimeoutSeconds int           `json:"timeout_seconds"` // 单个目标的超时，为0时使用默认值
+}
+
+// CompareRequest 多模型对比重放请求
+type CompareRequest struct {
+	Targets         []CompareTarget   `json:"targets" binding:"required,min=1,dive"`
+	Request         interface{}       `json:"request"`           // 为空时使用原始记录的请求
+	Mutations       []RequestMutation `json:"mutations"`         // 所有目标共用的请求修改操作
+	ReplaySessionID string            `json:"replay_session_id"` // 为空时新建重放会话
+	Name            string            `json:"name"`
+	NoCache         bool              `json:"no_cache"` // 为true时跳过响应缓存
+}
+
+// CompareResult 多模型对比中单个目标的结果
+type CompareResult struct {
+	Index          int        `json:"index"`
+	Provider       string     `json:"provider"`
+	Model          string     `json:"model"`
+	ReplayRecordID string     `json:"replay_record_id,omitempty"`
+	Status         string     `json:"status"` // success/error/cancelled
+	ErrorMsg       string     `json:"error_msg,omitempty"`
+	ErrorCategory  string     `json:"error_category,omitempty"`
+	Content        string     `json:"content"`
+	LatencyMs      int64      `json:"latency_ms"`
+	Usage          TokenUsage `json:"usage"`
+	CacheHit       bool       `json:"cache_hit,omitempty"`
+}
+
+// CompareResponse 多模型对比结果
+type CompareResponse struct {
+	ComparisonGroupID string          `json:"comparison_group_id"`
+	ReplaySessionID   string          `json:"replay_session_id"`
+	RecordID          string          `json:"record_id"`
+	Results           []CompareResult `json:"results"`
+}
+
+// DiffOp 文本差异片段
+type DiffOp struct {
+	Op   string `json:"op"` // equal/insert/delete
+	Text string `json:"text"`
+}
+
+// JSONDiffEntry JSON字段差异
+type JSONDiffEntry struct {
+	Path     string      `json:"path"`
+	Op       string      `json:"op"` // added/removed/changed
+	Original interface{} `json:"original,omitempty"`
+	Replay   interface{} `json:"replay,omitempty"`
+}
+
+// ToolCallDiff 工具调用差异（按调用顺序配对）
+type ToolCallDiff struct {
+	Index        int             `json:"index"`
+	Status       string          `json:"status"` // equal/changed/added/removed
+	OriginalName string          `json:"original_name,omitempty"`
+	ReplayName   string          `json:"replay_name,omitempty"`
+	ArgumentDiff []JSONDiffEntry `json:"argument_diff,omitempty"`
+}
+
+// StringPair 原始值与重放值
+type StringPair struct {
+	Original string `json:"original"`
+	Replay   string `json:"replay"`
+	Equal    bool   `json:"equal"`
+}
+
+// TokenUsage token用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// UsageDiff token用量差异
+type UsageDiff struct {
+	Original TokenUsage `json:"original"`
+	Replay   TokenUsage `json:"replay"`
+	Delta    TokenUsage `json:"delta"` // 重放减去原始
+}
+
+// LatencyDiff 耗时差异
+type LatencyDiff struct {
+	OriginalMs int64 `json:"original_ms"`
+	ReplayMs   int64 `json:"replay_ms"`
+	DeltaMs    int64 `json:"delta_ms"` // 重放减去原始
+}
+
+// ResponseDiff 原始记录与单条重放记录的响应差异
+type ResponseDiff struct {
+	ReplayRecordID string         `json:"replay_record_id"`
+	Provider       string         `json:"provider"`
+	Model          string         `json:"model"`
+	ReplayContent  string         `json:"replay_content"`
+	ContentDiff    []DiffOp       `json:"content_diff"`
+	ToolCallDiffs  []ToolCallDiff `json:"tool_call_diffs"`
+	FinishReason   StringPair     `json:"finish_reason"`
+	Usage          UsageDiff      `json:"usage"`
+	Latency        LatencyDiff    `json:"latency"`
+	Similarity     float64        `json:"similarity"` // 0~1，1表示完全一致
+}
+
+// RecordDiffResult 原始记录与重放记录的对比结果
+type RecordDiffResult struct {
+	RecordID        string         `json:"record_id"`
+	Granularity     string         `json:"granularity"` // word/line
+	OriginalContent string         `json:"original_content"`
+	Diffs           []ResponseDiff `json:"diffs"`
 }
 
 // ModelInfo 模型信息
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// Provider错误分类
+const (
+	ErrorCategoryRateLimit      = "rate_limit"      // 限流（429）
+	ErrorCategoryAuth           = "auth"            // 认证或权限错误（401/403）
+	ErrorCategoryContextLength  = "context_length"  // 超出上下文长度
+	ErrorCategoryContentFilter  = "content_filter"  // 触发内容审核
+	ErrorCategoryTimeout        = "timeout"         // 调用超时
+	ErrorCategoryServer         = "server"          // provider服务端错误（5xx）
+	ErrorCategoryInvalidRequest = "invalid_request" // 其他请求错误（4xx）
+	ErrorCategoryNetwork        = "network"         // 网络连接错误
+	ErrorCategoryCancelled      = "cancelled"       // 调用被取消
+	ErrorCategoryUnknown        = "unknown"         // 无法识别的错误
+)
+
+// 重试策略默认值
+const (
+	defaultRetryMaxAttempts      = 3
+	defaultRetryInitialBackoff   = 500 * time.Millisecond
+	defaultRetryMaxBackoff       = 10 * time.Second
+	defaultRetryMultiplier       = 2.0
+	defaultRetryJitter           = 0.2
+	defaultRetryMaxRetryAfter    = 60 * time.Second
+	retryAfterHeader             = "Retry-After"
+	retryAfterMillisecondsHeader = "Retry-After-Ms"
+)
+
+var statusCodePattern = regexp.MustCompile(`status code: (\d{3})`)
+
+// retryPolicy 补全默认值后的重试策略
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	maxRetryAfter  time.Duration
+}
+
+// newRetryPolicy 根据配置生成重试策略，未配置的字段使用默认值
+func newRetryPolicy(cfg RetryConfig) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    cfg.MaxAttempts,
+		initialBackoff: time.Duration(cfg.InitialBackoffMs) * time.Millisecond,
+		maxBackoff:     time.Duration(cfg.MaxBackoffMs) * time.Millisecond,
+		multiplier:     cfg.Multiplier,
+		jitter:         cfg.Jitter,
+		maxRetryAfter:  time.Duration(cfg.MaxRetryAfterMs) * time.Millisecond,
+	}
+	if policy.maxAttempts <= 0 {
+		policy.maxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.initialBackoff <= 0 {
+		policy.initialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.multiplier < 1 {
+		policy.multiplier = defaultRetryMultiplier
+	}
+	if policy.jitter <= 0 || policy.jitter > 1 {
+		policy.jitter = defaultRetryJitter
+	}
+	if policy.maxRetryAfter <= 0 {
+		policy.maxRetryAfter = defaultRetryMaxRetryAfter
+	}
+	return policy
+}
+
+// providerRetryPolicy 获取provider的重试策略
+func providerRetryPolicy(provider string) retryPolicy {
+	providerConfig, _ := findProviderConfig(provider)
+	return newRetryPolicy(providerConfig.Retry)
+}
+
+// backoff 计算第attempt次失败后的等待时间（指数退避加随机抖动）
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.initialBackoff) * math.Pow(p.multiplier, float64(attempt-1))
+	if delay > float64(p.maxBackoff) {
+		delay = float64(p.maxBackoff)
+	}
+	delay *= 1 - p.jitter + 2*p.jitter*rand.Float64()
+	return time.Duration(delay)
+}
+
+// isRetryableCategory 判断该类错误是否可以通过重试恢复
+func isRetryableCategory(category string) bool {
+	switch category {
+	case ErrorCategoryRateLimit, ErrorCategoryServer, ErrorCategoryTimeout, ErrorCategoryNetwork:
+		return true
+	}
+	return false
+}
+
+// classifyProviderError 将provider调用错误归类
+func classifyProviderError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, errRateLimitQueueTimeout) {
+		return ErrorCategoryRateLimit
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrorCategoryCancelled
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCategoryTimeout
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		detail := fmt.Sprintf("%v %s %s", apiErr.Code, apiErr.Type, apiErr.Message)
+		if apiErr.InnerError != nil {
+			detail += " " + apiErr.InnerError.Code
+		}
+		return classifyHTTPError(apiErr.HTTPStatusCode, detail)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return classifyHTTPError(reqErr.HTTPStatusCode, string(reqErr.Body))
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorCategoryTimeout
+		}
+		return ErrorCategoryNetwork
+	}
+
+	return classifyErrorMessage(err.Error())
+}
+
+// classifyHTTPError 根据HTTP状态码和错误详情归类
+func classifyHTTPError(statusCode int, detail string) string {
+	detail = strings.ToLower(detail)
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorCategoryRateLimit
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorCategoryAuth
+	case isContentFilterError(detail):
+		return ErrorCategoryContentFilter
+	case isContextLengthError(detail):
+		return ErrorCategoryContextLength
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusGatewayTimeout:
+		return ErrorCategoryTimeout
+	case statusCode >= 500:
+		return ErrorCategoryServer
+	case statusCode >= 400:
+		return ErrorCategoryInvalidRequest
+	}
+	return classifyErrorMessage(detail)
+}
+
+// classifyErrorMessage 根据错误信息文本归类，用于只有错误字符串的场景（如埋点上报）
+func classifyErrorMessage(message string) string {
+	if message == "" {
+		return ErrorCategoryUnknown
+	}
+
+	if match := statusCodePattern.FindStringSubmatch(message); match != nil {
+		if statusCode, err := strconv.Atoi(match[1]); err == nil {
+			return classifyHTTPError(statusCode, message)
+		}
+	}
+
+	message = strings.ToLower(message)
+	switch {
+	case containsAny(message, "rate limit", "rate_limit", "too many requests"):
+		return ErrorCategoryRateLimit
+	case containsAny(message, "unauthorized", "invalid api key", "incorrect api key", "invalid_api_key", "permission denied", "api key not configured"):
+		return ErrorCategoryAuth
+	case isContentFilterError(message):
+		return ErrorCategoryContentFilter
+	case isContextLengthError(message):
+		return ErrorCategoryContextLength
+	case containsAny(message, "timeout", "timed out", "deadline exceeded"):
+		return ErrorCategoryTimeout
+	case containsAny(message, "internal server error", "bad gateway", "service unavailable", "overloaded"):
+		return ErrorCategoryServer
+	case containsAny(message, "connection refused", "connection reset", "no such host", "eof"):
+		return ErrorCategoryNetwork
+	}
+	return ErrorCategoryUnknown
+}
+
+// isContentFilterError 判断是否为内容审核错误
+func isContentFilterError(detail string) bool {
+	return containsAny(detail, "content_filter", "content filter", "content management policy", "responsibleaipolicyviolation", "content_policy_violation")
+}
+
+// isContextLengthError 判断是否为超出上下文长度错误
+func isContextLengthError(detail string) bool {
+	return containsAny(detail, "context_length_exceeded", "context length", "maximum context", "context window")
+}
+
+// containsAny 判断字符串是否包含任意一个子串
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfterKey 在请求上下文中保存Retry-After的键
+type retryAfterKey struct{}
+
+// retryAfterRecorder 记录provider响应中的Retry-After头
+type retryAfterRecorder struct {
+	doer openai.HTTPDoer
+}
+
+// Do 发送请求，并将Retry-After写入请求上下文中的位置
+func (r retryAfterRecorder) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.doer.Do(req)
+	if err == nil {
+		if retryAfter, ok := req.Context().Value(retryAfterKey{}).(*time.Duration); ok {
+			*retryAfter = parseRetryAfter(resp.Header)
+		}
+	}
+	return resp, err
+}
+
+// parseRetryAfter 解析Retry-After-Ms或Retry-After（秒数或HTTP日期）
+func parseRetryAfter(header http.Header) time.Duration {
+	if value := header.Get(retryAfterMillisecondsHeader); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+
+	value := header.Get(retryAfterHeader)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		return 0
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// callStats 一个provider上的调用统计
+type callStats struct {
+	Attempts  int           // 实际发出的调用次数（含重试）
+	QueueWait time.Duration // 等待限流额度的总时间
+}
+
+// createChatCompletionWithRetry 调用provider，按重试策略重试可恢复的错误
+// 每次调用前先在provider的限流器上排队，排队超时不再重试
+func createChatCompletionWithRetry(ctx context.Context, client *openai.Client, provider string, policy retryPolicy, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, callStats, error) {
+	var stats callStats
+	limiter := getProviderLimiter(provider)
+	estimatedTokens := estimateRequestTokens(req)
+
+	for attempt := 1; ; attempt++ {
+		queueWait, release, err := limiter.acquire(ctx, estimatedTokens)
+		stats.QueueWait += queueWait
+		if err != nil {
+			return openai.ChatCompletionResponse{}, stats, err
+		}
+
+		var retryAfter time.Duration
+		resp, err := client.CreateChatCompletion(context.WithValue(ctx, retryAfterKey{}, &retryAfter), req)
+		release(resp.Usage.TotalTokens)
+		stats.Attempts = attempt
+		if err == nil {
+			return resp, stats, nil
+		}
+
+		if ctx.Err() != nil {
+			return resp, stats, ctx.Err()
+		}
+		category := classifyProviderError(err)
+		if attempt >= policy.maxAttempts || !isRetryableCategory(category) {
+			return resp, stats, err
+		}
+
+		delay := policy.backoff(attempt)
+		if retryAfter > 0 {
+			if retryAfter > policy.maxRetryAfter {
+				return resp, stats, err
+			}
+			if retryAfter > delay {
+				delay = retryAfter
+			}
+		}
+
+		zapLogger.Warn("provider call failed, retrying",
+			zap.String("provider", provider),
+			zap.String("model", req.Model),
+			zap.Int("attempt", attempt),
+			zap.String("error_category", category),
+			zap.Duration("delay", delay),
+			zap.String("error", err.Error()))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			// 退避期间被取消时返回取消原因，而不是上一次调用的错误
+			timer.Stop()
+			return resp, stats, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestRetryReturnsContextErrorWhenCancelledDuringBackoff(t *testing.T) {
+	called := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case called <- struct{}{}:
+		default:
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(retryAfterHeader, "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"rate limited","type":"rate_limit_error"}}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true},
+	}})
+
+	client, err := newProviderClient("stub")
+	if err != nil {
+		t.Fatalf("newProviderClient: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// 第一次调用返回429后，在Retry-After退避期间取消
+	go func() {
+		<-called
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+	}()
+
+	req := openai.ChatCompletionRequest{
+		Model:    "m",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}},
+	}
+
+	start := time.Now()
+	_, stats, err := createChatCompletionWithRetry(ctx, client, "stub", providerRetryPolicy("stub"), req)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if classifyProviderError(err) != ErrorCategoryCancelled {
+		t.Fatalf("error category = %q, want %q", classifyProviderError(err), ErrorCategoryCancelled)
+	}
+	if stats.Attempts != 1 {
+		t.Fatalf("attempts = %d, want 1", stats.Attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("retry kept waiting %v after cancellation", elapsed)
+	}
+}
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyProviderError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "queue timeout", err: fmt.Errorf("acquire: %w", errRateLimitQueueTimeout), want: ErrorCategoryRateLimit},
+		{name: "cancelled", err: context.Canceled, want: ErrorCategoryCancelled},
+		{name: "deadline", err: fmt.Errorf("call: %w", context.DeadlineExceeded), want: ErrorCategoryTimeout},
+		{name: "api 429", err: &openai.APIError{HTTPStatusCode: 429, Message: "slow down"}, want: ErrorCategoryRateLimit},
+		{name: "api 401", err: &openai.APIError{HTTPStatusCode: 401, Message: "bad key"}, want: ErrorCategoryAuth},
+		{name: "api 403", err: &openai.APIError{HTTPStatusCode: 403}, want: ErrorCategoryAuth},
+		{name: "api context length code", err: &openai.APIError{HTTPStatusCode: 400, Code: "context_length_exceeded"}, want: ErrorCategoryContextLength},
+		{name: "api content filter message", err: &openai.APIError{HTTPStatusCode: 400, Message: "blocked by content management policy"}, want: ErrorCategoryContentFilter},
+		{name: "api inner error code", err: &openai.APIError{HTTPStatusCode: 400, InnerError: &openai.InnerError{Code: "ResponsibleAIPolicyViolation"}}, want: ErrorCategoryContentFilter},
+		{name: "api 504", err: &openai.APIError{HTTPStatusCode: 504}, want: ErrorCategoryTimeout},
+		{name: "api 503", err: &openai.APIError{HTTPStatusCode: 503}, want: ErrorCategoryServer},
+		{name: "api 422", err: &openai.APIError{HTTPStatusCode: 422, Message: "bad field"}, want: ErrorCategoryInvalidRequest},
+		{name: "request error 502", err: &openai.RequestError{HTTPStatusCode: 502, Body: []byte("bad gateway")}, want: ErrorCategoryServer},
+		{name: "request error 400 context window", err: &openai.RequestError{HTTPStatusCode: 400, Body: []byte("exceeds the context window")}, want: ErrorCategoryContextLength},
+		{name: "network timeout", err: fmt.Errorf("post: %w", timeoutError{}), want: ErrorCategoryTimeout},
+		{name: "network error", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: ErrorCategoryNetwork},
+		{name: "message with status code", err: errors.New("error, status code: 429, message: slow down"), want: ErrorCategoryRateLimit},
+		{name: "message api key", err: errors.New("provider stub: api key not configured"), want: ErrorCategoryAuth},
+		{name: "message overloaded", err: errors.New("model is overloaded"), want: ErrorCategoryServer},
+		{name: "message eof", err: errors.New("unexpected EOF"), want: ErrorCategoryNetwork},
+		{name: "unrecognised message", err: errors.New("something odd"), want: ErrorCategoryUnknown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyProviderError(tc.err); got != tc.want {
+				t.Fatalf("classifyProviderError(%v) = %q, want %q", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	cases := []struct {
+		name    string
+		headers map[string]string
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "missing", headers: nil},
+		{name: "seconds", headers: map[string]string{retryAfterHeader: "2"}, min: 2 * time.Second, max: 2 * time.Second},
+		{name: "fractional seconds", headers: map[string]string{retryAfterHeader: "0.5"}, min: 500 * time.Millisecond, max: 500 * time.Millisecond},
+		{name: "zero seconds", headers: map[string]string{retryAfterHeader: "0"}},
+		{name: "negative seconds", headers: map[string]string{retryAfterHeader: "-3"}},
+		{name: "milliseconds take precedence", headers: map[string]string{retryAfterMillisecondsHeader: "250", retryAfterHeader: "10"}, min: 250 * time.Millisecond, max: 250 * time.Millisecond},
+		{name: "invalid milliseconds fall back", headers: map[string]string{retryAfterMillisecondsHeader: "soon", retryAfterHeader: "1"}, min: time.Second, max: time.Second},
+		{name: "http date", headers: map[string]string{retryAfterHeader: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)}, min: 8 * time.Second, max: 10 * time.Second},
+		{name: "past http date", headers: map[string]string{retryAfterHeader: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}},
+		{name: "garbage", headers: map[string]string{retryAfterHeader: "later"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tc.headers {
+				header.Set(k, v)
+			}
+			if got := parseRetryAfter(header); got < tc.min || got > tc.max {
+				t.Fatalf("parseRetryAfter = %v, want between %v and %v", got, tc.min, tc.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// 全量会话重放模式
+const (
+	SessionReplayModeOriginal = "original" // 每一轮使用原始记录中的历史
+	SessionReplayModeChained  = "chained"  // 将上一轮重放的响应带入下一轮历史
+)
+
+// newTurnMessages 计算当前轮次相对上一轮新增的消息
+// 原始记录的历史通常是「上一轮请求 + 上一轮助手回复 + 新消息」
+func newTurnMessages(prev []openai.ChatCompletionMessage, cur []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if len(prev) > 0 && len(cur) > len(prev) {
+		if cur[len(prev)].Role == openai.ChatMessageRoleAssistant {
+			return cur[len(prev)+1:]
+		}
+		return cur[len(prev):]
+	}
+
+	// 历史结构不符合预期时，取最后一条助手消息之后的内容
+	for i := len(cur) - 1; i >= 0; i-- {
+		if cur[i].Role == openai.ChatMessageRoleAssistant {
+			return cur[i+1:]
+		}
+	}
+	return cur
+}
+
+// remapToolResults 将本轮新增消息中的工具结果指向上一轮重放回复中的工具调用
+// recorded 为原始历史中上一轮的助手回复，重放回复的工具调用按顺序与其比对，数量或工具名称不一致时无法继续
+func remapToolResults(recorded openai.ChatCompletionMessage, replayed openai.ChatCompletionMessage, messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+	hasToolResults := false
+	for _, message := range messages {
+		if message.Role == openai.ChatMessageRoleTool {
+			hasToolResults = true
+			break
+		}
+	}
+	if len(replayed.ToolCalls) == 0 && !hasToolResults {
+		return messages, nil
+	}
+
+	if len(replayed.ToolCalls) != len(recorded.ToolCalls) {
+		return nil, fmt.Errorf("replayed tool calls do not match the recorded tool calls: replayed %d, recorded %d", len(replayed.ToolCalls), len(recorded.ToolCalls))
+	}
+	toolCallIDs := make(map[string]string, len(recorded.ToolCalls))
+	for i, call := range recorded.ToolCalls {
+		if replayed.ToolCalls[i].Function.Name != call.Function.Name {
+			return nil, fmt.Errorf("replayed tool calls do not match the recorded tool calls: call %d is %s, recorded %s", i, replayed.ToolCalls[i].Function.Name, call.Function.Name)
+		}
+		toolCallIDs[call.ID] = replayed.ToolCalls[i].ID
+	}
+
+	remapped := make([]openai.ChatCompletionMessage, len(messages))
+	copy(remapped, messages)
+	for i := range remapped {
+		if remapped[i].Role != openai.ChatMessageRoleTool {
+			continue
+		}
+		id, ok := toolCallIDs[remapped[i].ToolCallID]
+		if !ok {
+			return nil, fmt.Errorf("tool result %s does not answer a recorded tool call", remapped[i].ToolCallID)
+		}
+		remapped[i].ToolCallID = id
+	}
+	return remapped, nil
+}
+
+// runSessionReplay 按顺序重放会话中的每一轮，并记录进度
+func runSessionReplay(ctx context.Context, replaySession *ReplaySession, records []Record, req SessionReplayRequest) {
+	completed, failed := 0, 0
+	status := "completed"
+
+	defer func() {
+		if r := recover(); r != nil {
+			zapLogger.Error("session replay panicked",
+				zap.String("replay_session_id", replaySession.ID),
+				zap.Any("panic", r))
+			status = "failed"
+		}
+		if err := updateReplaySessionProgress(replaySession.ID, completed, failed); err != nil {
+			zapLogger.Error("failed to update session replay progress", zap.Error(err))
+		}
+		if err := updateReplaySessionStatus(replaySession.ID, status); err != nil {
+			zapLogger.Error("failed to update session replay status", zap.Error(err))
+		}
+	}()
+
+	startTime := time.Now()
+	var prevOriginal []openai.ChatCompletionMessage
+	var history []openai.ChatCompletionMessage
+	reportProgress := func() {
+		if err := updateReplaySessionProgress(replaySession.ID, completed, failed); err != nil {
+			zapLogger.Error("failed to update session replay progress", zap.Error(err))
+		}
+	}
+
+	for i, record := range records {
+		if ctx.Err() != nil {
+			status = ReplayStatusCancelled
+			return
+		}
+
+		var chatReq openai.ChatCompletionRequest
+		if err := json.Unmarshal([]byte(record.Request), &chatReq); err != nil {
+			failed++
+			saveSessionReplayError(replaySession.ID, record, req, fmt.Sprintf("unsupported request type: %v", err))
+			if req.Mode == SessionReplayModeChained {
+				status = "failed"
+				return
+			}
+			reportProgress()
+			continue
+		}
+
+		originalMessages := chatReq.Messages
+		if req.Mode == SessionReplayModeChained && i > 0 {
+			// 新增的工具结果回答的是原始回复中的工具调用，需要改为指向重放回复中的工具调用
+			added := newTurnMessages(prevOriginal, originalMessages)
+			var recorded openai.ChatCompletionMessage
+			if n := len(originalMessages) - len(added) - 1; n >= 0 && originalMessages[n].Role == openai.ChatMessageRoleAssistant {
+				recorded = originalMessages[n]
+			}
+			added, err := remapToolResults(recorded, history[len(history)-1], added)
+			if err != nil {
+				failed++
+				saveSessionReplayError(replaySession.ID, record, req, err.Error())
+				status = "failed"
+				return
+			}
+
+			messages := make([]openai.ChatCompletionMessage, 0, len(history)+len(added))
+			messages = append(messages, history...)
+			messages = append(messages, added...)
+			chatReq.Messages = messages
+		}
+		prevOriginal = originalMessages
+
+		result, err := executeReplayDebug(ctx, replaySession.ID, record.TurnNumber, chatReq, req.Provider, req.Model, req.Config, replayDebugOptions{
+			OriginalRecordID: record.ID,
+			Timeout:          time.Duration(req.TimeoutSeconds) * time.Second,
+			NoCache:          req.NoCache,
+			Mutations:        req.Mutations,
+		})
+		if err != nil && ctx.Err() != nil {
+			// 被取消时停止后续轮次，本轮记录已保存为cancelled
+			status = ReplayStatusCancelled
+			return
+		}
+		if err != nil {
+			failed++
+			zapLogger.Error("session replay turn failed",
+				zap.String("replay_session_id", replaySession.ID),
+				zap.Int("turn_number", record.TurnNumber),
+				zap.String("error", err.Error()))
+			if req.Mode == SessionReplayModeChained {
+				// 链式模式下后续轮次依赖本轮响应，无法继续
+				status = "failed"
+				return
+			}
+		} else if req.Mode == SessionReplayModeChained {
+			// 链式模式下无法从响应中取出助手回复时，后续轮次同样无法继续
+			var resp openai.ChatCompletionResponse
+			errorMsg := ""
+			if err := json.Unmarshal([]byte(result.Response), &resp); err != nil {
+				errorMsg = fmt.Sprintf("failed to parse replay response: %v", err)
+			} else if len(resp.Choices) == 0 {
+				errorMsg = "replay response has no choices"
+			}
+			if errorMsg != "" {
+				failed++
+				zapLogger.Error("session replay turn failed",
+					zap.String("replay_session_id", replaySession.ID),
+					zap.Int("turn_number", record.TurnNumber),
+					zap.String("error", errorMsg))
+				if err := failReplayRecord(result.ID, errorMsg); err != nil {
+					zapLogger.Error("failed to mark session replay turn as failed", zap.Error(err))
+				}
+				status = "failed"
+				return
+			}
+			completed++
+			history = append(chatReq.Messages, resp.Choices[0].Message)
+		} else {
+			completed++
+		}
+
+		reportProgress()
+	}
+
+	zapLogger.Info("session replay finished",
+		zap.String("replay_session_id", replaySession.ID),
+		zap.String("mode", req.Mode),
+		zap.Int("completed", completed),
+		zap.Int("failed", failed),
+		zap.Duration("duration", time.Since(startTime)))
+}
+
+// saveSessionReplayError 记录无法执行的重放轮次
+func saveSessionReplayError(replaySessionID string, record Record, req SessionReplayRequest, errorMsg string) {
+	replayRecord, err := buildReplayRecord(replaySessionID, record.TurnNumber, json.RawMessage(record.Request), nil, "error", errorMsg, req.Provider, req.Model, req.Config)
+	if err == nil {
+		replayRecord.OriginalRecordID = record.ID
+		err = saveReplayRecord(replayRecord)
+	}
+	if err != nil {
+		zapLogger.Error("failed to save session replay error", zap.Error(err))
+	}
+}
+
+// getSessionReplayProgress 汇总全量重放的逐轮状态
+func getSessionReplayProgress(replaySession *ReplaySession) (*SessionReplayProgress, error) {
+	records, err := getAllSessionRecords(replaySession.OriginalSessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	replayRecords, err := getAllReplaySessionRecords(replaySession.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 每条原始记录取第一条对应的重放记录
+	byOriginal := make(map[string]ReplayRecord)
+	for _, replayRecord := range replayRecords {
+		if replayRecord.OriginalRecordID == "" {
+			continue
+		}
+		if _, exists := byOriginal[replayRecord.OriginalRecordID]; !exists {
+			byOriginal[replayRecord.OriginalRecordID] = replayRecord
+		}
+	}
+
+	pendingStatus := "pending"
+	if replaySession.Status != "running" {
+		pendingStatus = "skipped"
+	}
+
+	turns := make([]TurnProgress, 0, len(records))
+	for _, record := range records {
+		turn := TurnProgress{
+			TurnNumber:       record.TurnNumber,
+			OriginalRecordID: record.ID,
+			Status:           pendingStatus,
+		}
+		if replayRecord, ok := byOriginal[record.ID]; ok {
+			turn.ReplayRecordID = replayRecord.ID
+			turn.Status = replayRecord.Status
+			turn.ErrorMsg = replayRecord.ErrorMsg
+		}
+		turns = append(turns, turn)
+	}
+
+	return &SessionReplayProgress{
+		ReplaySessionID: replaySession.ID,
+		Status:          replaySession.Status,
+		Mode:            replaySession.Mode,
+		TotalTurns:      replaySession.TotalTurns,
+		CompletedTurns:  replaySession.CompletedTurns,
+		FailedTurns:     replaySession.FailedTurns,
+		Turns:           turns,
+	}, nil
+}
+
+// handleReplaySession 全量重放会话
+func handleReplaySession(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Session ID is required",
+		})
+		return
+	}
+
+	var req SessionReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = SessionReplayModeOriginal
+	}
+	if req.Mode != SessionReplayModeOriginal && req.Mode != SessionReplayModeChained {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay mode: " + req.Mode,
+		})
+		return
+	}
+
+	if err := req.Config.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid replay config: " + err.Error(),
+		})
+		return
+	}
+
+	if err := validateRequestMutations(req.Mutations); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid mutations: " + err.Error(),
+		})
+		return
+	}
+
+	// 提前检查provider配置，避免创建无法执行的重放会话
+	if _, err := newProviderClient(req.Provider); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	session, err := getSession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session: " + err.Error(),
+		})
+		return
+	}
+
+	if session == nil || !inCurrentProject(c, session.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Session not found",
+		})
+		return
+	}
+
+	records, err := getAllSessionRecords(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get session records: " + err.Error(),
+		})
+		return
+	}
+
+	if len(records) == 0 {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Session has no records to replay",
+		})
+		return
+	}
+
+	replaySession, err := createFullReplaySession(session, req.Name, req.Mode, records)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create replay session: " + err.Error(),
+		})
+		return
+	}
+
+	// 后台执行，通过进度接口轮询，可通过取消接口停止
+	ctx, done := replayCancels.register(context.Background(), replaySession.ID)
+	go func() {
+		defer done()
+		runSessionReplay(ctx, replaySession, records, req)
+	}()
+
+	c.JSON(http.StatusAccepted, APIResponse{
+		Success: true,
+		Data:    replaySession,
+	})
+}
+
+// handleGetReplaySessionProgress 获取全量重放进度
+func handleGetReplaySessionProgress(c *gin.Context) {
+	sessionID := c.Param("id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay Session ID is required",
+		})
+		return
+	}
+
+	replaySession, err := getReplaySession(sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+
+	if replaySession == nil || !inCurrentProject(c, replaySession.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
+	progress, err := getSessionReplayProgress(replaySession)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay progress: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    progress,
+	})
+}
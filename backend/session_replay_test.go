@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestNewTurnMessages(t *testing.T) {
+	msg := func(role, content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: role, Content: content}
+	}
+	system := msg(openai.ChatMessageRoleSystem, "sys")
+	user1 := msg(openai.ChatMessageRoleUser, "u1")
+	assistant1 := msg(openai.ChatMessageRoleAssistant, "a1")
+	user2 := msg(openai.ChatMessageRoleUser, "u2")
+	tool := msg(openai.ChatMessageRoleTool, "t1")
+
+	cases := []struct {
+		name string
+		prev []openai.ChatCompletionMessage
+		cur  []openai.ChatCompletionMessage
+		want []openai.ChatCompletionMessage
+	}{
+		{
+			name: "first turn",
+			prev: nil,
+			cur:  []openai.ChatCompletionMessage{system, user1},
+			want: []openai.ChatCompletionMessage{system, user1},
+		},
+		{
+			name: "previous request plus assistant reply",
+			prev: []openai.ChatCompletionMessage{system, user1},
+			cur:  []openai.ChatCompletionMessage{system, user1, assistant1, user2},
+			want: []openai.ChatCompletionMessage{user2},
+		},
+		{
+			name: "previous request without assistant reply",
+			prev: []openai.ChatCompletionMessage{system, user1},
+			cur:  []openai.ChatCompletionMessage{system, user1, user2},
+			want: []openai.ChatCompletionMessage{user2},
+		},
+		{
+			name: "tool results after assistant reply",
+			prev: []openai.ChatCompletionMessage{system, user1},
+			cur:  []openai.ChatCompletionMessage{system, user1, assistant1, tool},
+			want: []openai.ChatCompletionMessage{tool},
+		},
+		{
+			name: "truncated history falls back to last assistant message",
+			prev: []openai.ChatCompletionMessage{system, user1, assistant1, user2},
+			cur:  []openai.ChatCompletionMessage{system, assistant1, user2},
+			want: []openai.ChatCompletionMessage{user2},
+		},
+		{
+			name: "no growth and no assistant message",
+			prev: []openai.ChatCompletionMessage{system, user1},
+			cur:  []openai.ChatCompletionMessage{system, user2},
+			want: []openai.ChatCompletionMessage{system, user2},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newTurnMessages(tc.prev, tc.cur); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("newTurnMessages = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestInterruptedSessionReplaysAreMarkedFailed(t *testing.T) {
+	setupTestEnv(t, nil)
+
+	running := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "running", OriginalSessionID: "s1", StartTurnNumber: 1, Status: "running", Mode: SessionReplayModeOriginal}
+	active := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "active", OriginalSessionID: "s1", StartTurnNumber: 1, Status: "active"}
+	for _, replaySession := range []*ReplaySession{running, active} {
+		if err := db.Create(replaySession).Error; err != nil {
+			t.Fatalf("create replay session: %v", err)
+		}
+	}
+
+	count, err := failInterruptedReplaySessions()
+	if err != nil || count != 1 {
+		t.Fatalf("failInterruptedReplaySessions = %d, %v, want 1", count, err)
+	}
+	for id, want := range map[string]string{running.ID: "failed", active.ID: "active"} {
+		stored, err := getReplaySession(id)
+		if err != nil || stored == nil || stored.Status != want {
+			t.Fatalf("replay session %s: %+v (err %v), want status %s", id, stored, err, want)
+		}
+	}
+}
+
+func TestChainedReplayStopsWhenResponseHasNoChoices(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+
+	records := []Record{
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Status: "success",
+			Request: `{"model":"m","messages":[{"role":"user","content":"u1"}]}`},
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 2, Status: "success",
+			Request: `{"model":"m","messages":[{"role":"user","content":"u1"},{"role":"assistant","content":"a1"},{"role":"user","content":"u2"}]}`},
+	}
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "chained", OriginalSessionID: "s1",
+		StartTurnNumber: 1, Status: "running", Mode: SessionReplayModeChained, TotalTurns: len(records)}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+
+	runSessionReplay(context.Background(), replaySession, records, SessionReplayRequest{Provider: "stub", Mode: SessionReplayModeChained})
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("provider called %d times, want the replay to stop after the first turn", got)
+	}
+	stored, err := getReplaySession(replaySession.ID)
+	if err != nil || stored.Status != "failed" || stored.CompletedTurns != 0 || stored.FailedTurns != 1 {
+		t.Fatalf("replay session after run: %+v (err %v)", stored, err)
+	}
+	replayRecords, err := getAllReplaySessionRecords(replaySession.ID)
+	if err != nil || len(replayRecords) != 1 {
+		t.Fatalf("replay records: %d (err %v), want 1", len(replayRecords), err)
+	}
+	if replayRecords[0].Status != "error" || replayRecords[0].ErrorMsg != "replay response has no choices" {
+		t.Fatalf("turn record status %q, error %q", replayRecords[0].Status, replayRecords[0].ErrorMsg)
+	}
+}
+
+func TestRemapToolResults(t *testing.T) {
+	call := func(id, name string) openai.ToolCall {
+		return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: "{}"}}
+	}
+	assistant := func(calls ...openai.ToolCall) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: calls}
+	}
+	toolResult := func(id string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleTool, ToolCallID: id, Content: "result"}
+	}
+	user := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "next"}
+
+	cases := []struct {
+		name     string
+		recorded openai.ChatCompletionMessage
+		replayed openai.ChatCompletionMessage
+		messages []openai.ChatCompletionMessage
+		want     []openai.ChatCompletionMessage
+		wantErr  string
+	}{
+		{
+			name:     "no tool calls",
+			recorded: assistant(),
+			replayed: assistant(),
+			messages: []openai.ChatCompletionMessage{user},
+			want:     []openai.ChatCompletionMessage{user},
+		},
+		{
+			name:     "ids follow the replayed calls in order",
+			recorded: assistant(call("orig-1", "lookup"), call("orig-2", "search")),
+			replayed: assistant(call("new-1", "lookup"), call("new-2", "search")),
+			messages: []openai.ChatCompletionMessage{toolResult("orig-2"), toolResult("orig-1")},
+			want:     []openai.ChatCompletionMessage{toolResult("new-2"), toolResult("new-1")},
+		},
+		{
+			name:     "replayed reply made no tool calls",
+			recorded: assistant(call("orig-1", "lookup")),
+			replayed: assistant(),
+			messages: []openai.ChatCompletionMessage{toolResult("orig-1")},
+			wantErr:  "replayed 0, recorded 1",
+		},
+		{
+			name:     "replayed reply made unexpected tool calls",
+			recorded: assistant(),
+			replayed: assistant(call("new-1", "lookup")),
+			messages: []openai.ChatCompletionMessage{user},
+			wantErr:  "replayed 1, recorded 0",
+		},
+		{
+			name:     "different tool",
+			recorded: assistant(call("orig-1", "lookup")),
+			replayed: assistant(call("new-1", "search")),
+			messages: []openai.ChatCompletionMessage{toolResult("orig-1")},
+			wantErr:  "call 0 is search, recorded lookup",
+		},
+		{
+			name:     "result for an unknown call",
+			recorded: assistant(call("orig-1", "lookup")),
+			replayed: assistant(call("new-1", "lookup")),
+			messages: []openai.ChatCompletionMessage{toolResult("other")},
+			wantErr:  "does not answer a recorded tool call",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := remapToolResults(tc.recorded, tc.replayed, tc.messages)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("error = %v, want containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("remapToolResults = %+v, %v, want %+v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestChainedReplayRemapsToolCallIDs(t *testing.T) {
+	var requests []openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		raw, _ := io.ReadAll(r.Body)
+		json.Unmarshal(raw, &req)
+		requests = append(requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		if len(requests) == 1 {
+			w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","tool_calls":[{"id":"new-1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`))
+			return
+		}
+		w.Write([]byte(`{"id":"c2","model":"m","choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+
+	records := []Record{
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Status: "success",
+			Request: `{"model":"m","messages":[{"role":"user","content":"u1"}]}`},
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 2, Status: "success",
+			Request: `{"model":"m","messages":[{"role":"user","content":"u1"},{"role":"assistant","tool_calls":[{"id":"orig-1","type":"function","function":{"name":"lookup","arguments":"{}"}}]},{"role":"tool","tool_call_id":"orig-1","content":"42"}]}`},
+	}
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "chained", OriginalSessionID: "s1",
+		StartTurnNumber: 1, Status: "running", Mode: SessionReplayModeChained, TotalTurns: len(records)}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+
+	runSessionReplay(context.Background(), replaySession, records, SessionReplayRequest{Provider: "stub", Mode: SessionReplayModeChained})
+
+	if len(requests) != 2 {
+		t.Fatalf("provider called %d times, want 2", len(requests))
+	}
+	messages := requests[1].Messages
+	last := messages[len(messages)-1]
+	if last.Role != openai.ChatMessageRoleTool || last.ToolCallID != "new-1" || messages[len(messages)-2].ToolCalls[0].ID != "new-1" {
+		t.Fatalf("second turn messages: %+v", messages)
+	}
+	stored, err := getReplaySession(replaySession.ID)
+	if err != nil || stored.Status != "completed" || stored.CompletedTurns != 2 {
+		t.Fatalf("replay session after run: %+v (err %v)", stored, err)
+	}
+}
+
+func TestSessionReplayReportsProgressForUnparsableTurns(t *testing.T) {
+	var failedBeforeSecondCall atomic.Int32
+	failedBeforeSecondCall.Store(-1)
+	var replaySessionID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if stored, err := getReplaySession(replaySessionID); err == nil && stored != nil {
+			failedBeforeSecondCall.Store(int32(stored.FailedTurns))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+
+	records := []Record{
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Status: "success", Request: `not json`},
+		{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 2, Status: "success",
+			Request: `{"model":"m","messages":[{"role":"user","content":"u2"}]}`},
+	}
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "original", OriginalSessionID: "s1",
+		StartTurnNumber: 1, Status: "running", Mode: SessionReplayModeOriginal, TotalTurns: len(records)}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+	replaySessionID = replaySession.ID
+
+	runSessionReplay(context.Background(), replaySession, records, SessionReplayRequest{Provider: "stub", Mode: SessionReplayModeOriginal})
+
+	if got := failedBeforeSecondCall.Load(); got != 1 {
+		t.Fatalf("failed turns while the second turn ran = %d, want the unparsable turn counted (1)", got)
+	}
+	stored, err := getReplaySession(replaySession.ID)
+	if err != nil || stored.CompletedTurns+stored.FailedTurns != stored.TotalTurns {
+		t.Fatalf("replay session after run: %+v (err %v)", stored, err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSessionAttributeFilter(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	sessions := []*Session{
+		{ID: "gold", ProjectID: DefaultProjectID, Name: "gold", Attributes: map[string]interface{}{"tier": "gold", "seats": 10, "beta": true, "note": "a<b"}},
+		{ID: "silver", ProjectID: DefaultProjectID, Name: "silver", Attributes: map[string]interface{}{"tier": "silver", "seats": "10"}},
+		{ID: "nested", ProjectID: DefaultProjectID, Name: "nested", Attributes: map[string]interface{}{"plan": map[string]interface{}{"tier": "gold"}}},
+		{ID: "plain", ProjectID: DefaultProjectID, Name: "plain"},
+	}
+	for _, session := range sessions {
+		if err := db.Create(session).Error; err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name  string
+		attrs []string
+		want  []string
+	}{
+		{name: "string value", attrs: []string{"tier:gold"}, want: []string{"gold"}},
+		{name: "number matches number and string", attrs: []string{"seats:10"}, want: []string{"gold", "silver"}},
+		{name: "boolean", attrs: []string{"beta:true"}, want: []string{"gold"}},
+		{name: "special characters", attrs: []string{"note:a<b"}, want: []string{"gold"}},
+		{name: "all attributes must match", attrs: []string{"tier:gold", "seats:10"}, want: []string{"gold"}},
+		{name: "percent is not a wildcard", attrs: []string{"tier:%"}, want: nil},
+		{name: "underscore is not a wildcard", attrs: []string{"tier:gol_"}, want: nil},
+		{name: "partial value", attrs: []string{"tier:gol"}, want: nil},
+		{name: "nested key is not matched", attrs: []string{"plan:gold"}, want: nil},
+		{name: "missing key", attrs: []string{"region:eu"}, want: nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			query := url.Values{"attr": tc.attrs}
+			w := doJSON(t, r, http.MethodGet, "/api/sessions?"+query.Encode(), nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Data struct {
+					Data []Session `json:"data"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode sessions: %v", err)
+			}
+			var got []string
+			for _, session := range resp.Data.Data {
+				got = append(got, session.ID)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("sessions = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	if w := doJSON(t, r, http.MethodGet, "/api/sessions?attr="+url.QueryEscape(`a"b:1`), nil, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("key with a double quote: status %d, want 400", w.Code)
+	}
+}
+
+func TestSessionFieldsFromIngestAndUpdate(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	trace := func(body map[string]interface{}) {
+		t.Helper()
+		body["request"] = map[string]interface{}{"model": "m", "messages": []map[string]string{{"role": "user", "content": "hi"}}}
+		body["status"] = "success"
+		if w := doJSON(t, r, http.MethodPost, "/api/trace", body, nil); w.Code != http.StatusOK {
+			t.Fatalf("trace: status %d, body %s", w.Code, w.Body.String())
+		}
+	}
+	getSessionData := func(id string) Session {
+		t.Helper()
+		session, err := getSession(id)
+		if err != nil || session == nil {
+			t.Fatalf("getSession: %v, %v", session, err)
+		}
+		return *session
+	}
+
+	// 创建会话时写入会话级字段
+	trace(map[string]interface{}{
+		"session_id": "checkout", "turn_number": 1, "session_name": "Checkout flow", "user_id": "u1",
+		"app_name": "shop", "environment": "staging", "version": "1.2.0",
+		"session_attributes": map[string]interface{}{"tier": "gold"},
+	})
+	// 会话已存在时只补充为空的字段和不存在的属性
+	trace(map[string]interface{}{
+		"session_id": "checkout", "turn_number": 2, "session_name": "Renamed", "user_id": "u2",
+		"session_attributes": map[string]interface{}{"tier": "silver", "region": "eu"},
+	})
+	trace(map[string]interface{}{"session_id": "search", "turn_number": 1, "app_name": "search"})
+
+	session := getSessionData("checkout")
+	if session.Name != "Checkout flow" || session.UserID != "u1" || session.AppName != "shop" || session.Environment != "staging" || session.Version != "1.2.0" {
+		t.Fatalf("ingested session fields: %+v", session)
+	}
+	if !reflect.DeepEqual(session.Attributes, map[string]interface{}{"tier": "gold", "region": "eu"}) {
+		t.Fatalf("ingested session attributes: %v", session.Attributes)
+	}
+
+	// 通过接口修改，属性值为null时删除该键
+	if w := doJSON(t, r, http.MethodPatch, "/api/sessions/checkout", map[string]interface{}{}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty update: status %d, want 400", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, "/api/sessions/checkout", map[string]interface{}{"name": " "}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("blank name: status %d, want 400", w.Code)
+	}
+	update := map[string]interface{}{"environment": "production", "attributes": map[string]interface{}{"tier": nil, "beta": true}}
+	if w := doJSON(t, r, http.MethodPatch, "/api/sessions/checkout", update, nil); w.Code != http.StatusOK {
+		t.Fatalf("update session: status %d, body %s", w.Code, w.Body.String())
+	}
+	session = getSessionData("checkout")
+	if session.Environment != "production" || session.UserID != "u1" || !reflect.DeepEqual(session.Attributes, map[string]interface{}{"region": "eu", "beta": true}) {
+		t.Fatalf("updated session: %+v", session)
+	}
+
+	// 接口修改的值不会被之后的埋点覆盖
+	trace(map[string]interface{}{"session_id": "checkout", "turn_number": 3, "environment": "staging"})
+	if session := getSessionData("checkout"); session.Environment != "production" {
+		t.Fatalf("environment after ingest: %q, want production", session.Environment)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{query: "user_id=u1", want: []string{"checkout"}},
+		{query: "app_name=search", want: []string{"search"}},
+		{query: "environment=production&version=1.2.0", want: []string{"checkout"}},
+		{query: "environment=staging", want: nil},
+		{query: "name=checkout", want: []string{"checkout"}},
+		{query: "attr=region:eu", want: []string{"checkout"}},
+		{query: "attr=tier:gold", want: nil},
+	}
+	for _, tc := range cases {
+		w := doJSON(t, r, http.MethodGet, "/api/sessions?"+tc.query, nil, nil)
+		var resp struct {
+			Data struct {
+				Data []Session `json:"data"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode sessions: %v", err)
+		}
+		var got []string
+		for _, session := range resp.Data.Data {
+			got = append(got, session.ID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("sessions?%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 标签和备注的目标类型
+const (
+	TagTargetSession       = "session"
+	TagTargetRecord        = "record"
+	TagTargetReplaySession = "replay_session"
+)
+
+// BookmarkTagName 收藏使用的保留标签
+const BookmarkTagName = "bookmark"
+
+// tagTargetPrefixes 支持标签、收藏和备注的目标路由前缀
+var tagTargetPrefixes = map[string]string{
+	"/sessions":        TagTargetSession,
+	"/records":         TagTargetRecord,
+	"/replay-sessions": TagTargetReplaySession,
+}
+
+// isValidTagTarget 检查目标类型是否合法
+func isValidTagTarget(targetType string) bool {
+	switch targetType {
+	case TagTargetSession, TagTargetRecord, TagTargetReplaySession:
+		return true
+	}
+	return false
+}
+
+// parseTagQuery 解析查询参数中的标签名称，支持重复参数和逗号分隔
+func parseTagQuery(c *gin.Context) []string {
+	var tags []string
+	for _, value := range c.QueryArray("tag") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				tags = append(tags, name)
+			}
+		}
+	}
+	return tags
+}
+
+// normalizeTagNames 去掉标签名称的首尾空白、空名称和重复项
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	return result
+}
+
+// tagTargetProjectID 获取标签或备注目标所属的项目，目标不存在时返回空字符串
+func tagTargetProjectID(targetType string, targetID string) (string, error) {
+	switch targetType {
+	case TagTargetSession:
+		session, err := getSession(targetID)
+		if err != nil || session == nil {
+			return "", err
+		}
+		return session.ProjectID, nil
+	case TagTargetRecord:
+		record, err := getRecord(targetID)
+		if err != nil || record == nil {
+			return "", err
+		}
+		return record.ProjectID, nil
+	case TagTargetReplaySession:
+		replaySession, err := getReplaySession(targetID)
+		if err != nil || replaySession == nil {
+			return "", err
+		}
+		return replaySession.ProjectID, nil
+	}
+	return "", nil
+}
+
+// loadTagTarget 检查路径参数中的目标是否存在，失败时直接写入错误响应
+func loadTagTarget(c *gin.Context, targetType string) (string, bool) {
+	targetID := c.Param("id")
+	if targetID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Target ID is required",
+		})
+		return "", false
+	}
+
+	projectID, err := tagTargetProjectID(targetType, targetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get target: " + err.Error(),
+		})
+		return "", false
+	}
+
+	if projectID == "" || !inCurrentProject(c, projectID) {
+		notFound := "Session not found"
+		switch targetType {
+		case TagTargetRecord:
+			notFound = "Record not found"
+		case TagTargetReplaySession:
+			notFound = "Replay session not found"
+		}
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: notFound,
+		})
+		return "", false
+	}
+
+	return targetID, true
+}
+
+// loadTag 根据路径参数加载标签，失败时直接写入错误响应
+func loadTag(c *gin.Context, param string) *Tag {
+	tagID := c.Param(param)
+	if tagID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Tag ID is required",
+		})
+		return nil
+	}
+
+	tag, err := getTag(tagID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tag: " + err.Error(),
+		})
+		return nil
+	}
+
+	if tag == nil || !inCurrentProject(c, tag.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Tag not found",
+		})
+		return nil
+	}
+
+	return tag
+}
+
+// respondTargetTags 返回目标当前的标签
+func respondTargetTags(c *gin.Context, targetType string, targetID string) {
+	tags, err := getTargetTags(targetType, []string{targetID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tags: " + err.Error(),
+		})
+		return
+	}
+
+	result := tags[targetID]
+	if result == nil {
+		result = []Tag{}
+	}
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleCreateTag 创建标签
+func handleCreateTag(c *gin.Context) {
+	var req CreateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Name cannot be empty",
+		})
+		return
+	}
+
+	existing, err := getTagByName(currentProjectID(c), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to check tag: " + err.Error(),
+		})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Tag already exists: " + name,
+		})
+		return
+	}
+
+	tag := &Tag{
+		ID:        uuid.New().String(),
+		ProjectID: currentProjectID(c),
+		Name:      name,
+		Color:     req.Color,
+	}
+	if err := createTag(tag); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create tag: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tag,
+	})
+}
+
+// handleGetTags 获取当前项目的全部标签
+func handleGetTags(c *gin.Context) {
+	tags, err := getTags(currentProjectID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tags: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tags,
+	})
+}
+
+// handleUpdateTag 重命名标签或修改颜色（只更新传入的字段）
+func handleUpdateTag(c *gin.Context) {
+	tag := loadTag(c, "id")
+	if tag == nil {
+		return
+	}
+
+	var req UpdateTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Name == nil && req.Color == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Name cannot be empty",
+			})
+			return
+		}
+		if name != tag.Name {
+			existing, err := getTagByName(tag.ProjectID, name)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, APIResponse{
+					Success: false,
+					Message: "Failed to check tag: " + err.Error(),
+				})
+				return
+			}
+			if existing != nil {
+				c.JSON(http.StatusBadRequest, APIResponse{
+					Success: false,
+					Message: "Tag already exists: " + name,
+				})
+				return
+			}
+		}
+		tag.Name = name
+	}
+	if req.Color != nil {
+		tag.Color = *req.Color
+	}
+
+	if err := saveTag(tag); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update tag: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    tag,
+	})
+}
+
+// handleDeleteTag 删除标签及其全部关联
+func handleDeleteTag(c *gin.Context) {
+	tag := loadTag(c, "id")
+	if tag == nil {
+		return
+	}
+
+	if err := deleteTag(tag.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete tag: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Tag deleted successfully",
+	})
+}
+
+// handleGetTagAssignments 获取标签关联的目标（可按 target_type 过滤），例如列出全部收藏的记录
+func handleGetTagAssignments(c *gin.Context) {
+	tag := loadTag(c, "id")
+	if tag == nil {
+		return
+	}
+
+	targetType := c.Query("target_type")
+	if targetType != "" && !isValidTagTarget(targetType) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid target type: " + targetType,
+		})
+		return
+	}
+
+	// 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 || size > 100 {
+		size = 20
+	}
+
+	result, err := getTagAssignments(currentProjectID(c), tag.ID, targetType, page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tag assignments: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// handleGetTargetTags 获取目标的标签
+func handleGetTargetTags(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		respondTargetTags(c, targetType, targetID)
+	}
+}
+
+// handleAddTargetTags 按名称为目标添加标签，不存在的标签自动创建，返回目标当前的标签
+func handleAddTargetTags(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		var req AddTagsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid request format: " + err.Error(),
+			})
+			return
+		}
+
+		names := normalizeTagNames(req.Tags)
+		if len(names) == 0 {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Tags cannot be empty",
+			})
+			return
+		}
+
+		tags, err := ensureTags(currentProjectID(c), names)
+		if err == nil {
+			err = addTagAssignments(tags, targetType, targetID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to add tags: " + err.Error(),
+			})
+			return
+		}
+
+		respondTargetTags(c, targetType, targetID)
+	}
+}
+
+// handleRemoveTargetTag 移除目标上的标签
+func handleRemoveTargetTag(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		tag := loadTag(c, "tag_id")
+		if tag == nil {
+			return
+		}
+
+		if err := removeTagAssignment(tag.ID, targetType, targetID); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to remove tag: " + err.Error(),
+			})
+			return
+		}
+
+		respondTargetTags(c, targetType, targetID)
+	}
+}
+
+// handleBookmarkTarget 收藏目标（添加保留标签 bookmark）
+func handleBookmarkTarget(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		tags, err := ensureTags(currentProjectID(c), []string{BookmarkTagName})
+		if err == nil {
+			err = addTagAssignments(tags, targetType, targetID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to add bookmark: " + err.Error(),
+			})
+			return
+		}
+
+		respondTargetTags(c, targetType, targetID)
+	}
+}
+
+// handleRemoveBookmark 取消收藏
+func handleRemoveBookmark(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		// 未收藏时不报错，直接返回当前标签
+		tag, err := getTagByName(currentProjectID(c), BookmarkTagName)
+		if err == nil && tag != nil {
+			err = removeTagAssignment(tag.ID, targetType, targetID)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to remove bookmark: " + err.Error(),
+			})
+			return
+		}
+
+		respondTargetTags(c, targetType, targetID)
+	}
+}
+
+// handleGetTargetNotes 获取目标的备注
+func handleGetTargetNotes(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		notes, err := getTargetNotes(targetType, targetID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to get notes: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Data:    notes,
+		})
+	}
+}
+
+// handleCreateTargetNote 为目标添加备注
+func handleCreateTargetNote(targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID, ok := loadTagTarget(c, targetType)
+		if !ok {
+			return
+		}
+
+		var req CreateNoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid request format: " + err.Error(),
+			})
+			return
+		}
+
+		note := &Note{
+			ID:         uuid.New().String(),
+			TargetType: targetType,
+			TargetID:   targetID,
+			Author:     strings.TrimSpace(req.Author),
+			Content:    req.Content,
+		}
+		if err := createNote(note); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to create note: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, APIResponse{
+			Success: true,
+			Data:    note,
+		})
+	}
+}
+
+// loadNote 根据路径参数加载备注，备注按目标所属的项目隔离，失败时直接写入错误响应
+func loadNote(c *gin.Context) *Note {
+	noteID := c.Param("id")
+	if noteID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Note ID is required",
+		})
+		return nil
+	}
+
+	note, err := getNote(noteID)
+	var projectID string
+	if err == nil && note != nil {
+		projectID, err = tagTargetProjectID(note.TargetType, note.TargetID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get note: " + err.Error(),
+		})
+		return nil
+	}
+
+	if note == nil || !inCurrentProject(c, projectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Note not found",
+		})
+		return nil
+	}
+
+	return note
+}
+
+// handleUpdateNote 修改备注内容
+func handleUpdateNote(c *gin.Context) {
+	note := loadNote(c)
+	if note == nil {
+		return
+	}
+
+	var req UpdateNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	note.Content = req.Content
+	if err := saveNote(note); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update note: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    note,
+	})
+}
+
+// handleDeleteNote 删除备注
+func handleDeleteNote(c *gin.Context) {
+	note := loadNote(c)
+	if note == nil {
+		return
+	}
+
+	if err := deleteNote(note.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete note: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Note deleted successfully",
+	})
+}
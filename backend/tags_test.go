@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTagsAreProjectScoped(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	otherHeader := map[string]string{ProjectHeader: "other"}
+	for _, session := range []*Session{
+		{ID: "s1", ProjectID: DefaultProjectID, Name: "s1"},
+		{ID: "s2", ProjectID: other.ID, Name: "s2"},
+	} {
+		if err := db.Create(session).Error; err != nil {
+			t.Fatalf("create session: %v", err)
+		}
+	}
+
+	// 两个项目可以各自拥有同名标签
+	addTags := map[string][]string{"tags": {"flaky"}}
+	if w := doJSON(t, r, http.MethodPost, "/api/sessions/s1/tags", addTags, nil); w.Code != http.StatusOK {
+		t.Fatalf("tag default session: status %d, body %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/sessions/s2/tags", addTags, otherHeader); w.Code != http.StatusOK {
+		t.Fatalf("tag other session: status %d, body %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, r, http.MethodPost, "/api/tags", CreateTagRequest{Name: "flaky"}, nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("duplicate name in the same project: status %d, want 400", w.Code)
+	}
+
+	listTags := func(headers map[string]string) []Tag {
+		w := doJSON(t, r, http.MethodGet, "/api/tags", nil, headers)
+		var resp struct {
+			Data []Tag `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode tags: %v", err)
+		}
+		return resp.Data
+	}
+	defaultTags, otherTags := listTags(nil), listTags(otherHeader)
+	if len(defaultTags) != 1 || defaultTags[0].ProjectID != DefaultProjectID {
+		t.Fatalf("default project tags: %+v", defaultTags)
+	}
+	if len(otherTags) != 1 || otherTags[0].ProjectID != other.ID || otherTags[0].ID == defaultTags[0].ID {
+		t.Fatalf("other project tags: %+v", otherTags)
+	}
+
+	// 其他项目的标签不可见
+	otherTagPath := "/api/tags/" + otherTags[0].ID
+	if w := doJSON(t, r, http.MethodGet, otherTagPath+"/assignments", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("assignments from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPatch, otherTagPath, map[string]string{"name": "renamed"}, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("update from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodDelete, otherTagPath, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("delete from default project: status %d, want 404", w.Code)
+	}
+
+	// 标签过滤只匹配当前项目的标签
+	w := doJSON(t, r, http.MethodGet, "/api/sessions?tag=flaky", nil, otherHeader)
+	var sessions struct {
+		Data PaginatedResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		t.Fatalf("decode sessions: %v", err)
+	}
+	if sessions.Data.Total != 1 {
+		t.Fatalf("other project sessions tagged flaky: %d, want 1", sessions.Data.Total)
+	}
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+// 工具调用模式
+const (
+	ToolModeNone     = ""         // 不处理工具调用
+	ToolModeManual   = "manual"   // 暂停等待用户提交工具结果
+	ToolModeStub     = "stub"     // 优先使用已注册的工具桩，缺失时暂停
+	ToolModeRecorded = "recorded" // 使用原始会话中记录的工具结果，缺失时标记并暂停
+)
+
+// ReplayStatusToolPending 等待工具结果的重放记录状态
+const ReplayStatusToolPending = "tool_pending"
+
+// maxToolRounds 单次请求中自动推进工具调用的最大轮数
+const maxToolRounds = 10
+
+// isValidToolMode 检查工具调用模式是否合法
+func isValidToolMode(mode string) bool {
+	switch mode {
+	case ToolModeNone, ToolModeManual, ToolModeStub, ToolModeRecorded:
+		return true
+	}
+	return false
+}
+
+// responseToolCalls 提取响应中模型发起的工具调用
+func responseToolCalls(resp openai.ChatCompletionResponse) []openai.ToolCall {
+	if len(resp.Choices) == 0 {
+		return nil
+	}
+	return resp.Choices[0].Message.ToolCalls
+}
+
+// advanceToolLoop 使用工具桩或录制的工具结果自动推进工具调用，直到无法继续或达到轮数上限
+func advanceToolLoop(ctx context.Context, record *ReplayRecord) (*ReplayRecord, error) {
+	for round := 0; round < maxToolRounds; round++ {
+		if record.Status != ReplayStatusToolPending {
+			return record, nil
+		}
+
+		var results []ToolResult
+		var ok bool
+		var err error
+		switch record.ToolMode {
+		case ToolModeStub:
+			results, ok, err = resolveToolCallsWithStubs(record)
+		case ToolModeRecorded:
+			results, ok, err = resolveToolCallsWithRecorded(record)
+		default:
+			return record, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// 存在无法自动回答的调用，等待用户提交
+			return record, nil
+		}
+
+		record, err = continueToolCalls(ctx, record, results)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// resolveToolCallsWithStubs 使用工具桩回答等待中的工具调用，全部命中时返回true
+func resolveToolCallsWithStubs(record *ReplayRecord) ([]ToolResult, bool, error) {
+	var toolCalls []openai.ToolCall
+	if err := json.Unmarshal([]byte(record.ToolCalls), &toolCalls); err != nil {
+		return nil, false, fmt.Errorf("failed to parse tool calls: %v", err)
+	}
+
+	replaySession, err := getReplaySession(record.ReplaySessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if replaySession == nil {
+		return nil, false, fmt.Errorf("replay session not found")
+	}
+	stubs, err := getToolStubs(replaySession.ProjectID, record.ReplaySessionID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 会话级工具桩优先于全局工具桩
+	stubByName := make(map[string]ToolStub)
+	for _, stub := range stubs {
+		if existing, ok := stubByName[stub.ToolName]; ok && existing.ReplaySessionID != "" {
+			continue
+		}
+		stubByName[stub.ToolName] = stub
+	}
+
+	results := make([]ToolResult, 0, len(toolCalls))
+	for _, call := range toolCalls {
+		stub, ok := stubByName[call.Function.Name]
+		if !ok {
+			return nil, false, nil
+		}
+		results = append(results, ToolResult{
+			ToolCallID: call.ID,
+			Name:       call.Function.Name,
+			Content:    stub.Response,
+			Source:     "stub",
+		})
+	}
+	return results, true, nil
+}
+
+// recordedToolResult 原始会话中记录的一次工具调用及其结果
+type recordedToolResult struct {
+	Name      string
+	Arguments string
+	Content   string
+}
+
+// normalizeToolArguments 规范化工具参数JSON，使键顺序和空白不影响匹配
+func normalizeToolArguments(arguments string) string {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(arguments), &parsed); err != nil {
+		return strings.TrimSpace(arguments)
+	}
+	normalized, err := json.Marshal(parsed)
+	if err != nil {
+		return strings.TrimSpace(arguments)
+	}
+	return string(normalized)
+}
+
+// toolMatchKey 工具名称和规范化参数组成的匹配键
+func toolMatchKey(name string, arguments string) string {
+	return name + "\x00" + normalizeToolArguments(arguments)
+}
+
+// collectRecordedToolResults 从原始会话记录的消息历史中提取工具调用与结果
+func collectRecordedToolResults(sessionID string) (map[string][]recordedToolResult, error) {
+	records, err := getAllSessionRecords(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string][]recordedToolResult)
+	seen := make(map[string]bool)
+	for _, record := range records {
+		var chatReq openai.ChatCompletionRequest
+		if err := json.Unmarshal([]byte(record.Request), &chatReq); err != nil {
+			continue
+		}
+
+		// 同一次工具调用会出现在后续每一轮的历史中，按调用ID去重
+		calls := make(map[string]openai.ToolCall)
+		for _, msg := range chatReq.Messages {
+			for _, call := range msg.ToolCalls {
+				calls[call.ID] = call
+			}
+			if msg.Role != openai.ChatMessageRoleTool || msg.ToolCallID == "" || seen[msg.ToolCallID] {
+				continue
+			}
+			call, ok := calls[msg.ToolCallID]
+			if !ok {
+				continue
+			}
+			seen[msg.ToolCallID] = true
+			key := toolMatchKey(call.Function.Name, call.Function.Arguments)
+			index[key] = append(index[key], recordedToolResult{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+				Content:   msg.Content,
+			})
+		}
+	}
+	return index, nil
+}
+
+// resolveToolCallsWithRecorded 使用原始会话中记录的工具结果回答工具调用，全部命中时返回true
+// 未命中的调用会被标记在重放记录上
+func resolveToolCallsWithRecorded(record *ReplayRecord) ([]ToolResult, bool, error) {
+	var toolCalls []openai.ToolCall
+	if err := json.Unmarshal([]byte(record.ToolCalls), &toolCalls); err != nil {
+		return nil, false, fmt.Errorf("failed to parse tool calls: %v", err)
+	}
+
+	replaySession, err := getReplaySession(record.ReplaySessionID)
+	if err != nil {
+		return nil, false, err
+	}
+	if replaySession == nil {
+		return nil, false, fmt.Errorf("replay session not found")
+	}
+
+	index, err := collectRecordedToolResults(replaySession.OriginalSessionID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 同一参数的调用可能出现多次，按出现顺序依次消费，之前轮次已消费的结果不再重复使用
+	used, err := recordedToolUsage(record.ContinuedFromID)
+	if err != nil {
+		return nil, false, err
+	}
+	results := make([]ToolResult, 0, len(toolCalls))
+	var unmatched []openai.ToolCall
+	for _, call := range toolCalls {
+		key := toolMatchKey(call.Function.Name, call.Function.Arguments)
+		candidates := index[key]
+		if len(candidates) == 0 {
+			unmatched = append(unmatched, call)
+			continue
+		}
+		n := used[key]
+		if n >= len(candidates) {
+			n = len(candidates) - 1
+		}
+		used[key]++
+		results = append(results, ToolResult{
+			ToolCallID: call.ID,
+			Name:       call.Function.Name,
+			Content:    candidates[n].Content,
+			Source:     "recorded",
+		})
+	}
+
+	if len(unmatched) > 0 {
+		unmatchedJSON, err := json.Marshal(unmatched)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to marshal unmatched tool calls: %v", err)
+		}
+		if err := flagUnmatchedToolCalls(record.ID, string(unmatchedJSON)); err != nil {
+			return nil, false, err
+		}
+		record.UnmatchedToolCalls = string(unmatchedJSON)
+		return nil, false, nil
+	}
+	return results, true, nil
+}
+
+// recordedToolUsage 沿工具往返链统计之前各轮已消费的录制结果数量，按匹配键计数
+func recordedToolUsage(recordID string) (map[string]int, error) {
+	used := make(map[string]int)
+	seen := make(map[string]bool)
+	for recordID != "" && !seen[recordID] {
+		seen[recordID] = true
+		record, err := getReplayRecord(recordID)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			break
+		}
+
+		var toolCalls []openai.ToolCall
+		var results []ToolResult
+		if err := json.Unmarshal([]byte(record.ToolCalls), &toolCalls); err == nil {
+			json.Unmarshal([]byte(record.ToolResults), &results)
+		}
+		callByID := make(map[string]openai.ToolCall, len(toolCalls))
+		for _, call := range toolCalls {
+			callByID[call.ID] = call
+		}
+		for _, result := range results {
+			call, ok := callByID[result.ToolCallID]
+			if !ok || result.Source != "recorded" {
+				continue
+			}
+			used[toolMatchKey(call.Function.Name, call.Function.Arguments)]++
+		}
+		recordID = record.ContinuedFromID
+	}
+	return used, nil
+}
+
+// continueToolCalls 回填工具结果并继续对话，返回新的重放记录
+func continueToolCalls(ctx context.Context, record *ReplayRecord, results []ToolResult) (*ReplayRecord, error) {
+	if record.Status != ReplayStatusToolPending {
+		return nil, fmt.Errorf("replay record is not waiting for tool results")
+	}
+
+	var chatReq openai.ChatCompletionRequest
+	if err := json.Unmarshal([]byte(record.Request), &chatReq); err != nil {
+		return nil, fmt.Errorf("failed to parse replay request: %v", err)
+	}
+
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal([]byte(record.Response), &resp); err != nil || len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("failed to parse replay response")
+	}
+
+	var toolCalls []openai.ToolCall
+	if err := json.Unmarshal([]byte(record.ToolCalls), &toolCalls); err != nil {
+		return nil, fmt.Errorf("failed to parse tool calls: %v", err)
+	}
+
+	resultByID := make(map[string]ToolResult, len(results))
+	for _, result := range results {
+		resultByID[result.ToolCallID] = result
+	}
+
+	// 追加助手的工具调用消息和每个工具调用的结果消息
+	messages := append(chatReq.Messages, resp.Choices[0].Message)
+	ordered := make([]ToolResult, 0, len(toolCalls))
+	for _, call := range toolCalls {
+		result, ok := resultByID[call.ID]
+		if !ok {
+			return nil, fmt.Errorf("missing result for tool call: %s", call.ID)
+		}
+		if result.Name == "" {
+			result.Name = call.Function.Name
+		}
+		if result.Source == "" {
+			result.Source = "manual"
+		}
+		ordered = append(ordered, result)
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    result.Content,
+			Name:       result.Name,
+			ToolCallID: call.ID,
+		})
+	}
+	chatReq.Messages = messages
+
+	resultsJSON, err := json.Marshal(ordered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool results: %v", err)
+	}
+	return executeReplayDebug(ctx, record.ReplaySessionID, record.TurnNumber, chatReq, record.Provider, record.Model, record.Config, replayDebugOptions{
+		ToolMode:         record.ToolMode,
+		ContinuedFromID:  record.ID,
+		ToolResults:      string(resultsJSON),
+		OriginalRecordID: record.OriginalRecordID,
+	})
+}
+
+// handleSubmitToolResults 提交工具结果并继续调试对话
+func handleSubmitToolResults(c *gin.Context) {
+	var req SubmitToolResultsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	record, err := getReplayRecord(req.ReplayRecordID)
+	inProject := false
+	if err == nil && record != nil {
+		inProject, err = replayRecordInCurrentProject(c, record)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay record: " + err.Error(),
+		})
+		return
+	}
+
+	if !inProject {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay record not found",
+		})
+		return
+	}
+
+	if record.Status != ReplayStatusToolPending {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Replay record is not waiting for tool results",
+		})
+		return
+	}
+
+	// 客户端断开或调用取消接口时停止调用
+	ctx, done := replayCancels.register(c.Request.Context(), record.ReplaySessionID)
+	defer done()
+	result, err := continueToolCalls(ctx, record, req.Results)
+	if err == nil {
+		result, err = advanceToolLoop(ctx, result)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to continue tool calls: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// toolStubSessionInCurrentProject 检查工具桩关联的重放会话是否属于调用方的项目，未关联重放会话时不需要检查
+func toolStubSessionInCurrentProject(c *gin.Context, replaySessionID string) (bool, error) {
+	if replaySessionID == "" {
+		return true, nil
+	}
+	replaySession, err := getReplaySession(replaySessionID)
+	if err != nil {
+		return false, err
+	}
+	return replaySession != nil && inCurrentProject(c, replaySession.ProjectID), nil
+}
+
+// handleCreateToolStub 注册工具桩
+func handleCreateToolStub(c *gin.Context) {
+	var req CreateToolStubRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	inProject, err := toolStubSessionInCurrentProject(c, req.ReplaySessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+	if !inProject {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
+	stub, err := createToolStub(currentProjectID(c), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create tool stub: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    stub,
+	})
+}
+
+// handleGetToolStubs 获取工具桩列表
+func handleGetToolStubs(c *gin.Context) {
+	replaySessionID := c.Query("replay_session_id")
+	inProject, err := toolStubSessionInCurrentProject(c, replaySessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get replay session: " + err.Error(),
+		})
+		return
+	}
+	if !inProject {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Replay session not found",
+		})
+		return
+	}
+
+	stubs, err := getToolStubs(currentProjectID(c), replaySessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tool stubs: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    stubs,
+	})
+}
+
+// handleDeleteToolStub 删除工具桩
+func handleDeleteToolStub(c *gin.Context) {
+	stubID := c.Param("id")
+	if stubID == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Tool stub ID is required",
+		})
+		return
+	}
+
+	stub, err := getToolStub(stubID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get tool stub: " + err.Error(),
+		})
+		return
+	}
+
+	if stub == nil || !inCurrentProject(c, stub.ProjectID) {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "Tool stub not found",
+		})
+		return
+	}
+
+	if err := deleteToolStub(stubID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete tool stub: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Tool stub deleted successfully",
+	})
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sashabaranov/go-openai"
+)
+
+// mustJSON 序列化测试数据
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestRecordedToolResultsAreConsumedAcrossRounds(t *testing.T) {
+	setupTestEnv(t, nil)
+
+	// 原始会话中同一参数的工具调用出现了两次，结果不同
+	lookup := func(id string) openai.ToolCall {
+		return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{"q":"x"}`}}
+	}
+	history := openai.ChatCompletionRequest{
+		Model: "m",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "go"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{lookup("orig-1")}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "orig-1", Content: "first"},
+			{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{lookup("orig-2")}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "orig-2", Content: "second"},
+		},
+	}
+	original := &Record{ID: uuid.New().String(), ProjectID: DefaultProjectID, SessionID: "s1", TurnNumber: 1, Request: mustJSON(t, history), Status: "success"}
+	if err := db.Create(original).Error; err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "r", OriginalSessionID: "s1", StartTurnNumber: 1}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+
+	// 第一轮已经用录制结果回答了一次调用
+	first := &ReplayRecord{
+		ID:              uuid.New().String(),
+		ReplaySessionID: replaySession.ID,
+		TurnNumber:      1,
+		Request:         "{}",
+		Status:          "success",
+		ToolMode:        ToolModeRecorded,
+		ToolCalls:       mustJSON(t, []openai.ToolCall{lookup("call-1")}),
+		ToolResults:     mustJSON(t, []ToolResult{{ToolCallID: "call-1", Name: "lookup", Content: "first", Source: "recorded"}}),
+	}
+	second := &ReplayRecord{
+		ID:              uuid.New().String(),
+		ReplaySessionID: replaySession.ID,
+		TurnNumber:      1,
+		Request:         "{}",
+		Status:          ReplayStatusToolPending,
+		ToolMode:        ToolModeRecorded,
+		ToolCalls:       mustJSON(t, []openai.ToolCall{lookup("call-2")}),
+		ContinuedFromID: first.ID,
+	}
+	for _, record := range []*ReplayRecord{first, second} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("create replay record: %v", err)
+		}
+	}
+
+	results, ok, err := resolveToolCallsWithRecorded(second)
+	if err != nil || !ok {
+		t.Fatalf("resolveToolCallsWithRecorded: ok %v, err %v", ok, err)
+	}
+	if len(results) != 1 || results[0].Content != "second" {
+		t.Fatalf("second round got %+v, want the second recorded result", results)
+	}
+
+	// 链上没有之前的轮次时从第一个结果开始
+	second.ContinuedFromID = ""
+	results, ok, err = resolveToolCallsWithRecorded(second)
+	if err != nil || !ok || results[0].Content != "first" {
+		t.Fatalf("first round got %+v (ok %v, err %v), want the first recorded result", results, ok, err)
+	}
+}
+
+func TestContinueToolCallsResolvesPendingRecordOnlyAfterSuccess(t *testing.T) {
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":{"message":"bad request","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"c1","model":"m","choices":[{"message":{"role":"assistant","content":"done"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	setupTestEnv(t, &Config{Providers: ProvidersConfig{
+		"stub": {Name: "stub", APIKey: "test-key", BaseURL: server.URL + "/v1", Enabled: true, Retry: RetryConfig{MaxAttempts: 1}},
+	}})
+
+	call := openai.ToolCall{ID: "call-1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{}`}}
+	pending := &ReplayRecord{
+		ID:              uuid.New().String(),
+		ReplaySessionID: uuid.New().String(),
+		TurnNumber:      1,
+		Request:         mustJSON(t, openai.ChatCompletionRequest{Model: "m", Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "go"}}}),
+		Response:        mustJSON(t, openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{call}}}}}),
+		Status:          ReplayStatusToolPending,
+		Provider:        "stub",
+		Model:           "m",
+		ToolMode:        ToolModeManual,
+		ToolCalls:       mustJSON(t, []openai.ToolCall{call}),
+	}
+	if err := db.Create(pending).Error; err != nil {
+		t.Fatalf("create replay record: %v", err)
+	}
+	results := []ToolResult{{ToolCallID: "call-1", Content: "42"}}
+
+	// 继续调用失败时上一条记录仍在等待工具结果，可以重新提交
+	failing.Store(true)
+	if _, err := continueToolCalls(context.Background(), pending, results); err == nil {
+		t.Fatalf("continueToolCalls succeeded against failing provider")
+	}
+	stored, err := getReplayRecord(pending.ID)
+	if err != nil || stored.Status != ReplayStatusToolPending || stored.ToolResults != "" {
+		t.Fatalf("pending record after failed continuation: %+v (err %v)", stored, err)
+	}
+
+	failing.Store(false)
+	next, err := continueToolCalls(context.Background(), stored, results)
+	if err != nil {
+		t.Fatalf("continueToolCalls: %v", err)
+	}
+	if next.Status != "success" || next.ContinuedFromID != pending.ID {
+		t.Fatalf("continuation record: %+v", next)
+	}
+	stored, err = getReplayRecord(pending.ID)
+	if err != nil || stored.Status != "success" || stored.ToolResults == "" {
+		t.Fatalf("pending record after continuation: %+v (err %v)", stored, err)
+	}
+
+	// 已结束等待的记录不能再次继续
+	stored.Status = ReplayStatusToolPending
+	if _, err := continueToolCalls(context.Background(), stored, results); err == nil {
+		t.Fatalf("continued a record that was already resolved")
+	}
+}
+
+func TestToolStubsAreProjectScoped(t *testing.T) {
+	setupTestEnv(t, nil)
+	r := newTestRouter()
+
+	other := &Project{ID: uuid.New().String(), Name: "other"}
+	if err := createProject(other); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+	otherHeader := map[string]string{ProjectHeader: "other"}
+
+	w := doJSON(t, r, http.MethodPost, "/api/tool-stubs", CreateToolStubRequest{ToolName: "lookup", Response: "stubbed"}, otherHeader)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create stub: status %d, body %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data ToolStub `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode stub: %v", err)
+	}
+	if created.Data.ProjectID != other.ID {
+		t.Fatalf("stub project = %q, want %q", created.Data.ProjectID, other.ID)
+	}
+
+	listStubs := func(headers map[string]string) []ToolStub {
+		w := doJSON(t, r, http.MethodGet, "/api/tool-stubs", nil, headers)
+		var resp struct {
+			Data []ToolStub `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode stubs: %v", err)
+		}
+		return resp.Data
+	}
+	if stubs := listStubs(nil); len(stubs) != 0 {
+		t.Fatalf("default project lists %d stubs from another project", len(stubs))
+	}
+	if stubs := listStubs(otherHeader); len(stubs) != 1 {
+		t.Fatalf("other project lists %d stubs, want 1", len(stubs))
+	}
+
+	// 其他项目的全局工具桩不回答本项目的工具调用
+	replaySession := &ReplaySession{ID: uuid.New().String(), ProjectID: DefaultProjectID, Name: "r", OriginalSessionID: "s1", StartTurnNumber: 1}
+	if err := db.Create(replaySession).Error; err != nil {
+		t.Fatalf("create replay session: %v", err)
+	}
+	record := &ReplayRecord{ReplaySessionID: replaySession.ID, ToolCalls: mustJSON(t, []openai.ToolCall{
+		{ID: "call-1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: "{}"}},
+	})}
+	if _, ok, err := resolveToolCallsWithStubs(record); err != nil || ok {
+		t.Fatalf("resolveToolCallsWithStubs = %v, %v, want unresolved", ok, err)
+	}
+
+	stubPath := "/api/tool-stubs/" + created.Data.ID
+	if w := doJSON(t, r, http.MethodDelete, stubPath, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("delete from default project: status %d, want 404", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodDelete, stubPath, nil, otherHeader); w.Code != http.StatusOK {
+		t.Fatalf("delete from own project: status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用户角色：viewer 只能查看数据，debugger 还可以运行重放和修改调试数据，admin 可以删除数据和管理项目、密钥和用户
+const (
+	RoleViewer   = "viewer"
+	RoleDebugger = "debugger"
+	RoleAdmin    = "admin"
+)
+
+// roleScopes 用户角色对应的接口权限
+var roleScopes = map[string]string{
+	RoleViewer:   ScopeRead,
+	RoleDebugger: ScopeDebug,
+	RoleAdmin:    ScopeAdmin,
+}
+
+// LoginCookieName 保存登录令牌的Cookie名称
+const LoginCookieName = "llmtrace_session"
+
+// userContextKey 请求上下文中保存登录用户的键
+const userContextKey = "user"
+
+// minPasswordLength 密码最短长度
+const minPasswordLength = 8
+
+// dummyPasswordHash 用户不存在时同样执行一次bcrypt比较，避免通过响应时间判断用户名是否存在
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("llmtrace-dummy-password"), bcrypt.DefaultCost)
+
+// isValidRole 检查用户角色是否有效
+func isValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
+
+// hasScope 检查用户角色是否具备指定权限
+func (u *User) hasScope(scope string) bool {
+	return scopeIncludes(roleScopes[u.Role], scope)
+}
+
+// hashPassword 使用bcrypt计算密码摘要
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// validatePassword 检查密码长度，bcrypt最多使用前72个字节
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("password must be at most 72 bytes")
+	}
+	return nil
+}
+
+// generateLoginToken 生成随机登录令牌
+func generateLoginToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate login token: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// loginSessionTTL 登录会话有效期
+func loginSessionTTL() time.Duration {
+	if hours := GetConfig().Auth.SessionTTLHours; hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 168 * time.Hour
+}
+
+// setLoginCookie 写入登录Cookie，maxAge 为负数时删除Cookie
+func setLoginCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(LoginCookieName, token, maxAge, "/", "", GetConfig().Auth.CookieSecure, true)
+}
+
+// authenticateLoginSession 根据登录Cookie获取用户，Cookie无效、已过期或用户已停用时返回nil
+func authenticateLoginSession(c *gin.Context) (*User, error) {
+	token, err := c.Cookie(LoginCookieName)
+	if err != nil || token == "" {
+		return nil, nil
+	}
+
+	session, err := getLoginSessionByHash(hashToken(token))
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	user, err := getUser(session.UserID)
+	if err != nil || user == nil || user.Disabled {
+		return nil, err
+	}
+	return user, nil
+}
+
+// currentUser 获取登录用户，未登录或使用API密钥时返回nil
+func currentUser(c *gin.Context) *User {
+	value, ok := c.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+	user, _ := value.(*User)
+	return user
+}
+
+// loadUser 根据路径参数加载用户，失败时直接写入错误响应
+func loadUser(c *gin.Context) *User {
+	user, err := getUser(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get user: " + err.Error(),
+		})
+		return nil
+	}
+
+	if user == nil {
+		c.JSON(http.StatusNotFound, APIResponse{
+			Success: false,
+			Message: "User not found",
+		})
+		return nil
+	}
+
+	return user
+}
+
+// isLastActiveAdmin 检查用户是否是最后一个未停用的管理员
+func isLastActiveAdmin(user *User) (bool, error) {
+	if user.Role != RoleAdmin || user.Disabled {
+		return false, nil
+	}
+	count, err := countActiveAdmins()
+	if err != nil {
+		return false, err
+	}
+	return count <= 1, nil
+}
+
+// handleLogin 用户名密码登录，成功后写入登录Cookie
+func handleLogin(c *gin.Context) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := getUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get user: " + err.Error(),
+		})
+		return
+	}
+
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	passwordErr := bcrypt.CompareHashAndPassword(passwordHash, []byte(req.Password))
+	if user == nil || user.Disabled || passwordErr != nil {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Invalid username or password",
+		})
+		return
+	}
+
+	token, err := generateLoginToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create login session: " + err.Error(),
+		})
+		return
+	}
+
+	ttl := loginSessionTTL()
+	session := &LoginSession{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := createLoginSession(session); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create login session: " + err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	if err := saveUser(user); err != nil {
+		log.Printf("Failed to update user last login time: %v", err)
+	}
+	if err := deleteExpiredLoginSessions(); err != nil {
+		log.Printf("Failed to clean up login sessions: %v", err)
+	}
+
+	setLoginCookie(c, token, int(ttl.Seconds()))
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// handleLogout 退出登录，删除登录会话和Cookie
+func handleLogout(c *gin.Context) {
+	if token, err := c.Cookie(LoginCookieName); err == nil && token != "" {
+		if err := deleteLoginSessionByHash(hashToken(token)); err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to logout: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	setLoginCookie(c, "", -1)
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Logged out successfully",
+	})
+}
+
+// handleGetCurrentUser 获取当前登录用户
+func handleGetCurrentUser(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Not logged in",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// handleChangePassword 修改自己的密码，其他登录会话随之失效
+func handleChangePassword(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, APIResponse{
+			Success: false,
+			Message: "Not logged in",
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.OldPassword)); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Old password is incorrect",
+		})
+		return
+	}
+
+	if err := validatePassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid password: " + err.Error(),
+		})
+		return
+	}
+
+	passwordHash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to change password: " + err.Error(),
+		})
+		return
+	}
+	user.PasswordHash = passwordHash
+	if err := saveUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to change password: " + err.Error(),
+		})
+		return
+	}
+
+	token, _ := c.Cookie(LoginCookieName)
+	if err := deleteUserLoginSessions(user.ID, hashToken(token)); err != nil {
+		log.Printf("Failed to revoke login sessions: %v", err)
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "Password changed successfully",
+	})
+}
+
+// handleCreateUser 创建用户
+func handleCreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Username cannot be empty",
+		})
+		return
+	}
+
+	if !isValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid role: " + req.Role + " (expected viewer, debugger or admin)",
+		})
+		return
+	}
+
+	if err := validatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid password: " + err.Error(),
+		})
+		return
+	}
+
+	existing, err := getUserByUsername(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to check user: " + err.Error(),
+		})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "User already exists: " + username,
+		})
+		return
+	}
+
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create user: " + err.Error(),
+		})
+		return
+	}
+
+	user := &User{
+		ID:           uuid.New().String(),
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         req.Role,
+	}
+	if err := createUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to create user: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// handleGetUsers 获取全部用户
+func handleGetUsers(c *gin.Context) {
+	users, err := getUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to get users: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    users,
+	})
+}
+
+// handleUpdateUser 修改用户角色、重置密码或停用用户（只更新传入的字段），
+// 重置密码或停用后该用户需要重新登录
+func handleUpdateUser(c *gin.Context) {
+	user := loadUser(c)
+	if user == nil {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	if req.Role == nil && req.Password == nil && req.Disabled == nil {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Nothing to update",
+		})
+		return
+	}
+
+	if req.Role != nil && !isValidRole(*req.Role) {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Invalid role: " + *req.Role + " (expected viewer, debugger or admin)",
+		})
+		return
+	}
+
+	// 不能降级或停用最后一个管理员，否则无法再管理用户
+	demoted := (req.Role != nil && *req.Role != RoleAdmin) || (req.Disabled != nil && *req.Disabled)
+	if demoted {
+		lastAdmin, err := isLastActiveAdmin(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to check admins: " + err.Error(),
+			})
+			return
+		}
+		if lastAdmin {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Cannot demote or disable the last admin",
+			})
+			return
+		}
+	}
+
+	revokeSessions := false
+	if req.Password != nil {
+		if err := validatePassword(*req.Password); err != nil {
+			c.JSON(http.StatusBadRequest, APIResponse{
+				Success: false,
+				Message: "Invalid password: " + err.Error(),
+			})
+			return
+		}
+		passwordHash, err := hashPassword(*req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, APIResponse{
+				Success: false,
+				Message: "Failed to update user: " + err.Error(),
+			})
+			return
+		}
+		user.PasswordHash = passwordHash
+		revokeSessions = true
+	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+	if req.Disabled != nil {
+		user.Disabled = *req.Disabled
+		revokeSessions = revokeSessions || user.Disabled
+	}
+
+	if err := saveUser(user); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to update user: " + err.Error(),
+		})
+		return
+	}
+
+	if revokeSessions {
+		if err := deleteUserLoginSessions(user.ID, ""); err != nil {
+			log.Printf("Failed to revoke login sessions: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// handleDeleteUser 删除用户，最后一个管理员不能删除
+func handleDeleteUser(c *gin.Context) {
+	user := loadUser(c)
+	if user == nil {
+		return
+	}
+
+	lastAdmin, err := isLastActiveAdmin(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to check admins: " + err.Error(),
+		})
+		return
+	}
+	if lastAdmin {
+		c.JSON(http.StatusBadRequest, APIResponse{
+			Success: false,
+			Message: "Cannot delete the last admin",
+		})
+		return
+	}
+
+	if err := deleteUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, APIResponse{
+			Success: false,
+			Message: "Failed to delete user: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, APIResponse{
+		Success: true,
+		Message: "User deleted successfully",
+	})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// createTestAPIKey 直接在数据库中创建API密钥，返回密钥明文
+func createTestAPIKey(t *testing.T, scope, projectID string) string {
+	t.Helper()
+
+	rawKey, err := generateAPIKey()
+	if err != nil {
+		t.Fatalf("generateAPIKey: %v", err)
+	}
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		Name:      scope + "-key",
+		Scope:     scope,
+		ProjectID: projectID,
+		Prefix:    rawKey[:len(apiKeyPrefix)+8],
+		KeyHash:   hashToken(rawKey),
+	}
+	if err := createAPIKey(key); err != nil {
+		t.Fatalf("createAPIKey: %v", err)
+	}
+	return rawKey
+}
+
+func TestUserRoutesRejectProjectScopedAdminKey(t *testing.T) {
+	setupTestEnv(t, &Config{Auth: AuthConfig{Enabled: true}})
+	r := newTestRouter()
+
+	project := &Project{ID: uuid.New().String(), Name: "alpha"}
+	if err := createProject(project); err != nil {
+		t.Fatalf("createProject: %v", err)
+	}
+
+	passwordHash, err := hashPassword("password-admin")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	admin := &User{ID: uuid.New().String(), Username: "root", PasswordHash: passwordHash, Role: RoleAdmin}
+	if err := createUser(admin); err != nil {
+		t.Fatalf("createUser: %v", err)
+	}
+
+	scoped := map[string]string{APIKeyHeader: createTestAPIKey(t, ScopeAdmin, project.ID)}
+	unscoped := map[string]string{APIKeyHeader: createTestAPIKey(t, ScopeAdmin, "")}
+
+	cases := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{http.MethodPost, "/api/users", map[string]string{"username": "mallory", "password": "password-mallory", "role": RoleAdmin}},
+		{http.MethodGet, "/api/users", nil},
+		{http.MethodPatch, "/api/users/" + admin.ID, map[string]string{"password": "password-stolen"}},
+		{http.MethodDelete, "/api/users/" + admin.ID, nil},
+	}
+	for _, tc := range cases {
+		w := doJSON(t, r, tc.method, tc.path, tc.body, scoped)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s %s with project-scoped admin key: status %d, want 403", tc.method, tc.path, w.Code)
+		}
+	}
+
+	// 被拒绝的请求不能修改用户
+	if user, err := getUserByUsername("mallory"); err != nil || user != nil {
+		t.Fatalf("user created by project-scoped key: %v, %v", user, err)
+	}
+	stored, err := getUser(admin.ID)
+	if err != nil || stored == nil || stored.PasswordHash != passwordHash {
+		t.Fatalf("admin password changed by project-scoped key")
+	}
+
+	// 不限定项目的管理员密钥可以管理用户
+	w := doJSON(t, r, http.MethodPost, "/api/users", map[string]string{"username": "bob", "password": "password-bob", "role": RoleViewer}, unscoped)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create user with unscoped admin key: status %d, body %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(t, r, http.MethodGet, "/api/users", nil, unscoped); w.Code != http.StatusOK {
+		t.Fatalf("list users with unscoped admin key: status %d", w.Code)
+	}
+}
@@ -168,9 +168,9 @@ const DebugChat: React.FC<DebugChatProps> = ({
               color: '#666'
             }}>
               <Text type="secondary">
-                配置: 温度 {JSON.parse(record.config).temperature} • 
-                Token {JSON.parse(record.config).max_tokens} • 
-                Top-P {JSON.parse(record.config).top_p}
+                配置: 温度 {record.config.temperature} • 
+                Token {record.config.max_tokens} • 
+                Top-P {record.config.top_p}
               </Text>
             </div>
           )}
@@ -28,7 +28,7 @@ export interface Record {
   turn_number: number;
   request: string;
   response: string;
-  status: 'success' | 'error' | 'pending';
+  status: 'success' | 'error' | 'pending' | 'cancelled';
   error_msg: string;
   metadata: string;
   created_at: string;
@@ -40,7 +40,9 @@ export interface ReplaySession {
   name: string;
   original_session_id: string;
   start_turn_number: number;
-  status: 'active' | 'completed';
+  status: 'active' | 'running' | 'completed' | 'failed' | 'archived' | 'cancelled';
+  conclusion?: string;
+  base_context?: { role: string; content: string }[];
   created_at: string;
   updated_at: string;
 }
@@ -56,7 +58,7 @@ export interface ReplayRecord {
   error_msg: string;
   provider: string;
   model: string;
-  config: string;
+  config?: ReplayRecordConfig | null;
   created_at: string;
 }
 
@@ -66,7 +68,7 @@ export interface TraceRequest {
   turn_number: number;
   request: any;
   response?: any;
-  status: 'success' | 'error' | 'pending';
+  status: 'success' | 'error' | 'pending' | 'cancelled';
   error_message?: string;
   metadata?: any;
 }
@@ -117,6 +119,27 @@ export interface ReplayRequest {
   presence_penalty?: number;
 }
 
+// 重放记录中保存的调试参数
+export interface ReplayRecordConfig {
+  temperature?: number;
+  top_p?: number;
+  max_tokens?: number;
+  max_completion_tokens?: number;
+  frequency_penalty?: number;
+  presence_penalty?: number;
+  seed?: number;
+  stop?: string[];
+  n?: number;
+  logprobs?: boolean;
+  top_logprobs?: number;
+  response_format?: any;
+  tool_choice?: any;
+  parallel_tool_calls?: boolean;
+  logit_bias?: { [token: string]: number };
+  user?: string;
+  reasoning_effort?: string;
+}
+
 // 重放配置
 export interface ReplayConfig {
   provider: string;